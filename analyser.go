@@ -1,18 +1,21 @@
 package jsonpat
 
 import (
+	"encoding"
+	"encoding/json"
+	"fmt"
 	"reflect"
 	"regexp"
 	"slices"
-	"strings"
 	"sync"
-)
 
-const (
-	jsonPatTag          = "jsonpat"
-	jsonPatTagSeparator = ","
+	"github.com/jamieyoung5/jsonpat/internal/fold"
+	"github.com/jamieyoung5/jsonpat/internal/mapkey"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
 )
 
+const jsonPatTag = tags.Name
+
 // structInfo holds cached reflection data for a struct.
 type structInfo struct {
 	tagging *taggingData
@@ -21,104 +24,510 @@ type structInfo struct {
 // typeCache caches structInfo for seen types to avoid costly re-calculations
 var typeCache sync.Map
 
+// patternCache caches whether a type reaches any jsonpat fields, keyed by patternKey
+var patternCache sync.Map
+
+type patternKey struct {
+	typ    reflect.Type
+	encode bool
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	entryType           = reflect.TypeOf((*interface{ jsonpatEntry() })(nil)).Elem()
+)
+
 type dynamicFieldInfo struct {
 	fieldIndices []int
-	value        string
-	loadType     string
-	re           *regexp.Regexp
+	// matchers are the alternative patterns of the field; a key matching any of
+	// them is claimed by it
+	matchers []patternMatcher
+	// excludes are the compiled exclude globs; keys matching any of them are
+	// never claimed by the field
+	excludes []*regexp.Regexp
+	// fold makes the matchers and excludes case-insensitive
+	fold bool
+	// trim stores map keys without the part matched by the pattern, and affixes
+	// are what Marshal wraps the keys in again, nil if no pattern allows it
+	trim    bool
+	affixes *keyAffixes
+	// entries is set for slice fields of Entry values, which keep the keys
+	entries bool
+	// policy chooses which of several matching keys a scalar field takes
+	policy string
+	// nested is the number of levels of maps a map field with template patterns
+	// stores its values in, one per placeholder, 0 for other fields
+	nested int
+	// capture is set when the values of the field are capture structs, whose
+	// group fields are filled from the regex matching the key
+	capture *captureInfo
+}
+
+// patternMatcher is a single pattern of a jsonpat tag.
+type patternMatcher struct {
+	value    string
+	loadType string
+	re       *regexp.Regexp
+	// custom is the Matcher of patterns using a registered matcher
+	custom Matcher
+	// template is the parsed form of template patterns, which are matched by re
+	template *tags.KeyTemplate
+	// keyGroup is the capture group of re holding the key kept by the trim option
+	keyGroup int
+	// captures are the capture groups of re filling the group fields of a
+	// capture struct, in the order of its captureInfo groups
+	captures []int
+}
+
+// keyAffixes are the literal parts a key trimmed by a pattern was stripped of.
+type keyAffixes struct {
+	prefix, suffix string
+}
+
+// knownFieldInfo describes a field addressed by an exact json key, along with
+// the `json` tag options that affect how it is encoded. tagged is set when the
+// key was given by a `json` tag, which settles conflicts between embedded fields.
+type knownFieldInfo struct {
+	name         string
+	fieldIndices []int
+	omitEmpty    bool
+	quoted       bool
+	tagged       bool
 }
 
 type taggingData struct {
-	knownFields         map[string][]int
+	knownFields     map[string]*knownFieldInfo
+	knownFieldOrder []*knownFieldInfo
+	// foldedKnownFields indexes the known fields by the case-folded form of their
+	// names, filled in once the struct has been analysed
+	foldedKnownFields   map[string]*knownFieldInfo
 	dynamicMapFields    []dynamicFieldInfo
+	dynamicSliceFields  []dynamicFieldInfo
 	dynamicScalarFields []dynamicFieldInfo
+	remainingField      []int
+	// capture is set for capture structs
+	capture *captureInfo
+}
+
+// hasPatterns reports whether any field relies on jsonpat tags.
+func (t *taggingData) hasPatterns() bool {
+	return len(t.dynamicMapFields) > 0 || len(t.dynamicSliceFields) > 0 || len(t.dynamicScalarFields) > 0 ||
+		t.remainingField != nil || t.capture != nil
+}
+
+// addKnownField registers a candidate known field. Candidates sharing a json key
+// are settled by selectKnownFields once the struct has been analysed.
+func (t *taggingData) addKnownField(field *knownFieldInfo) {
+	t.knownFieldOrder = append(t.knownFieldOrder, field)
+}
+
+// selectKnownFields settles the candidates sharing a json key the way
+// encoding/json does: the least nested field wins, then the only one tagged
+// with the key, and otherwise none of them is kept.
+func (t *taggingData) selectKnownFields() {
+	candidates := make(map[string][]*knownFieldInfo, len(t.knownFieldOrder))
+	for _, field := range t.knownFieldOrder {
+		candidates[field.name] = append(candidates[field.name], field)
+	}
+
+	t.knownFields = make(map[string]*knownFieldInfo, len(candidates))
+	t.knownFieldOrder = slices.DeleteFunc(t.knownFieldOrder, func(field *knownFieldInfo) bool {
+		if dominant := dominantField(candidates[field.name]); dominant == field {
+			t.knownFields[field.name] = field
+			return false
+		}
+		return true
+	})
+}
+
+// dominantField returns the field that wins among candidates sharing a json
+// key, or nil when none does.
+func dominantField(candidates []*knownFieldInfo) *knownFieldInfo {
+	var dominant *knownFieldInfo
+	depth, count, tagged := 0, 0, 0
+	for _, field := range candidates {
+		switch {
+		case dominant == nil || len(field.fieldIndices) < depth:
+			dominant, depth, count, tagged = field, len(field.fieldIndices), 1, 0
+		case len(field.fieldIndices) == depth:
+			count++
+		default:
+			continue
+		}
+		if field.tagged {
+			tagged++
+			if tagged == 1 {
+				dominant = field
+			}
+		}
+	}
+
+	if count > 1 && tagged != 1 {
+		return nil
+	}
+	return dominant
+}
+
+// indexFoldedKnownFields builds the case-insensitive index of the known fields.
+// Like encoding/json, the first field in field order wins when the names of
+// several fields fold to the same key.
+func (t *taggingData) indexFoldedKnownFields() {
+	t.foldedKnownFields = make(map[string]*knownFieldInfo, len(t.knownFieldOrder))
+	for _, field := range t.knownFieldOrder {
+		key := fold.Key(field.name)
+		if _, ok := t.foldedKnownFields[key]; !ok {
+			t.foldedKnownFields[key] = field
+		}
+	}
 }
 
-// analyseStruct analyses a struct for relevant tagging related info
-func analyseStruct(typ reflect.Type, info *structInfo, baseIndex []int) error {
+// knownField looks up the known field a json key addresses. An exact match is
+// preferred, falling back to a case-insensitive match unless exact is set.
+func (t *taggingData) knownField(key string, exact bool) (*knownFieldInfo, bool) {
+	if field, ok := t.knownFields[key]; ok || exact {
+		return field, ok
+	}
+	var buf [64]byte
+	field, ok := t.foldedKnownFields[string(fold.AppendKey(buf[:0], key))]
+	return field, ok
+}
+
+// analyseStruct analyses a struct for relevant tagging related info. ancestors
+// holds the structs embedding it, down from the one being analysed.
+func analyseStruct(typ reflect.Type, info *structInfo, baseIndex []int, ancestors ...reflect.Type) error {
 	// decided to use a c style loop here rather than 'range' to support older go versions
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
 		currentIndex := append(slices.Clone(baseIndex), i)
 
-		if !field.IsExported() {
-			continue // skip unexported field
+		// support embedded structs, promoting their fields the way encoding/json
+		// does, through pointers and unexported struct types
+		if field.Anonymous {
+			embedded, promoted := promotedStruct(field)
+			if embedded == nil {
+				continue
+			}
+			if promoted {
+				if slices.Contains(ancestors, embedded) {
+					continue // the fields of a recursive embed are already promoted
+				}
+				if err := analyseStruct(embedded, info, currentIndex, append(ancestors, embedded)...); err != nil {
+					return err
+				}
+				continue
+			}
 		}
 
-		// support embedded structs
-		if field.Anonymous && field.Type.Kind() == reflect.Struct {
-			if err := analyseStruct(field.Type, info, currentIndex); err != nil {
-				return err
-			}
-			continue
+		if !field.IsExported() {
+			continue // skip unexported field
 		}
 
 		err := analyseFieldTag(field, currentIndex, info)
 		if err != nil {
-			return err
+			return &TagError{
+				Type:  typ,
+				Field: field.Name,
+				Tag:   field.Tag.Get(jsonPatTag),
+				Err:   err,
+			}
 		}
 	}
 
 	return nil
 }
 
+// promotedStruct returns the struct type of an embedded field, reporting whether
+// its fields are promoted into the embedding struct, which is the case unless the
+// field has a jsonpat tag or a json tag naming it. It returns nil for embedded
+// fields that are skipped: those tagged `json:"-"`, unexported ones of non-struct
+// types, and tagged ones of unexported types, whose values can't be reached.
+func promotedStruct(field reflect.StructField) (reflect.Type, bool) {
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		if !field.IsExported() {
+			return nil, false
+		}
+		return typ, false
+	}
+
+	jsonTag, _ := field.Tag.Lookup("json")
+	data := tags.ParseJson(jsonTag)
+	_, hasJsonPat := field.Tag.Lookup(jsonPatTag)
+	switch {
+	case data.Skip:
+		return nil, false
+	case data.Name == "" && !hasJsonPat:
+		return typ, true
+	case !field.IsExported():
+		return nil, false
+	}
+	return typ, false
+}
+
 // analyseFieldTag routes the analysis of a fields tag
 func analyseFieldTag(field reflect.StructField, fieldIndex []int, info *structInfo) error {
 	if value, ok := field.Tag.Lookup(jsonPatTag); ok {
+		if group, ok := tags.ParseGroup(value); ok {
+			return analyseGroupField(field, fieldIndex, group, info)
+		}
 		return analyseJsonPatTag(field, fieldIndex, value, info)
 	} else if _, ok = field.Tag.Lookup("json"); ok {
 		return analyseJsonTag(field, fieldIndex, info)
 	}
 
 	// default to field name since there are no tags
-	info.tagging.knownFields[field.Name] = fieldIndex
+	info.tagging.addKnownField(&knownFieldInfo{name: field.Name, fieldIndices: fieldIndex})
 	return nil
 }
 
 // analyseJsonPatTag parses and stores a jsonpat tags info
 func analyseJsonPatTag(field reflect.StructField, fieldIndex []int, value string, info *structInfo) error {
 
-	data := strings.Split(value, jsonPatTagSeparator)
-	matcher, err := extractMatcher(data)
+	data, err := tags.ParseJsonPat(value)
 	if err != nil {
 		return err
 	}
 
+	if data.HasOption(tags.Remaining) {
+		return analyseRemainingField(field, fieldIndex, data, info)
+	}
+
 	fieldInfo := dynamicFieldInfo{
 		fieldIndices: fieldIndex,
-		value:        strings.TrimSpace(data[0]),
-		loadType:     matcher,
+		fold:         data.HasOption(tags.CaseInsensitive),
+	}
+	for _, pattern := range data.Patterns {
+		m, err := newPatternMatcher(pattern, fieldInfo.fold)
+		if err != nil {
+			return err
+		}
+		fieldInfo.matchers = append(fieldInfo.matchers, m)
+	}
+	for _, exclude := range data.OptionArgs(tags.Exclude) {
+		regex, err := tags.GlobRegex(exclude)
+		if err != nil {
+			return fmt.Errorf("invalid exclude glob: %w", err)
+		}
+		re, err := compilePattern(regex, fieldInfo.fold)
+		if err != nil {
+			return fmt.Errorf("invalid exclude glob: %w", err)
+		}
+		fieldInfo.excludes = append(fieldInfo.excludes, re)
 	}
 
-	// compile/validate regex once
-	if matcher == "regex" {
-		fieldInfo.re = regexp.MustCompile(fieldInfo.value)
+	if data.HasOption(tags.Trim) {
+		if field.Type.Kind() != reflect.Map {
+			return fmt.Errorf("option %s only applies to map fields", tags.Trim)
+		}
+		if err = fieldInfo.setTrim(); err != nil {
+			return err
+		}
 	}
 
+	if fieldInfo.policy, err = data.Policy(); err != nil {
+		return err
+	}
+	if collectsValues(field.Type) && field.Type.Elem().Kind() == reflect.Ptr && isEntry(field.Type.Elem().Elem()) {
+		return fmt.Errorf("unsupported slice field type %s, collect entries as []%s", field.Type, field.Type.Elem().Elem())
+	}
+	valueType := dynamicValueType(field.Type)
 	if field.Type.Kind() == reflect.Map {
+		if valueType, err = fieldInfo.setNested(field.Type); err != nil {
+			return err
+		}
+	}
+	if err = fieldInfo.setCapture(valueType); err != nil {
+		return err
+	}
+	scalar := field.Type.Kind() != reflect.Map && !collectsValues(field.Type)
+	for _, opt := range data.Options {
+		if tags.IsPolicy(opt.Name) && !scalar {
+			return fmt.Errorf("option %s only applies to scalar fields", opt.Name)
+		}
+	}
+
+	switch {
+	case field.Type.Kind() == reflect.Map:
+		if err = mapkey.Check(field.Type.Key()); err != nil {
+			return err
+		}
 		info.tagging.dynamicMapFields = append(info.tagging.dynamicMapFields, fieldInfo)
-	} else {
+	case collectsValues(field.Type):
+		fieldInfo.entries = isEntry(field.Type.Elem())
+		info.tagging.dynamicSliceFields = append(info.tagging.dynamicSliceFields, fieldInfo)
+	default:
 		info.tagging.dynamicScalarFields = append(info.tagging.dynamicScalarFields, fieldInfo)
 	}
 
 	return nil
 }
 
+// collectsValues reports whether a jsonpat field of type typ collects the values
+// of every matching key rather than taking a single one. Byte slices, such as
+// json.RawMessage, hold a single json value like other scalar fields.
+func collectsValues(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8
+}
+
+// isEntry reports whether typ is an instance of Entry. Pointers to Entry have its
+// methods too, so only structs are considered.
+func isEntry(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && typ.Implements(entryType)
+}
+
+// newPatternMatcher validates a pattern, compiling regex and glob patterns once.
+func newPatternMatcher(pattern tags.Pattern, fold bool) (m patternMatcher, err error) {
+	m = patternMatcher{value: pattern.Value, loadType: pattern.Matcher}
+
+	switch m.loadType {
+	case regexLoadType:
+		if m.re, err = compilePattern(m.value, fold); err != nil {
+			return m, fmt.Errorf("invalid regex: %w", err)
+		}
+	case globLoadType:
+		regex, err := tags.GlobRegex(m.value)
+		if err != nil {
+			return m, fmt.Errorf("invalid glob: %w", err)
+		}
+		if m.re, err = compilePattern(regex, fold); err != nil {
+			return m, fmt.Errorf("invalid glob: %w", err)
+		}
+	case templateLoadType:
+		template, err := tags.ParseTemplate(m.value)
+		if err != nil {
+			return m, fmt.Errorf("invalid template: %w", err)
+		}
+		m.template = &template
+		if m.re, err = compilePattern(template.Regex(), fold); err != nil {
+			return m, fmt.Errorf("invalid template: %w", err)
+		}
+	case prefixLoadType, containsLoadType, suffixLoadType:
+	default:
+		// the tag parser only accepts built in and registered matchers
+		if fold {
+			return m, fmt.Errorf("option %s can't be used with custom matcher %s", tags.CaseInsensitive, m.loadType)
+		}
+		if m.custom, err = newCustomMatcher(m.loadType, m.value); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// setTrim enables the trim option, checking that every pattern of the field
+// can trim the keys it matches.
+func (fieldInfo *dynamicFieldInfo) setTrim() (err error) {
+	fieldInfo.trim = true
+	for i := range fieldInfo.matchers {
+		m := &fieldInfo.matchers[i]
+
+		var affixes keyAffixes
+		switch m.loadType {
+		case prefixLoadType:
+			affixes.prefix = m.value
+		case suffixLoadType:
+			affixes.suffix = m.value
+		case regexLoadType:
+			if m.keyGroup, err = tags.TrimGroup(m.re); err != nil {
+				return err
+			}
+			var ok bool
+			if affixes.prefix, affixes.suffix, ok = tags.RegexAffixes(m.value, m.keyGroup); !ok {
+				continue
+			}
+		default:
+			return fmt.Errorf("option %s can't be used with %s patterns", tags.Trim, m.loadType)
+		}
+
+		// keys are marshaled through the first pattern they can be rebuilt from
+		if fieldInfo.affixes == nil {
+			fieldInfo.affixes = &affixes
+		}
+	}
+	return nil
+}
+
+// compilePattern compiles a regex, making it case-insensitive when fold is set.
+func compilePattern(pattern string, fold bool) (*regexp.Regexp, error) {
+	if fold {
+		pattern = tags.FoldRegex(pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// analyseRemainingField validates and stores the field collecting unclaimed keys
+func analyseRemainingField(field reflect.StructField, fieldIndex []int, data tags.JsonPat, info *structInfo) error {
+	if len(data.Patterns) > 1 || data.Patterns[0].Value != "" || len(data.Options) > 1 {
+		return fmt.Errorf("tag %s option %s must be used on its own, as \",%s\"", jsonPatTag, tags.Remaining, tags.Remaining)
+	}
+	if info.tagging.remainingField != nil {
+		return fmt.Errorf("only one field may use the %s option", tags.Remaining)
+	}
+
+	typ := field.Type
+	if typ.Kind() != reflect.Map || typ.Key().Kind() != reflect.String ||
+		(typ.Elem() != rawMessageType && !(typ.Elem().Kind() == reflect.Interface && typ.Elem().NumMethod() == 0)) {
+		return fmt.Errorf(
+			"field with the %s option must be a map[string]json.RawMessage or map[string]any, not %s",
+			tags.Remaining,
+			typ,
+		)
+	}
+
+	info.tagging.remainingField = fieldIndex
+	return nil
+}
+
 // analyseJsonTag parses and handles a json field tag
 func analyseJsonTag(field reflect.StructField, fieldIndex []int, info *structInfo) error {
 	if jsonTag, ok := field.Tag.Lookup("json"); ok {
-		jsonName := strings.Split(jsonTag, ",")[0]
-		if jsonName != "-" && jsonName != "" {
-			info.tagging.knownFields[jsonName] = fieldIndex
-		} else if jsonName == "" {
-			info.tagging.knownFields[field.Name] = fieldIndex
+		data := tags.ParseJson(jsonTag)
+		if data.Skip {
+			return nil
+		}
+		tagged := data.Name != ""
+		if !tagged {
+			data.Name = field.Name
 		}
+
+		info.tagging.addKnownField(&knownFieldInfo{
+			name:         data.Name,
+			fieldIndices: fieldIndex,
+			omitEmpty:    data.OmitEmpty,
+			quoted:       data.Quoted && isQuotableType(field.Type),
+			tagged:       tagged,
+		})
 	}
 
 	return nil
 }
 
+// isQuotableType reports whether the `string` json tag option applies to typ,
+// following the same rules as encoding/json.
+func isQuotableType(typ reflect.Type) bool {
+	if typ.Name() == "" && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
 // getStructInfo retrieves cached struct info or analyzes the type if not cached.
+// Types that fail analysis are not cached, and report a *TagError.
 func getStructInfo(typ reflect.Type) (*structInfo, error) {
 	// check if struct info is already cached
 	if v, ok := typeCache.Load(typ); ok {
@@ -128,17 +537,83 @@ func getStructInfo(typ reflect.Type) (*structInfo, error) {
 	// analyse struct since it isn't cached
 	info := &structInfo{
 		tagging: &taggingData{
-			knownFields:         make(map[string][]int),
 			dynamicMapFields:    make([]dynamicFieldInfo, 0),
 			dynamicScalarFields: make([]dynamicFieldInfo, 0),
 		},
 	}
 
-	if err := analyseStruct(typ, info, nil); err != nil {
+	if err := analyseStruct(typ, info, nil, typ); err != nil {
+		return nil, err
+	}
+	if err := checkCapture(typ, info); err != nil {
 		return nil, err
 	}
+	info.tagging.selectKnownFields()
+	info.tagging.indexFoldedKnownFields()
 
 	// protect against race conditions
 	v, _ := typeCache.LoadOrStore(typ, info)
 	return v.(*structInfo), nil
 }
+
+// hasPatterns reports whether typ, or any struct reachable through its fields,
+// pointers, slices, arrays or maps, has jsonpat fields. Types that handle their own
+// json encoding (or decoding, when encode is false) are not inspected, since
+// encoding/json hands them over to their own methods.
+func hasPatterns(typ reflect.Type, encode bool) (bool, error) {
+	key := patternKey{typ: typ, encode: encode}
+	if v, ok := patternCache.Load(key); ok {
+		return v.(bool), nil
+	}
+
+	found, err := findPatterns(typ, encode, make(map[reflect.Type]bool))
+	if err != nil {
+		return false, err
+	}
+
+	patternCache.Store(key, found)
+	return found, nil
+}
+
+// findPatterns walks typ looking for jsonpat fields, using visited to stop at
+// recursive types.
+func findPatterns(typ reflect.Type, encode bool, visited map[reflect.Type]bool) (bool, error) {
+	if visited[typ] || isCustomCodec(typ, encode) {
+		return false, nil
+	}
+	visited[typ] = true
+
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return findPatterns(typ.Elem(), encode, visited)
+	case reflect.Struct:
+		info, err := getStructInfo(typ)
+		if err != nil {
+			return false, err
+		}
+
+		if info.tagging.hasPatterns() {
+			return true, nil
+		}
+
+		for _, known := range info.tagging.knownFieldOrder {
+			found, err := findPatterns(typ.FieldByIndex(known.fieldIndices).Type, encode, visited)
+			if err != nil || found {
+				return found, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// isCustomCodec reports whether typ implements its own json or text encoding
+// (or decoding, when encode is false).
+func isCustomCodec(typ reflect.Type, encode bool) bool {
+	ptr := reflect.PointerTo(typ)
+	if encode {
+		return typ.Implements(jsonMarshalerType) || ptr.Implements(jsonMarshalerType) ||
+			typ.Implements(textMarshalerType) || ptr.Implements(textMarshalerType)
+	}
+	return ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType)
+}
@@ -2,6 +2,8 @@ package jsonpat
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +18,22 @@ type BenchDynamic struct {
 	Dynamic map[string]int `jsonpat:"val_,prefix"`
 }
 
+type BenchMixed struct {
+	Name    string             `json:"name"`
+	ID      int                `json:"id"`
+	Metrics map[string]float64 `jsonpat:"metric_,prefix"`
+	Labels  map[string]string  `jsonpat:"^label_[a-z]+_\\d+$,regex"`
+	Primary string             `jsonpat:"_primary,suffix"`
+}
+
+type BenchNested struct {
+	Items []BenchDynamic `json:"items"`
+}
+
 var (
+	mixedJSON  = buildMixedJSON(50)
+	nestedJSON = buildNestedJSON(10)
+
 	staticJSON = []byte(`{"name": "benchmark", "value": 12345, "description": "testing overhead"}`)
 
 	dynamicJSON = []byte(`{
@@ -26,8 +43,29 @@ var (
 	}`)
 )
 
+// buildMixedJSON builds an object with n metric keys, n label keys, some
+// unmatched keys and a few keys competing for a dynamic scalar field.
+func buildMixedJSON(n int) []byte {
+	var sb strings.Builder
+	sb.WriteString(`{"name": "benchmark", "id": 7, "b_primary": "b", "a_primary": "a"`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, `, "metric_%d": %d.5, "label_host_%d": "h%d", "other_%d": {"skip": [1, 2, 3]}`, i, i, i, i, i)
+	}
+	sb.WriteString("}")
+	return []byte(sb.String())
+}
+
+// buildNestedJSON builds an object holding n copies of dynamicJSON in an array.
+func buildNestedJSON(n int) []byte {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = string(dynamicJSON)
+	}
+	return []byte(`{"items": [` + strings.Join(items, ",") + `]}`)
+}
+
 // BenchmarkOverhead_JsonPat measures the cost of using jsonpat on a regular struct.
-// Expect this to be slower than StdLib due to the intermediate map[string]RawMessage step.
+// Structs without jsonpat fields are delegated to the std lib, so this should match StdLib.
 func BenchmarkOverhead_JsonPat(b *testing.B) {
 	var v BenchStatic
 	b.ReportAllocs()
@@ -71,3 +109,48 @@ func BenchmarkDynamic_MapInterface(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkMixed_JsonPat measures a larger payload combining known fields, prefix
+// and regex map fields, a contested scalar field and unmatched keys.
+func BenchmarkMixed_JsonPat(b *testing.B) {
+	var v BenchMixed
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(mixedJSON, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMixed_MapInterface is the map[string]interface{} baseline for BenchmarkMixed_JsonPat.
+func BenchmarkMixed_MapInterface(b *testing.B) {
+	var v map[string]interface{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := json.Unmarshal(mixedJSON, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNested_JsonPat measures decoding a slice of jsonpat structs nested in a known field.
+func BenchmarkNested_JsonPat(b *testing.B) {
+	var v BenchNested
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(nestedJSON, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNested_MapInterface is the map[string]interface{} baseline for BenchmarkNested_JsonPat.
+func BenchmarkNested_MapInterface(b *testing.B) {
+	var v map[string]interface{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := json.Unmarshal(nestedJSON, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
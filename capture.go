@@ -0,0 +1,185 @@
+package jsonpat
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/jamieyoung5/jsonpat/internal/mapkey"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// captureInfo describes a capture struct: a struct whose fields tagged
+// `jsonpat:"group=<name>"` are filled from the named capture groups of the regex
+// matching a key, and whose Value field holds the json value of the key.
+type captureInfo struct {
+	groups []captureGroup
+	value  []int
+}
+
+// captureGroup is a field of a capture struct filled from a named capture group.
+type captureGroup struct {
+	name         string
+	fieldIndices []int
+}
+
+// analyseGroupField stores a field of a capture struct filled from the named
+// capture group.
+func analyseGroupField(field reflect.StructField, fieldIndex []int, name string, info *structInfo) error {
+	if err := mapkey.Check(field.Type); err != nil {
+		return fmt.Errorf("unsupported %s field type %s", tags.Group, field.Type)
+	}
+
+	if info.tagging.capture == nil {
+		info.tagging.capture = &captureInfo{}
+	}
+	info.tagging.capture.groups = append(info.tagging.capture.groups, captureGroup{name: name, fieldIndices: fieldIndex})
+	return nil
+}
+
+// checkCapture completes the analysis of a capture struct, which must have a
+// Value field and no fields other than its group fields.
+func checkCapture(typ reflect.Type, info *structInfo) error {
+	capture := info.tagging.capture
+	if capture == nil {
+		return nil
+	}
+
+	first := typ.FieldByIndex(capture.groups[0].fieldIndices)
+	value, ok := typ.FieldByName("Value")
+	if !ok || !value.IsExported() || slices.ContainsFunc(capture.groups, func(group captureGroup) bool {
+		return slices.Equal(group.fieldIndices, value.Index)
+	}) {
+		return &TagError{
+			Type:  typ,
+			Field: first.Name,
+			Tag:   first.Tag.Get(jsonPatTag),
+			Err:   fmt.Errorf("a struct with %s fields needs a Value field holding the json value", tags.Group),
+		}
+	}
+	capture.value = value.Index
+
+	for _, known := range info.tagging.knownFieldOrder {
+		if !slices.Equal(known.fieldIndices, value.Index) {
+			return captureFieldError(typ, known.fieldIndices)
+		}
+	}
+	for _, fields := range [][]dynamicFieldInfo{
+		info.tagging.dynamicMapFields, info.tagging.dynamicSliceFields, info.tagging.dynamicScalarFields,
+	} {
+		if len(fields) > 0 {
+			return captureFieldError(typ, fields[0].fieldIndices)
+		}
+	}
+	if info.tagging.remainingField != nil {
+		return captureFieldError(typ, info.tagging.remainingField)
+	}
+	return nil
+}
+
+func captureFieldError(typ reflect.Type, fieldIndices []int) error {
+	field := typ.FieldByIndex(fieldIndices)
+	return &TagError{
+		Type:  typ,
+		Field: field.Name,
+		Tag:   field.Tag.Get(jsonPatTag),
+		Err:   fmt.Errorf("a struct with %s fields can only hold them and a Value field", tags.Group),
+	}
+}
+
+// dynamicValueType returns the type a dynamic field of type typ decodes the
+// values of the keys it claims into.
+func dynamicValueType(typ reflect.Type) reflect.Type {
+	switch {
+	case typ.Kind() == reflect.Map:
+		return typ.Elem()
+	case collectsValues(typ) && isEntry(typ.Elem()):
+		return typ.Elem().Field(1).Type
+	case collectsValues(typ):
+		return typ.Elem()
+	}
+	return typ
+}
+
+// isCaptureStruct reports whether typ is a struct with group fields, without
+// analysing it, since it may be the struct being analysed.
+func isCaptureStruct(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := tags.ParseGroup(typ.Field(i).Tag.Get(jsonPatTag)); ok && typ.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// setCapture makes a dynamic field fill the group fields of its values when they
+// are capture structs, checking that every pattern of the field is a regex or a
+// template, and that each group is found in at least one of them.
+func (fieldInfo *dynamicFieldInfo) setCapture(valueType reflect.Type) error {
+	if valueType.Kind() == reflect.Ptr && isCaptureStruct(valueType.Elem()) {
+		return fmt.Errorf("%s fields of %s can't be filled through a pointer", tags.Group, valueType.Elem())
+	}
+	if !isCaptureStruct(valueType) {
+		return nil
+	}
+
+	info, err := getStructInfo(valueType)
+	if err != nil {
+		return err
+	}
+	fieldInfo.capture = info.tagging.capture
+
+	for i := range fieldInfo.matchers {
+		m := &fieldInfo.matchers[i]
+		if m.loadType != regexLoadType && m.loadType != templateLoadType {
+			return fmt.Errorf("%s fields of %s can only be filled by regex or template patterns, not %s patterns", tags.Group, valueType, m.loadType)
+		}
+
+		m.captures = make([]int, len(fieldInfo.capture.groups))
+		for j, group := range fieldInfo.capture.groups {
+			m.captures[j] = m.re.SubexpIndex(group.name)
+		}
+	}
+
+	for j, group := range fieldInfo.capture.groups {
+		if !slices.ContainsFunc(fieldInfo.matchers, func(m patternMatcher) bool { return m.captures[j] >= 0 }) {
+			return fmt.Errorf("no regex has a group named %q for field %s of %s",
+				group.name, valueType.FieldByIndex(group.fieldIndices).Name, valueType)
+		}
+	}
+	return nil
+}
+
+// captureGroups fills the group fields of v, the capture struct holding the
+// value of key, from the first pattern key matches. Groups that the pattern
+// lacks or that match nothing leave their field as it is.
+func (fieldInfo dynamicFieldInfo) captureGroups(key string, v reflect.Value) error {
+	if fieldInfo.capture == nil {
+		return nil
+	}
+
+	for _, m := range fieldInfo.matchers {
+		submatches := m.re.FindStringSubmatch(key)
+		if submatches == nil {
+			continue
+		}
+
+		for i, group := range fieldInfo.capture.groups {
+			if m.captures[i] < 0 || submatches[m.captures[i]] == "" {
+				continue
+			}
+			field, err := fieldByIndex(v, group.fieldIndices)
+			if err != nil {
+				return fmt.Errorf("failed to capture group %s: %w", group.name, err)
+			}
+			if err := mapkey.Set(field, submatches[m.captures[i]]); err != nil {
+				return fmt.Errorf("failed to capture group %s: %w", group.name, err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
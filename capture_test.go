@@ -0,0 +1,124 @@
+package jsonpat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sample struct {
+	Region string `jsonpat:"group=region"`
+	Metric string `jsonpat:"group=metric"`
+	Value  float64
+}
+
+type shardSample struct {
+	Shard shardID `jsonpat:"group=shard"`
+	Index uint8   `jsonpat:"group=index"`
+	Value []string
+}
+
+func TestUnmarshal_CaptureGroups(t *testing.T) {
+	type Metrics struct {
+		Host    string                 `json:"host"`
+		ByKey   map[string]sample      `jsonpat:"^(?P<region>[a-z]+)_(?P<metric>\\w+)$,regex"`
+		Samples []sample               `jsonpat:"^(?P<region>[a-z]+)_(?P<metric>\\w+)$,regex"`
+		Entries []Entry[sample]        `jsonpat:"^(?P<metric>\\w+)@(?P<region>[a-z]+)$,regex|^(?P<metric>\\w+)$,regex,exclude=host"`
+		Shards  map[string]shardSample `jsonpat:"^shard_(?P<shard>[a-z]+-\\d+)(?:/(?P<index>\\d+))?$,regex"`
+		Latest  sample                 `jsonpat:"^LATEST_(?:(?P<region>[a-z]+)_)?(?P<metric>\\w+)$,regex,ci"`
+	}
+
+	jsonData := []byte(`{
+		"host": "web-1",
+		"eu_cpu": 0.5, "us_mem": 0.25,
+		"cpu@ap": 1, "disk": 2,
+		"shard_eu-3/7": ["a"], "shard_us-1": ["b"],
+		"latest_load": 3
+	}`)
+
+	var result Metrics
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, "web-1", result.Host)
+	assert.Equal(t, map[string]sample{
+		"eu_cpu": {Region: "eu", Metric: "cpu", Value: 0.5},
+		"us_mem": {Region: "us", Metric: "mem", Value: 0.25},
+	}, result.ByKey)
+	assert.Equal(t, []sample{{Region: "eu", Metric: "cpu", Value: 0.5}, {Region: "us", Metric: "mem", Value: 0.25}}, result.Samples)
+	assert.Equal(t, []Entry[sample]{
+		{Key: "eu_cpu", Value: sample{Metric: "eu_cpu", Value: 0.5}},
+		{Key: "us_mem", Value: sample{Metric: "us_mem", Value: 0.25}},
+		{Key: "cpu@ap", Value: sample{Region: "ap", Metric: "cpu", Value: 1}},
+		{Key: "disk", Value: sample{Metric: "disk", Value: 2}},
+	}, result.Entries, "Groups should come from the first matching pattern, and missing groups be left empty")
+	assert.Equal(t, map[string]shardSample{
+		"shard_eu-3/7": {Shard: shardID{region: "eu", n: 3}, Index: 7, Value: []string{"a"}},
+		"shard_us-1":   {Shard: shardID{region: "us", n: 1}, Value: []string{"b"}},
+	}, result.Shards)
+	assert.Equal(t, sample{Metric: "load", Value: 3}, result.Latest)
+
+	err := Unmarshal([]byte(`{"shard_eu-1/300": []}`), &result)
+	assert.ErrorContains(t, err, `failed to capture group index: invalid map key "300" for type uint8`)
+
+	data, err := Marshal(Metrics{ByKey: map[string]sample{"eu_cpu": {Region: "ignored", Value: 0.5}}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"host":"","eu_cpu":0.5}`, string(data), "Capture structs should be written as their Value")
+}
+
+func TestUnmarshal_CaptureGroupErrors(t *testing.T) {
+	var tagErr *TagError
+
+	type NotRegex struct {
+		Dynamic map[string]sample `jsonpat:"x_,prefix"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &NotRegex{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "can only be filled by regex or template patterns, not prefix patterns")
+
+	type MissingGroup struct {
+		Dynamic []sample `jsonpat:"^(?P<region>[a-z]+)_\\w+$,regex|^(?P<region>[a-z]+)$,regex"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &MissingGroup{}), &tagErr)
+	assert.ErrorContains(t, tagErr, `no regex has a group named "metric" for field Metric`)
+
+	type Pointers struct {
+		Dynamic map[string]*sample `jsonpat:"^(?P<region>[a-z]+)_(?P<metric>\\w+)$,regex"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &Pointers{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "can't be filled through a pointer")
+
+	type NoValue struct {
+		Region string `jsonpat:"group=region"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &NoValue{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "needs a Value field")
+
+	type ExtraField struct {
+		Region string `jsonpat:"group=region"`
+		Name   string `json:"name"`
+		Value  int
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &ExtraField{}), &tagErr)
+	assert.Equal(t, "Name", tagErr.Field)
+	assert.ErrorContains(t, tagErr, "can only hold them and a Value field")
+
+	type BadGroupType struct {
+		Ratio float64 `jsonpat:"group=ratio"`
+		Value int
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &BadGroupType{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "unsupported group field type float64")
+
+}
+
+func TestUnmarshal_GroupPrefixPattern(t *testing.T) {
+	type Prefixed struct {
+		Groups map[string]int `jsonpat:"group=,prefix"`
+		Value  int            `jsonpat:"group=x_,prefix"`
+	}
+
+	var result Prefixed
+	require.NoError(t, Unmarshal([]byte(`{"group=a": 1, "group=x_b": 2}`), &result),
+		"Tags that aren't just group=<name> should still be patterns")
+	assert.Equal(t, map[string]int{"group=a": 1}, result.Groups)
+	assert.Equal(t, 2, result.Value)
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// knownField is a field addressed by an exact json key. tagged is set when the
+// key was given by a json tag.
+type knownField struct {
+	name      string
+	path      string
+	omitEmpty bool
+	quoted    bool
+	tagged    bool
+	typ       resolved
+}
+
+// dynamicField is a field filled from the keys matching its jsonpat tag.
+type dynamicField struct {
+	path     string
+	name     string
+	patterns []*pattern
+	typ      resolved
+	// fold makes the matchers and excludes case-insensitive
+	fold bool
+
+	// excludes are the regex sources of the exclude globs, and excludeVars the
+	// names of the variables holding them compiled in the generated code
+	excludes    []string
+	excludeVars []string
+
+	// trim stores map keys without the part matched by the pattern, and affixes
+	// are the prefix and suffix to rebuild them with, nil if no pattern allows it
+	trim    bool
+	affixes *[2]string
+	// entries is set for slice fields of jsonpat.Entry values, which keep the keys
+	entries bool
+	// policy chooses which of several matching keys a scalar field takes
+	policy string
+	// nested is the number of levels of maps a map field with template patterns
+	// stores its values in, 0 for other fields
+	nested int
+	// captures are the group fields of the capture struct the field decodes its
+	// values into, named captureType, nil if they aren't capture structs
+	captures    []*groupField
+	captureType string
+}
+
+// pattern is one of the alternative patterns of a dynamic field.
+type pattern struct {
+	value   string
+	matcher string
+
+	// regex is the regex source of regex, glob and template matchers, and
+	// regexVar the name of the variable holding it compiled in the generated code
+	regex    string
+	regexVar string
+	// template is the parsed form of template patterns
+	template *tags.KeyTemplate
+	// keyGroup is the capture group of regex holding the key kept by the trim
+	// option
+	keyGroup int
+	// groups are the indices in regex of the capture groups filling the group
+	// fields of the field's values, -1 for those it lacks
+	groups []int
+}
+
+// structData is the analysis of a struct, mirroring the taggingData built by
+// the reflective decoder.
+type structData struct {
+	name      string
+	known     []*knownField
+	maps      []*dynamicField
+	slices    []*dynamicField
+	scalars   []*dynamicField
+	remaining *dynamicField
+	// groups are the group fields of a capture struct
+	groups []*groupField
+}
+
+// hasPatterns reports whether any field relies on jsonpat tags.
+func (s *structData) hasPatterns() bool {
+	return len(s.maps) > 0 || len(s.slices) > 0 || len(s.scalars) > 0 || s.remaining != nil || len(s.groups) > 0
+}
+
+// addKnown registers a candidate known field. Candidates sharing a json key are
+// settled by selectKnown once the struct has been analysed.
+func (s *structData) addKnown(field *knownField) {
+	s.known = append(s.known, field)
+}
+
+// selectKnown settles the candidates sharing a json key like the reflective
+// decoder: the least nested field wins, then the only one tagged with the key,
+// and otherwise none of them is kept.
+func (s *structData) selectKnown() {
+	candidates := make(map[string][]*knownField, len(s.known))
+	for _, field := range s.known {
+		candidates[field.name] = append(candidates[field.name], field)
+	}
+	s.known = slices.DeleteFunc(s.known, func(field *knownField) bool {
+		return dominantField(candidates[field.name]) != field
+	})
+}
+
+// dominantField returns the field that wins among candidates sharing a json
+// key, or nil when none does.
+func dominantField(candidates []*knownField) *knownField {
+	var dominant *knownField
+	depth, count, tagged := 0, 0, 0
+	for _, field := range candidates {
+		fieldDepth := strings.Count(field.path, ".")
+		switch {
+		case dominant == nil || fieldDepth < depth:
+			dominant, depth, count, tagged = field, fieldDepth, 1, 0
+		case fieldDepth == depth:
+			count++
+		default:
+			continue
+		}
+		if field.tagged {
+			tagged++
+			if tagged == 1 {
+				dominant = field
+			}
+		}
+	}
+
+	if count > 1 && tagged != 1 {
+		return nil
+	}
+	return dominant
+}
+
+// analyse analyses a struct declared in the package the same way the
+// reflective decoder analyses its type.
+func (p *pkg) analyse(decl *typeDecl) (*structData, error) {
+	if decl.spec.TypeParams != nil {
+		return nil, fmt.Errorf("type %s: generic types are not supported", decl.spec.Name.Name)
+	}
+
+	typ := p.resolve(decl.spec.Type, decl.file)
+	if typ.kind != structKind {
+		return nil, fmt.Errorf("type %s is not a struct", decl.spec.Name.Name)
+	}
+
+	data := &structData{name: decl.spec.Name.Name}
+	if err := p.analyseStruct(decl.spec.Name.Name, typ, "", data); err != nil {
+		return nil, err
+	}
+	data.selectKnown()
+	if err := data.checkCapture(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// analyseStruct analyses the fields of a struct, flattening embedded structs
+// into data. basePath is the selector of the struct within the analysed type.
+func (p *pkg) analyseStruct(typeName string, typ resolved, basePath string, data *structData) error {
+	for _, field := range typ.structType.Fields.List {
+		names := fieldNames(field)
+		if names == nil {
+			return fmt.Errorf("type %s: unsupported embedded field %s", typeName, exprString(field.Type))
+		}
+
+		for _, name := range names {
+			path := name
+			if basePath != "" {
+				path = basePath + "." + name
+			}
+			fieldType := p.resolve(field.Type, typ.file)
+			tag := structTag(field)
+
+			// support embedded structs, promoting their fields the way
+			// encoding/json does, through unexported struct types
+			if promotes(field) {
+				embedded := fieldType
+				if fieldType.kind == pointerKind {
+					embedded = p.resolve(fieldType.elem, fieldType.file)
+				}
+
+				switch {
+				case embedded.kind == unknownKind:
+					return fmt.Errorf(
+						"type %s: embedded type %s can't be resolved; only structs declared in package %s can be embedded",
+						typeName,
+						exprString(field.Type),
+						p.name,
+					)
+				case embedded.kind == structKind && fieldType.kind == pointerKind:
+					return fmt.Errorf(
+						"type %s: embedded pointer %s is not supported, as decoding its fields would allocate it; embed %s by value",
+						typeName,
+						exprString(field.Type),
+						exprString(fieldType.elem),
+					)
+				case embedded.kind == structKind:
+					if err := p.analyseStruct(name, embedded, path, data); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			if !ast.IsExported(name) {
+				continue // skip unexported field
+			}
+
+			if err := p.analyseField(name, path, field.Type, typ.file, tag, data); err != nil {
+				return fmt.Errorf("invalid tag %q on field %s.%s: %w", tag.Get(tags.Name), typeName, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// analyseField routes the analysis of a fields tag. expr is the type of the
+// field, declared in f.
+func (p *pkg) analyseField(name, path string, expr ast.Expr, f *file, tag reflect.StructTag, data *structData) error {
+	typ := p.resolve(expr, f)
+	if value, ok := tag.Lookup(tags.Name); ok {
+		if group, ok := tags.ParseGroup(value); ok {
+			return p.analyseGroupField(path, group, expr, f, data)
+		}
+		return p.analyseJsonPatTag(name, path, expr, f, typ, value, data)
+	}
+
+	known := &knownField{name: name, path: path, typ: typ}
+	if value, ok := tag.Lookup("json"); ok {
+		jsonData := tags.ParseJson(value)
+		if jsonData.Skip {
+			return nil
+		} else if jsonData.Name != "" {
+			known.name = jsonData.Name
+			known.tagged = true
+		}
+
+		known.omitEmpty = jsonData.OmitEmpty
+		if jsonData.Quoted {
+			quotable, err := p.isQuotable(typ)
+			if err != nil {
+				return err
+			}
+			known.quoted = quotable
+		}
+	}
+
+	data.addKnown(known)
+	return nil
+}
+
+// analyseJsonPatTag parses and stores a jsonpat tags info
+func (p *pkg) analyseJsonPatTag(name, path string, expr ast.Expr, f *file, typ resolved, value string, data *structData) error {
+	tagData, err := tags.ParseJsonPat(value)
+	if err != nil {
+		return err
+	}
+
+	field := &dynamicField{path: path, name: name, typ: typ, fold: tagData.HasOption(tags.CaseInsensitive)}
+	if tagData.HasOption(tags.Remaining) {
+		return p.analyseRemaining(field, tagData, data)
+	}
+
+	for _, tagPattern := range tagData.Patterns {
+		pat, err := analysePattern(tagPattern)
+		if err != nil {
+			return err
+		}
+		field.patterns = append(field.patterns, pat)
+	}
+	for _, exclude := range tagData.OptionArgs(tags.Exclude) {
+		regex, err := tags.GlobRegex(exclude)
+		if err != nil {
+			return fmt.Errorf("invalid exclude glob: %w", err)
+		}
+		if _, err = regexp.Compile(regex); err != nil {
+			return fmt.Errorf("invalid exclude glob: %w", err)
+		}
+		field.excludes = append(field.excludes, regex)
+	}
+	if tagData.HasOption(tags.Trim) {
+		if typ.kind != mapKind {
+			return fmt.Errorf("option %s only applies to map fields", tags.Trim)
+		}
+		if err = field.setTrim(); err != nil {
+			return err
+		}
+	}
+
+	valueExpr, valueFile := p.valueExpr(expr, f, typ)
+	if typ.kind == mapKind {
+		if valueExpr, valueFile, err = p.setNested(field, typ); err != nil {
+			return err
+		}
+	}
+	if err = p.setCapture(field, valueExpr, valueFile); err != nil {
+		return err
+	}
+
+	if field.policy, err = tagData.Policy(); err != nil {
+		return err
+	}
+	scalar := typ.kind != mapKind && !p.collectsValues(typ)
+	for _, opt := range tagData.Options {
+		if tags.IsPolicy(opt.Name) && !scalar {
+			return fmt.Errorf("option %s only applies to scalar fields", opt.Name)
+		}
+	}
+
+	switch typ.kind {
+	case unknownKind:
+		return fmt.Errorf("the type of field %s can't be resolved", name)
+	case mapKind:
+		if !p.mapKeyType(typ.key, typ.file) {
+			return fmt.Errorf("unsupported map key type %s", exprString(typ.key))
+		}
+		data.maps = append(data.maps, field)
+	case sliceKind:
+		if !p.collectsValues(typ) {
+			data.scalars = append(data.scalars, field)
+			break
+		}
+		if star, ok := typ.elem.(*ast.StarExpr); ok && isEntry(star.X, typ.file) {
+			return fmt.Errorf("unsupported slice field type %s, collect entries as []%s", exprString(expr), exprString(star.X))
+		}
+		field.entries = isEntry(typ.elem, typ.file)
+		data.slices = append(data.slices, field)
+	default:
+		data.scalars = append(data.scalars, field)
+	}
+
+	return nil
+}
+
+// collectsValues reports whether a jsonpat field of type typ collects the values
+// of every matching key rather than taking a single one. Byte slices, such as
+// json.RawMessage, hold a single json value like other scalar fields.
+func (p *pkg) collectsValues(typ resolved) bool {
+	return typ.kind == sliceKind && !typ.rawMessage && !p.resolve(typ.elem, typ.file).byteSized
+}
+
+// isEntry reports whether expr, declared in f, is an instance of jsonpat.Entry.
+func isEntry(expr ast.Expr, f *file) bool {
+	index, ok := expr.(*ast.IndexExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := index.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && f.imports[x.Name] == libraryPath && sel.Sel.Name == "Entry"
+}
+
+// mapKeyType reports whether json keys can be decoded into map keys of type
+// expr, declared in f: strings, integers, and types with an UnmarshalText
+// method. Types declared in other packages can't be checked, and are left to
+// jsonpatrt to check when decoding.
+func (p *pkg) mapKeyType(expr ast.Expr, f *file) bool {
+	if ident, ok := expr.(*ast.Ident); ok && p.methods[ident.Name]["UnmarshalText"] {
+		return true
+	}
+
+	key := p.resolve(expr, f)
+	switch key.kind {
+	case stringKind:
+		return true
+	case numberKind:
+		return key.integer
+	case unknownKind:
+		_, external := expr.(*ast.SelectorExpr)
+		return external
+	}
+	return false
+}
+
+// excluded reports whether key matches any of the excludes of field.
+func (field *dynamicField) excluded(key string) bool {
+	for _, exclude := range field.excludes {
+		if field.fold {
+			exclude = tags.FoldRegex(exclude)
+		}
+		if regexp.MustCompile(exclude).MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// setTrim enables the trim option, mirroring the reflective decoder.
+func (field *dynamicField) setTrim() (err error) {
+	field.trim = true
+	for _, pat := range field.patterns {
+		var affixes [2]string
+		switch pat.matcher {
+		case tags.Prefix:
+			affixes[0] = pat.value
+		case tags.Suffix:
+			affixes[1] = pat.value
+		case tags.Regex:
+			if pat.keyGroup, err = tags.TrimGroup(regexp.MustCompile(pat.regex)); err != nil {
+				return err
+			}
+			var ok bool
+			if affixes[0], affixes[1], ok = tags.RegexAffixes(pat.regex, pat.keyGroup); !ok {
+				continue
+			}
+		default:
+			return fmt.Errorf("option %s can't be used with %s patterns", tags.Trim, pat.matcher)
+		}
+
+		if field.affixes == nil {
+			field.affixes = &affixes
+		}
+	}
+	return nil
+}
+
+// analysePattern validates a pattern, translating globs to regexes.
+func analysePattern(tagPattern tags.Pattern) (pat *pattern, err error) {
+	pat = &pattern{value: tagPattern.Value, matcher: tagPattern.Matcher}
+
+	switch pat.matcher {
+	case tags.Regex:
+		if _, err = regexp.Compile(pat.value); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		pat.regex = pat.value
+	case tags.Glob:
+		if pat.regex, err = tags.GlobRegex(pat.value); err != nil {
+			return nil, fmt.Errorf("invalid glob: %w", err)
+		}
+		if _, err = regexp.Compile(pat.regex); err != nil {
+			return nil, fmt.Errorf("invalid glob: %w", err)
+		}
+	case tags.Template:
+		template, err := tags.ParseTemplate(pat.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		pat.template = &template
+		pat.regex = template.Regex()
+	}
+	return pat, nil
+}
+
+// analyseRemaining validates and stores the field collecting unclaimed keys
+func (p *pkg) analyseRemaining(field *dynamicField, tagData tags.JsonPat, data *structData) error {
+	if len(tagData.Patterns) > 1 || tagData.Patterns[0].Value != "" || len(tagData.Options) > 1 {
+		return fmt.Errorf("tag %s option %s must be used on its own, as \",%s\"", tags.Name, tags.Remaining, tags.Remaining)
+	}
+	if data.remaining != nil {
+		return fmt.Errorf("only one field may use the %s option", tags.Remaining)
+	}
+
+	typ := field.typ
+	if typ.kind != mapKind || p.resolve(typ.key, typ.file).kind != stringKind {
+		return fmt.Errorf("field with the %s option must be a map[string]json.RawMessage or map[string]any", tags.Remaining)
+	}
+	elem := p.resolve(typ.elem, typ.file)
+	if !elem.rawMessage && !(elem.kind == interfaceKind && elem.empty) {
+		return fmt.Errorf("field with the %s option must be a map[string]json.RawMessage or map[string]any", tags.Remaining)
+	}
+
+	data.remaining = field
+	return nil
+}
+
+// isQuotable reports whether the `string` json tag option applies to typ,
+// following the same rules as encoding/json.
+func (p *pkg) isQuotable(typ resolved) (bool, error) {
+	if !typ.named && typ.kind == pointerKind {
+		typ = p.resolve(typ.elem, typ.file)
+	}
+
+	switch typ.kind {
+	case unknownKind:
+		return false, fmt.Errorf("can't resolve whether the string option applies to the field's type")
+	case stringKind, boolKind, numberKind:
+		return true, nil
+	}
+	return false, nil
+}
+
+// hasJsonPatTag reports whether a struct, or any struct it embeds, has a field
+// with a jsonpat tag.
+func (p *pkg) hasJsonPatTag(typ resolved, depth int) bool {
+	if typ.kind != structKind || depth > maxResolveDepth {
+		return false
+	}
+
+	for _, field := range typ.structType.Fields.List {
+		if field.Tag != nil {
+			value, _ := strconv.Unquote(field.Tag.Value)
+			if _, ok := reflect.StructTag(value).Lookup(tags.Name); ok {
+				return true
+			}
+		}
+		if promotes(field) && p.hasJsonPatTag(p.resolve(field.Type, typ.file), depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedTypes returns the names of the package's types that are embedded by
+// value in one of its structs, with their fields promoted.
+func (p *pkg) embeddedTypes() map[string]bool {
+	embedded := make(map[string]bool)
+	for _, decl := range p.decls {
+		st, ok := decl.spec.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		for _, field := range st.Fields.List {
+			if ident, ok := field.Type.(*ast.Ident); ok && promotes(field) {
+				embedded[ident.Name] = true
+			}
+		}
+	}
+	return embedded
+}
+
+// structTag returns the tag of a field.
+func structTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+	value, _ := strconv.Unquote(field.Tag.Value)
+	return reflect.StructTag(value)
+}
+
+// promotes reports whether a field is an embedded field whose fields would be
+// promoted if it's a struct: one that isn't named by a json tag, skipped by
+// `json:"-"` or tagged with jsonpat.
+func promotes(field *ast.Field) bool {
+	if field.Names != nil {
+		return false
+	}
+	tag := structTag(field)
+	jsonData := tags.ParseJson(tag.Get("json"))
+	_, hasJsonPat := tag.Lookup(tags.Name)
+	return !jsonData.Skip && jsonData.Name == "" && !hasJsonPat
+}
+
+// fieldNames returns the names of a field, or the implicit name of an embedded
+// field. It returns nil for embedded fields it can't name.
+func fieldNames(field *ast.Field) []string {
+	if field.Names != nil {
+		names := make([]string, len(field.Names))
+		for i, name := range field.Names {
+			names[i] = name.Name
+		}
+		return names
+	}
+
+	typ := field.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return []string{t.Name}
+	case *ast.SelectorExpr:
+		return []string{t.Sel.Name}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// groupField is a field of a capture struct filled from the named capture group
+// of the regex matching the key holding the struct.
+type groupField struct {
+	name string
+	path string
+}
+
+// analyseGroupField stores a field of a capture struct filled from the named
+// capture group. expr is the type of the field, declared in f.
+func (p *pkg) analyseGroupField(path, group string, expr ast.Expr, f *file, data *structData) error {
+	if !p.mapKeyType(expr, f) {
+		return fmt.Errorf("unsupported %s field type %s", tags.Group, exprString(expr))
+	}
+
+	data.groups = append(data.groups, &groupField{name: group, path: path})
+	return nil
+}
+
+// checkCapture completes the analysis of a capture struct, which must have a
+// Value field and no fields other than its group fields.
+func (s *structData) checkCapture() error {
+	if len(s.groups) == 0 {
+		return nil
+	}
+
+	if !slices.ContainsFunc(s.known, func(field *knownField) bool { return field.path == "Value" }) {
+		return fmt.Errorf("type %s: a struct with %s fields needs a Value field holding the json value", s.name, tags.Group)
+	}
+
+	var other string
+	for _, field := range s.known {
+		if field.path != "Value" {
+			other = field.path
+			break
+		}
+	}
+	for _, fields := range [][]*dynamicField{s.maps, s.slices, s.scalars, {s.remaining}} {
+		if other == "" && len(fields) > 0 && fields[0] != nil {
+			other = fields[0].path
+		}
+	}
+	if other != "" {
+		return fmt.Errorf("type %s: a struct with %s fields can only hold them and a Value field, not %s", s.name, tags.Group, other)
+	}
+	return nil
+}
+
+// valueExpr returns the type a dynamic field of type expr, resolved as typ and
+// declared in f, decodes the values of the keys it claims into, along with the
+// file declaring it.
+func (p *pkg) valueExpr(expr ast.Expr, f *file, typ resolved) (ast.Expr, *file) {
+	switch {
+	case typ.kind == mapKind:
+		return typ.elem, typ.file
+	case p.collectsValues(typ) && isEntry(typ.elem, typ.file):
+		return typ.elem.(*ast.IndexExpr).Index, typ.file
+	case p.collectsValues(typ):
+		return typ.elem, typ.file
+	}
+	return expr, f
+}
+
+// captureGroups returns the group fields of the struct expr resolves to, nil if
+// it isn't a capture struct.
+func (p *pkg) captureGroups(expr ast.Expr, f *file) []*groupField {
+	typ := p.resolve(expr, f)
+	if typ.kind != structKind {
+		return nil
+	}
+
+	var groups []*groupField
+	for _, field := range typ.structType.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		value, _ := strconv.Unquote(field.Tag.Value)
+		group, ok := tags.ParseGroup(reflect.StructTag(value).Get(tags.Name))
+		if !ok {
+			continue
+		}
+		for _, name := range field.Names {
+			if ast.IsExported(name.Name) {
+				groups = append(groups, &groupField{name: group, path: name.Name})
+			}
+		}
+	}
+	return groups
+}
+
+// setCapture makes a dynamic field fill the group fields of its values when
+// they are capture structs, mirroring the reflective decoder. expr is the type
+// of the values, declared in f.
+func (p *pkg) setCapture(field *dynamicField, expr ast.Expr, f *file) error {
+	if star, ok := expr.(*ast.StarExpr); ok && p.captureGroups(star.X, f) != nil {
+		return fmt.Errorf("%s fields of %s can't be filled through a pointer", tags.Group, exprString(star.X))
+	}
+	groups := p.captureGroups(expr, f)
+	if groups == nil {
+		return nil
+	}
+	if ident, ok := expr.(*ast.Ident); !ok || p.types[ident.Name] == nil {
+		return fmt.Errorf("%s fields of %s can only be filled for types declared in package %s", tags.Group, exprString(expr), p.name)
+	}
+	field.captures = groups
+	field.captureType = exprString(expr)
+
+	for _, pat := range field.patterns {
+		if pat.matcher != tags.Regex && pat.matcher != tags.Template {
+			return fmt.Errorf("%s fields of %s can only be filled by regex or template patterns, not %s patterns", tags.Group, field.captureType, pat.matcher)
+		}
+
+		re := regexp.MustCompile(pat.regex)
+		pat.groups = make([]int, len(groups))
+		for i, group := range groups {
+			pat.groups[i] = re.SubexpIndex(group.name)
+		}
+	}
+
+	for i, group := range groups {
+		if !slices.ContainsFunc(field.patterns, func(pat *pattern) bool { return pat.groups[i] >= 0 }) {
+			return fmt.Errorf("no regex has a group named %q for field %s of %s", group.name, group.path, field.captureType)
+		}
+	}
+	return nil
+}
+
+// captureFuncName returns the name of the function filling the group fields of
+// the values of a field.
+func captureFuncName(data *structData, field *dynamicField) string {
+	return "jsonpat" + data.name + strings.ReplaceAll(field.path, ".", "") + "Groups"
+}
+
+// generateCaptureFunc generates the function filling the group fields of a
+// value of a field from the key holding it, using the first pattern the key
+// matches.
+func (g *generator) generateCaptureFunc(data *structData, field *dynamicField) {
+	g.printf("// %s fills the group fields of v from the key x.%s holds it under.\n", captureFuncName(data, field), field.path)
+	g.printf("func %s(key string, v *%s) error {\n", captureFuncName(data, field), field.captureType)
+	for _, pat := range field.patterns {
+		g.printf("if groups := %s.FindStringSubmatch(key); groups != nil {\n", pat.regexVar)
+		for i, group := range field.captures {
+			if pat.groups[i] < 0 {
+				continue
+			}
+			g.printf("if groups[%d] != \"\" {\n", pat.groups[i])
+			g.printf("if err := jsonpatrt.SetGroup(&v.%s, groups[%d]); err != nil {\n", group.path, pat.groups[i])
+			g.imports["fmt"] = true
+			g.printf("return fmt.Errorf(%s, err)\n}\n}\n", strconv.Quote("failed to capture group "+group.name+": %w"))
+		}
+		g.printf("return nil\n}\n")
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+// generateCaptureMethods generates the methods of a capture struct, which
+// encode and decode its Value field, its group fields being filled by the
+// field holding it.
+func (g *generator) generateCaptureMethods(data *structData) {
+	g.imports["encoding/json"] = true
+	g.printf("// UnmarshalJSON implements json.Unmarshaler, decoding a json value into the\n")
+	g.printf("// Value field of x. Its group fields are filled by the field holding x.\n")
+	g.printf("func (x *%s) UnmarshalJSON(data []byte) error {\n", data.name)
+	g.printf("return json.Unmarshal(data, &x.Value)\n}\n\n")
+
+	g.printf("// MarshalJSON implements json.Marshaler, encoding the Value field of x.\n")
+	g.printf("func (x %s) MarshalJSON() ([]byte, error) {\n", data.name)
+	g.printf("return json.Marshal(&x.Value)\n}\n\n")
+}
@@ -0,0 +1,693 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/types"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+const (
+	libraryPath = "github.com/jamieyoung5/jsonpat"
+	runtimePath = libraryPath + "/jsonpatrt"
+)
+
+// generator writes the methods of the analysed structs into a single file.
+type generator struct {
+	pkg     *pkg
+	body    bytes.Buffer
+	imports map[string]bool
+}
+
+// generate analyses the named types of the package in dir, or every struct with
+// jsonpat fields that isn't embedded in another struct when no names are given,
+// and returns the formatted source of their methods.
+func generate(dir string, typeNames []string, output string) ([]byte, error) {
+	p, err := loadPackage(dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	decls, err := p.selectTypes(typeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{pkg: p, imports: map[string]bool{runtimePath: true}}
+	for _, decl := range decls {
+		data, err := p.analyse(decl)
+		if err != nil {
+			return nil, err
+		}
+		if !data.hasPatterns() {
+			return nil, fmt.Errorf("type %s has no jsonpat fields", data.name)
+		}
+		g.generateStruct(data)
+	}
+	if err = p.checkNested(decls); err != nil {
+		return nil, err
+	}
+
+	return g.source()
+}
+
+// selectTypes returns the declarations of the named types, or the default set
+// of types when no names are given.
+func (p *pkg) selectTypes(typeNames []string) ([]*typeDecl, error) {
+	if len(typeNames) > 0 {
+		decls := make([]*typeDecl, 0, len(typeNames))
+		for _, name := range typeNames {
+			decl, ok := p.types[name]
+			if !ok {
+				return nil, fmt.Errorf("type %s not found in package %s", name, p.name)
+			}
+			decls = append(decls, decl)
+		}
+		return decls, nil
+	}
+
+	// types embedded by value in other structs are left out, as their methods
+	// would be promoted to the embedding struct and take over its encoding
+	embedded := p.embeddedTypes()
+	var decls []*typeDecl
+	for _, decl := range p.decls {
+		if embedded[decl.spec.Name.Name] || decl.spec.TypeParams != nil {
+			continue
+		}
+		if p.hasJsonPatTag(p.resolve(decl.spec.Type, decl.file), 0) {
+			decls = append(decls, decl)
+		}
+	}
+	if len(decls) == 0 {
+		return nil, fmt.Errorf("no structs with jsonpat fields found in package %s", p.name)
+	}
+	return decls, nil
+}
+
+// checkNested makes sure that the structs of the package with jsonpat fields
+// that the generated types hold are generated too. encoding/json would decode
+// them without their patterns otherwise, where jsonpat.Unmarshal applies them.
+func (p *pkg) checkNested(decls []*typeDecl) error {
+	generated := make(map[string]bool, len(decls))
+	for _, decl := range decls {
+		generated[decl.spec.Name.Name] = true
+	}
+
+	visited := make(map[string]bool)
+	for _, decl := range decls {
+		typ := p.resolve(decl.spec.Type, decl.file)
+		if err := p.checkNestedFields(decl.spec.Name.Name, typ, generated, visited, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNestedFields checks the types of the fields of the struct typ, named
+// owner, that encoding/json decodes, along with those of its embedded structs.
+func (p *pkg) checkNestedFields(owner string, typ resolved, generated, visited map[string]bool, depth int) error {
+	if typ.kind != structKind || depth > maxResolveDepth {
+		return nil
+	}
+
+	for _, field := range typ.structType.Fields.List {
+		if tags.ParseJson(structTag(field).Get("json")).Skip {
+			continue
+		}
+		if promotes(field) {
+			embedded := field.Type
+			if star, ok := embedded.(*ast.StarExpr); ok {
+				embedded = star.X
+			}
+			if err := p.checkNestedFields(owner, p.resolve(embedded, typ.file), generated, visited, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, name := range fieldNames(field) {
+			if !ast.IsExported(name) {
+				continue
+			}
+			if err := p.checkNestedType(owner+"."+name, field.Type, typ.file, generated, visited, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkNestedType reports an error if values of type expr, declared in f and
+// held by field, reach a struct of the package with jsonpat fields that isn't
+// generated and doesn't decode itself.
+func (p *pkg) checkNestedType(field string, expr ast.Expr, f *file, generated, visited map[string]bool, depth int) error {
+	if depth > maxResolveDepth {
+		return nil
+	}
+	if index, ok := expr.(*ast.IndexExpr); ok {
+		return p.checkNestedType(field, index.Index, f, generated, visited, depth+1)
+	}
+
+	if ident, ok := expr.(*ast.Ident); ok && p.types[ident.Name] != nil {
+		name := ident.Name
+		methods := p.methods[name]
+		if generated[name] || visited[name] || methods["UnmarshalJSON"] || methods["UnmarshalText"] {
+			return nil
+		}
+		visited[name] = true
+		decl := p.types[name]
+		if p.hasJsonPatTag(p.resolve(decl.spec.Type, decl.file), 0) {
+			return fmt.Errorf("%s has jsonpat fields but is not generated, so field %s would be decoded without them", name, field)
+		}
+	}
+
+	typ := p.resolve(expr, f)
+	switch typ.kind {
+	case pointerKind, sliceKind, arrayKind, mapKind:
+		return p.checkNestedType(field, typ.elem, typ.file, generated, visited, depth+1)
+	case structKind:
+		return p.checkNestedFields(field, typ, generated, visited, depth+1)
+	}
+	return nil
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+func (g *generator) generateStruct(data *structData) {
+	if len(data.groups) > 0 {
+		g.generateCaptureMethods(data)
+		return
+	}
+
+	for _, field := range append(append(slices.Clone(data.scalars), data.maps...), data.slices...) {
+		for i, pat := range field.patterns {
+			if pat.regex == "" {
+				continue
+			}
+
+			pat.regexVar = "jsonpat" + data.name + strings.ReplaceAll(field.path, ".", "") + "Re"
+			if len(field.patterns) > 1 {
+				pat.regexVar += strconv.Itoa(i)
+			}
+			regex := pat.regex
+			if field.fold {
+				regex = tags.FoldRegex(regex)
+			}
+			g.imports["regexp"] = true
+			g.printf("var %s = regexp.MustCompile(%s)\n\n", pat.regexVar, quoteRegex(regex))
+		}
+
+		for i, exclude := range field.excludes {
+			excludeVar := "jsonpat" + data.name + strings.ReplaceAll(field.path, ".", "") + "Exclude"
+			if len(field.excludes) > 1 {
+				excludeVar += strconv.Itoa(i)
+			}
+			if field.fold {
+				exclude = tags.FoldRegex(exclude)
+			}
+			g.imports["regexp"] = true
+			g.printf("var %s = regexp.MustCompile(%s)\n\n", excludeVar, quoteRegex(exclude))
+			field.excludeVars = append(field.excludeVars, excludeVar)
+		}
+	}
+	if len(data.known) > 0 {
+		names := make([]string, len(data.known))
+		for i, field := range data.known {
+			names[i] = strconv.Quote(field.name)
+		}
+		g.printf("var jsonpat%sKnown = jsonpatrt.NewKnownKeys(%s)\n\n", data.name, strings.Join(names, ", "))
+	}
+	for _, field := range data.maps {
+		if field.trim {
+			g.generateKeyFunc(data, field)
+		}
+	}
+	for _, field := range append(append(slices.Clone(data.scalars), data.maps...), data.slices...) {
+		if field.captures != nil {
+			g.generateCaptureFunc(data, field)
+		}
+	}
+
+	g.generateUnmarshal(data, g.matchExpr)
+	g.generateMarshal(data)
+}
+
+// keyFuncName returns the name of the function trimming the keys of a field.
+func keyFuncName(data *structData, field *dynamicField) string {
+	return "jsonpat" + data.name + strings.ReplaceAll(field.path, ".", "") + "Key"
+}
+
+// generateKeyFunc generates the function returning the key a field with the
+// trim option stores the value of a json key it claims under.
+func (g *generator) generateKeyFunc(data *structData, field *dynamicField) {
+	g.printf("// %s returns the key x.%s stores the value of key under.\n", keyFuncName(data, field), field.path)
+	g.printf("func %s(key string) string {\n", keyFuncName(data, field))
+	for _, pat := range field.patterns {
+		value := strconv.Quote(pat.value)
+		if pat.matcher == tags.Regex {
+			g.printf("if groups := %s.FindStringSubmatch(key); groups != nil {\n", pat.regexVar)
+			g.printf("return groups[%d]\n}\n", pat.keyGroup)
+			continue
+		}
+
+		g.printf("if %s {\n", g.patternExpr(pat, field.fold))
+		switch {
+		case field.fold && pat.matcher == tags.Prefix:
+			g.printf("return jsonpatrt.TrimPrefixFold(key, %s)\n", value)
+		case field.fold:
+			g.printf("return jsonpatrt.TrimSuffixFold(key, %s)\n", value)
+		case pat.matcher == tags.Prefix:
+			g.imports["strings"] = true
+			g.printf("return strings.TrimPrefix(key, %s)\n", value)
+		default:
+			g.imports["strings"] = true
+			g.printf("return strings.TrimSuffix(key, %s)\n", value)
+		}
+		g.printf("}\n")
+	}
+	g.printf("return key\n}\n\n")
+}
+
+func (g *generator) generateUnmarshal(data *structData, matchExpr func(*dynamicField) string) {
+	g.printf("// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x\n")
+	g.printf("// according to its jsonpat tags.\n")
+	g.printf("func (x *%s) UnmarshalJSON(data []byte) error {\n", data.name)
+	g.printf("if jsonpatrt.IsNull(data) {\nreturn nil\n}\n")
+	g.printf("if err := jsonpatrt.ExpectObject(data, x); err != nil {\nreturn err\n}\n")
+	for _, field := range data.maps {
+		g.printf("jsonpatrt.InitMap(&x.%s)\n", field.path)
+	}
+	if data.remaining != nil {
+		g.printf("jsonpatrt.InitMap(&x.%s)\n", data.remaining.path)
+	}
+	g.printf("\n")
+
+	// members are numbered when slice fields need to restore document order
+	indexed := len(data.slices) > 0
+	if indexed {
+		g.printf("collected := make([][]jsonpatrt.Member, %d)\n", len(data.slices))
+	}
+
+	// keys that no known or scalar field takes
+	if indexed {
+		g.printf("dynamic := func(index int, key string, value []byte) error {\n")
+	} else {
+		g.printf("dynamic := func(key string, value []byte) error {\n")
+	}
+	if len(data.maps) > 0 || len(data.slices) > 0 {
+		g.printf("claimed := false\n")
+		for _, field := range data.maps {
+			g.printf("if %s {\n", matchExpr(field))
+			g.printf("claimed = true\n")
+			mapKey := "key"
+			if field.trim {
+				mapKey = keyFuncName(data, field) + "(key)"
+			}
+			switch {
+			case field.nested > 0 && field.captures != nil:
+				g.printf("if err := jsonpatrt.SetCapturedNestedEntry(x.%s, key, %s, value, %s); err != nil {\n",
+					field.path, segmentsExpr(field), captureFuncName(data, field))
+			case field.nested > 0:
+				g.printf("if err := jsonpatrt.SetNestedEntry(x.%s, %s, value); err != nil {\n", field.path, segmentsExpr(field))
+			case field.captures != nil:
+				g.printf("if err := jsonpatrt.SetCapturedEntry(x.%s, key, %s, value, %s); err != nil {\n", field.path, mapKey, captureFuncName(data, field))
+			default:
+				g.printf("if err := jsonpatrt.SetEntry(x.%s, %s, value); err != nil {\n", field.path, mapKey)
+			}
+			g.imports["fmt"] = true
+			g.printf("return fmt.Errorf(\"failed to unmarshal dynamic key %%s: %%w\", key, err)\n}\n}\n")
+		}
+		for i, field := range data.slices {
+			g.printf("if %s {\n", matchExpr(field))
+			g.printf("claimed = true\n")
+			g.printf("collected[%d] = append(collected[%d], jsonpatrt.Member{Index: index, Key: key, Value: value})\n}\n", i, i)
+		}
+		g.printf("if claimed {\nreturn nil\n}\n")
+	}
+	if data.remaining != nil {
+		g.printf("if err := jsonpatrt.SetEntry(x.%s, key, value); err != nil {\n", data.remaining.path)
+		g.imports["fmt"] = true
+		g.printf("return fmt.Errorf(\"failed to unmarshal remaining key %%s: %%w\", key, err)\n}\n")
+		g.printf("return nil\n")
+	} else {
+		g.printf("return jsonpatrt.Validate(value)\n")
+	}
+	g.printf("}\n\n")
+
+	deferred := len(data.scalars) > 0 || indexed
+	if len(data.scalars) > 0 {
+		g.printf("var pending []jsonpatrt.Member\n")
+	}
+	if indexed {
+		g.printf("count := 0\n")
+	}
+	if deferred {
+		g.printf("err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {\n")
+	} else {
+		g.printf("return jsonpatrt.ForEachMember(data, func(key string, value []byte) error {\n")
+	}
+	if indexed {
+		g.printf("index := count\ncount++\n")
+	}
+	if len(data.known) > 0 {
+		g.printf("switch jsonpat%sKnown.Lookup(key) {\n", data.name)
+		for _, field := range data.known {
+			g.printf("case %s:\n", strconv.Quote(field.name))
+			if field.quoted {
+				g.printf("if err := jsonpatrt.UnmarshalQuoted(value, &x.%s); err != nil {\n", field.path)
+			} else {
+				g.imports["encoding/json"] = true
+				g.printf("if err := json.Unmarshal(value, &x.%s); err != nil {\n", field.path)
+			}
+			g.imports["fmt"] = true
+			g.printf("return fmt.Errorf(\"failed to unmarshal known key %%s: %%w\", key, err)\n}\n")
+			g.printf("return nil\n")
+		}
+		g.printf("}\n")
+	}
+	if len(data.scalars) > 0 {
+		var matches []string
+		for _, field := range data.scalars {
+			if expr := matchExpr(field); !slices.Contains(matches, expr) {
+				matches = append(matches, expr)
+			}
+		}
+		g.printf("if %s {\n", strings.Join(matches, " || "))
+		if indexed {
+			g.printf("pending = append(pending, jsonpatrt.Member{Index: index, Key: key, Value: value})\n")
+		} else {
+			g.printf("pending = append(pending, jsonpatrt.Member{Key: key, Value: value})\n")
+		}
+		g.printf("return nil\n}\n")
+	}
+	if indexed {
+		g.printf("return dynamic(index, key, value)\n")
+	} else {
+		g.printf("return dynamic(key, value)\n")
+	}
+	g.printf("})\n")
+	if !deferred {
+		g.printf("}\n\n")
+		return
+	}
+	g.printf("if err != nil {\nreturn err\n}\n")
+
+	if len(data.scalars) > 0 {
+		// each scalar field, in field order, takes one of the matching keys that
+		// an earlier scalar field hasn't already taken, as chosen by its policy
+		g.printf("\ntaken := make([]bool, len(pending))\n")
+		for _, field := range data.scalars {
+			matcher := fmt.Sprintf("func(key string) bool { return %s }", matchExpr(field))
+			switch field.policy {
+			case tags.Last:
+				g.printf("if i := jsonpatrt.PickLast(pending, taken, %s); i >= 0 {\n", matcher)
+			case tags.DocumentOrder:
+				g.printf("if i := jsonpatrt.PickInOrder(pending, taken, %s); i >= 0 {\n", matcher)
+			case tags.Unique:
+				g.printf("if i, err := jsonpatrt.PickUnique(pending, taken, %s, x, %s); err != nil {\n", matcher, strconv.Quote(field.name))
+				g.printf("return err\n} else if i >= 0 {\n")
+			default:
+				g.printf("if i := jsonpatrt.Pick(pending, taken, %s); i >= 0 {\n", matcher)
+			}
+			g.imports["encoding/json"] = true
+			g.printf("if err = json.Unmarshal(pending[i].Value, &x.%s); err != nil {\n", field.path)
+			g.imports["fmt"] = true
+			g.printf("return fmt.Errorf(\"failed to unmarshal dynamic scalar key %%s: %%w\", pending[i].Key, err)\n}\n")
+			if field.captures != nil {
+				g.printf("if err = %s(pending[i].Key, &x.%s); err != nil {\n", captureFuncName(data, field), field.path)
+				g.printf("return fmt.Errorf(\"failed to unmarshal dynamic scalar key %%s: %%w\", pending[i].Key, err)\n}\n")
+			}
+			g.printf("}\n")
+		}
+		g.printf("for i, m := range pending {\n")
+		if indexed {
+			g.printf("if !taken[i] {\nif err = dynamic(m.Index, m.Key, m.Value); err != nil {\nreturn err\n}\n}\n}\n")
+		} else {
+			g.printf("if !taken[i] {\nif err = dynamic(m.Key, m.Value); err != nil {\nreturn err\n}\n}\n}\n")
+		}
+	}
+
+	// slice fields decode what they collected once every key has been dispatched
+	for i, field := range data.slices {
+		values := "Values"
+		if field.entries {
+			values = "Entries"
+		}
+		if field.captures != nil {
+			g.printf("if err = jsonpatrt.SetCaptured%s(&x.%s, collected[%d], %s); err != nil {\nreturn err\n}\n",
+				values, field.path, i, captureFuncName(data, field))
+			continue
+		}
+		g.printf("if err = jsonpatrt.Set%s(&x.%s, collected[%d]); err != nil {\nreturn err\n}\n", values, field.path, i)
+	}
+	g.printf("return nil\n}\n\n")
+}
+
+func (g *generator) generateMarshal(data *structData) {
+	g.printf("// MarshalJSON implements json.Marshaler, encoding x as a json object\n")
+	g.printf("// according to its jsonpat tags.\n")
+	g.printf("func (x %s) MarshalJSON() ([]byte, error) {\n", data.name)
+	g.printf("var w jsonpatrt.Writer\n")
+
+	for _, field := range data.known {
+		write := "Member"
+		if field.quoted {
+			write = "Quoted"
+		}
+		nonEmpty := ""
+		if field.omitEmpty {
+			nonEmpty = g.nonEmptyExpr(field.path, field.typ)
+		}
+
+		if nonEmpty != "" {
+			g.printf("if %s {\n", nonEmpty)
+		}
+		g.printf("if err := w.%s(%s, &x.%s); err != nil {\n", write, strconv.Quote(field.name), field.path)
+		g.imports["fmt"] = true
+		g.printf("return nil, fmt.Errorf(\"failed to marshal known key %%s: %%w\", %s, err)\n}\n", strconv.Quote(field.name))
+		if nonEmpty != "" {
+			g.printf("}\n")
+		}
+	}
+
+	for _, field := range data.scalars {
+		nonZero := g.nonZeroExpr(field.path, field.typ)
+		key, ok := scalarKey(field)
+		if !ok {
+			g.imports["errors"] = true
+			g.printf("if %s {\n", nonZero)
+			g.printf("return nil, errors.New(%s)\n}\n", strconv.Quote(fmt.Sprintf(
+				"failed to marshal dynamic scalar field %s: cannot derive a key from %s",
+				field.name,
+				describePatterns(field.patterns),
+			)))
+			continue
+		}
+
+		g.printf("if %s && !w.Written(%s) {\n", nonZero, strconv.Quote(key))
+		g.printf("if err := w.Member(%s, &x.%s); err != nil {\n", strconv.Quote(key), field.path)
+		g.imports["fmt"] = true
+		g.printf("return nil, fmt.Errorf(\"failed to marshal dynamic scalar key %%s: %%w\", %s, err)\n}\n}\n", strconv.Quote(key))
+	}
+
+	for _, field := range data.maps {
+		switch {
+		case field.nested > 0:
+			g.printf("if err := jsonpatrt.WriteNestedEntries(&w, x.%s, %s, %s); err != nil {\nreturn nil, err\n}\n",
+				field.path, field.patterns[0].regexVar, literalsExpr(field))
+		case !field.trim:
+			g.printf("if err := jsonpatrt.WriteEntries(&w, x.%s); err != nil {\nreturn nil, err\n}\n", field.path)
+		case field.affixes != nil:
+			g.printf(
+				"if err := jsonpatrt.WriteAffixedEntries(&w, x.%s, %s, %s); err != nil {\nreturn nil, err\n}\n",
+				field.path,
+				strconv.Quote(field.affixes[0]),
+				strconv.Quote(field.affixes[1]),
+			)
+		default:
+			g.imports["errors"] = true
+			g.printf("if len(x.%s) != 0 {\n", field.path)
+			g.printf("return nil, errors.New(%s)\n}\n", strconv.Quote(fmt.Sprintf(
+				"failed to marshal dynamic map field %s: cannot rebuild keys trimmed by %s",
+				field.name,
+				describePatterns(field.patterns),
+			)))
+		}
+	}
+
+	for _, field := range data.slices {
+		if field.entries {
+			g.printf("if err := jsonpatrt.WriteEntrySlice(&w, x.%s); err != nil {\nreturn nil, err\n}\n", field.path)
+			continue
+		}
+		g.imports["errors"] = true
+		g.printf("if len(x.%s) != 0 {\n", field.path)
+		g.printf("return nil, errors.New(%s)\n}\n", strconv.Quote(fmt.Sprintf(
+			"failed to marshal dynamic slice field %s: its values have no keys; use []jsonpat.Entry[T] to keep them",
+			field.name,
+		)))
+	}
+
+	if data.remaining != nil {
+		g.printf("if err := jsonpatrt.WriteEntries(&w, x.%s); err != nil {\nreturn nil, err\n}\n", data.remaining.path)
+	}
+
+	g.printf("return w.Bytes(), nil\n}\n\n")
+}
+
+// matchExpr returns a boolean expression testing whether `key` matches any of
+// the patterns of field, and none of its excludes.
+func (g *generator) matchExpr(field *dynamicField) string {
+	exprs := make([]string, len(field.patterns))
+	for i, pat := range field.patterns {
+		exprs[i] = g.patternExpr(pat, field.fold)
+	}
+	expr := strings.Join(exprs, " || ")
+	if len(field.excludeVars) == 0 {
+		return expr
+	}
+
+	if len(exprs) > 1 {
+		expr = "(" + expr + ")"
+	}
+	for _, excludeVar := range field.excludeVars {
+		expr += " && !" + excludeVar + ".MatchString(key)"
+	}
+	return "(" + expr + ")"
+}
+
+// patternExpr returns a boolean expression testing whether `key` matches pat.
+func (g *generator) patternExpr(pat *pattern, fold bool) string {
+	value := strconv.Quote(pat.value)
+	if fold {
+		switch pat.matcher {
+		case tags.Prefix:
+			return "jsonpatrt.HasPrefixFold(key, " + value + ")"
+		case tags.Contains:
+			return "jsonpatrt.ContainsFold(key, " + value + ")"
+		case tags.Suffix:
+			return "jsonpatrt.HasSuffixFold(key, " + value + ")"
+		}
+	}
+
+	switch pat.matcher {
+	case tags.Prefix:
+		g.imports["strings"] = true
+		return "strings.HasPrefix(key, " + value + ")"
+	case tags.Contains:
+		g.imports["strings"] = true
+		return "strings.Contains(key, " + value + ")"
+	case tags.Suffix:
+		g.imports["strings"] = true
+		return "strings.HasSuffix(key, " + value + ")"
+	default:
+		return pat.regexVar + ".MatchString(key)"
+	}
+}
+
+// nonEmptyExpr returns an expression testing whether a field isn't empty
+// according to the `omitempty` rules of encoding/json, or "" if it never is.
+func (g *generator) nonEmptyExpr(path string, typ resolved) string {
+	switch typ.kind {
+	case stringKind, mapKind, sliceKind, arrayKind:
+		return "len(x." + path + ") != 0"
+	case boolKind:
+		return "x." + path
+	case numberKind:
+		return "x." + path + " != 0"
+	case pointerKind, interfaceKind:
+		return "x." + path + " != nil"
+	case structKind:
+		return ""
+	}
+	return "!jsonpatrt.IsEmpty(x." + path + ")"
+}
+
+// nonZeroExpr returns an expression testing whether a field holds a value other
+// than its zero value.
+func (g *generator) nonZeroExpr(path string, typ resolved) string {
+	switch typ.kind {
+	case stringKind:
+		return "x." + path + ` != ""`
+	case boolKind:
+		return "x." + path
+	case numberKind:
+		return "x." + path + " != 0"
+	case pointerKind, interfaceKind, mapKind, sliceKind:
+		return "x." + path + " != nil"
+	}
+	return "!jsonpatrt.IsZero(x." + path + ")"
+}
+
+// scalarKey derives the json key a dynamic scalar field is written under, from
+// the first of its patterns a key that isn't excluded can be derived from.
+func scalarKey(field *dynamicField) (string, bool) {
+	for _, pat := range field.patterns {
+		key, ok := pat.value, true
+		if pat.regex != "" {
+			key, ok = tags.RegexLiteral(pat.regex)
+		}
+
+		if ok && !field.excluded(key) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// describePatterns describes the patterns of a field for error messages.
+func describePatterns(patterns []*pattern) string {
+	descriptions := make([]string, len(patterns))
+	for i, pat := range patterns {
+		descriptions[i] = fmt.Sprintf("%s pattern %q", pat.matcher, pat.value)
+	}
+	return strings.Join(descriptions, " or ")
+}
+
+// source returns the formatted source of the generated file.
+func (g *generator) source() ([]byte, error) {
+	var src bytes.Buffer
+	src.WriteString("// Code generated by jsonpat-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", g.pkg.name)
+
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	src.WriteString("import (\n")
+	for _, path := range paths {
+		if path == runtimePath {
+			continue
+		}
+		fmt.Fprintf(&src, "%q\n", path)
+	}
+	fmt.Fprintf(&src, "\n%q\n)\n\n", runtimePath)
+	src.Write(g.body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return formatted, nil
+}
+
+// quoteRegex quotes a regex as a raw string literal when it can be, so that it
+// reads as it does in the tag.
+func quoteRegex(pattern string) string {
+	if strings.ContainsAny(pattern, "`\r") {
+		return strconv.Quote(pattern)
+	}
+	return "`" + pattern + "`"
+}
+
+func exprString(expr ast.Expr) string {
+	return types.ExprString(expr)
+}
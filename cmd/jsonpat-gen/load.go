@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxResolveDepth bounds the chain of named types followed when resolving a
+// type expression, guarding against invalid recursive declarations.
+const maxResolveDepth = 32
+
+// pkg holds the type declarations of the package being generated for.
+type pkg struct {
+	name  string
+	decls []*typeDecl
+	types map[string]*typeDecl
+	// methods holds the names of the methods declared on each type
+	methods map[string]map[string]bool
+}
+
+// typeDecl is a type declared in the package, along with the file declaring it.
+type typeDecl struct {
+	spec *ast.TypeSpec
+	file *file
+}
+
+// file holds the imports of a source file, keyed by their local name, which
+// are needed to resolve the type expressions it contains.
+type file struct {
+	imports map[string]string
+}
+
+// loadPackage parses the go files of the package in dir, leaving out test files
+// and the generated output file.
+func loadPackage(dir, output string) (*pkg, error) {
+	buildPkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load package in %s: %w", dir, err)
+	}
+
+	p := &pkg{name: buildPkg.Name, types: make(map[string]*typeDecl), methods: make(map[string]map[string]bool)}
+	fset := token.NewFileSet()
+	for _, name := range buildPkg.GoFiles {
+		if name == output {
+			continue
+		}
+
+		parsed, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		p.addFile(parsed)
+	}
+
+	return p, nil
+}
+
+func (p *pkg) addFile(parsed *ast.File) {
+	f := &file{imports: make(map[string]string)}
+	for _, imp := range parsed.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		name := path.Base(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		f.imports[name] = importPath
+	}
+
+	for _, decl := range parsed.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			p.addMethod(fn)
+			continue
+		}
+
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			d := &typeDecl{spec: typeSpec, file: f}
+			p.decls = append(p.decls, d)
+			p.types[typeSpec.Name.Name] = d
+		}
+	}
+}
+
+// addMethod records fn if it is a method, under the name of its receiver type.
+func (p *pkg) addMethod(fn *ast.FuncDecl) {
+	if fn.Recv == nil || len(fn.Recv.List) != 1 {
+		return
+	}
+
+	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	ident, ok := recv.(*ast.Ident)
+	if !ok {
+		return
+	}
+	if p.methods[ident.Name] == nil {
+		p.methods[ident.Name] = make(map[string]bool)
+	}
+	p.methods[ident.Name][fn.Name.Name] = true
+}
+
+// kind is the kind of the underlying type of a type expression, as far as the
+// generator needs to know it.
+type kind int
+
+const (
+	unknownKind kind = iota
+	stringKind
+	boolKind
+	numberKind
+	mapKind
+	sliceKind
+	arrayKind
+	pointerKind
+	interfaceKind
+	structKind
+)
+
+// resolved describes the underlying type of a type expression.
+type resolved struct {
+	kind  kind
+	named bool
+	// integer is set for the integer types among numberKind, and byteSized for
+	// the 8 bit unsigned ones, which encoding/json encodes slices of as strings
+	integer, byteSized bool
+
+	// elem is the element type of pointers and maps, and key the key type of maps
+	elem, key ast.Expr
+	file      *file
+
+	// empty is set for interfaces without methods
+	empty bool
+	// rawMessage is set for json.RawMessage
+	rawMessage bool
+	// structType is the declaration of struct types
+	structType *ast.StructType
+}
+
+var basicKinds = map[string]kind{
+	"string": stringKind,
+	"bool":   boolKind,
+	"int":    numberKind, "int8": numberKind, "int16": numberKind, "int32": numberKind, "int64": numberKind,
+	"uint": numberKind, "uint8": numberKind, "uint16": numberKind, "uint32": numberKind, "uint64": numberKind,
+	"uintptr": numberKind, "byte": numberKind, "rune": numberKind,
+	"float32": numberKind, "float64": numberKind,
+}
+
+// resolve finds the underlying type of expr, declared in f. Types declared in
+// other packages can't be resolved without type checking them, so apart from
+// json.RawMessage they resolve to unknownKind.
+func (p *pkg) resolve(expr ast.Expr, f *file) resolved {
+	return p.resolveDepth(expr, f, 0)
+}
+
+func (p *pkg) resolveDepth(expr ast.Expr, f *file, depth int) resolved {
+	if depth > maxResolveDepth {
+		return resolved{}
+	}
+
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return p.resolveDepth(t.X, f, depth)
+	case *ast.Ident:
+		if decl, ok := p.types[t.Name]; ok {
+			if decl.spec.TypeParams != nil {
+				return resolved{}
+			}
+			r := p.resolveDepth(decl.spec.Type, decl.file, depth+1)
+			r.named = true
+			return r
+		}
+		if k, ok := basicKinds[t.Name]; ok {
+			return resolved{
+				kind:      k,
+				named:     true,
+				integer:   k == numberKind && !strings.HasPrefix(t.Name, "float"),
+				byteSized: t.Name == "uint8" || t.Name == "byte",
+			}
+		}
+		if t.Name == "any" {
+			return resolved{kind: interfaceKind, named: true, empty: true}
+		}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && f.imports[x.Name] == "encoding/json" && t.Sel.Name == "RawMessage" {
+			return resolved{kind: sliceKind, named: true, rawMessage: true}
+		}
+	case *ast.StarExpr:
+		return resolved{kind: pointerKind, elem: t.X, file: f}
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return resolved{kind: sliceKind, elem: t.Elt, file: f}
+		}
+		return resolved{kind: arrayKind, elem: t.Elt, file: f}
+	case *ast.MapType:
+		return resolved{kind: mapKind, key: t.Key, elem: t.Value, file: f}
+	case *ast.InterfaceType:
+		return resolved{kind: interfaceKind, empty: len(t.Methods.List) == 0}
+	case *ast.StructType:
+		return resolved{kind: structKind, structType: t, file: f}
+	}
+
+	return resolved{}
+}
@@ -0,0 +1,97 @@
+// Command jsonpat-gen generates reflection-free UnmarshalJSON and MarshalJSON
+// methods for structs with `jsonpat` tags, interpreting the `jsonpat` and `json`
+// tags the same way as jsonpat.Unmarshal and jsonpat.Marshal.
+//
+// It is meant to be run by go generate from the package declaring the structs:
+//
+//	//go:generate go run github.com/jamieyoung5/jsonpat/cmd/jsonpat-gen -type=Record
+//
+// Usage:
+//
+//	jsonpat-gen [-type T1,T2] [-output file] [dir]
+//
+// Without -type, methods are generated for every struct of the package with
+// jsonpat fields, except structs embedded in other structs: their methods would
+// be promoted to the embedding struct, so their fields are generated as part of
+// the embedding struct instead.
+//
+// The generator works from the source of the package without type checking it,
+// so the types of embedded fields, map fields and fields using the `string` json
+// option must be declared in the package itself (or be built in types). Embedded
+// pointers to structs are rejected, as decoding their fields would allocate them.
+// Nested structs with jsonpat tags are decoded through their own methods, so
+// they need to be generated too, and so do capture structs, which must be
+// declared in the package; generation fails when a generated type holds one that
+// isn't. Custom matchers registered with jsonpat.RegisterMatcher only exist at
+// run time, so tags using them are rejected as invalid matchers.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultOutput = "jsonpat_gen.go"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("jsonpat-gen: ")
+
+	typeNames := flag.String("type", "", "comma-separated list of type names; defaults to every struct with jsonpat fields")
+	output := flag.String("output", defaultOutput, "output file name, relative to the package directory unless absolute")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: jsonpat-gen [-type T1,T2] [-output file] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		dir = flag.Arg(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var names []string
+	if *typeNames != "" {
+		names = strings.Split(*typeNames, ",")
+	}
+
+	path, replaced := outputPath(dir, *output)
+	src, err := generate(dir, names, replaced)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = os.WriteFile(path, src, 0o644); err != nil {
+		log.Fatalf("failed to write output: %v", err)
+	}
+}
+
+// outputPath returns the path of the output file, which is relative to dir
+// unless it is absolute, along with the name of the package file it replaces,
+// left out of the analysis. That name is empty when the output file isn't in
+// dir.
+func outputPath(dir, output string) (path, replaced string) {
+	path = output
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return path, ""
+	}
+	absOutputDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil || absOutputDir != absDir {
+		return path, ""
+	}
+	return path, filepath.Base(path)
+}
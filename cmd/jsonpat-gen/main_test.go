@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate_UpToDate(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "gentest")
+	const output = "types_jsonpat.go"
+
+	src, err := generate(dir, nil, output)
+	require.NoError(t, err)
+
+	committed, err := os.ReadFile(filepath.Join(dir, output))
+	require.NoError(t, err)
+	assert.Equal(t, string(committed), string(src), "generated code is stale; run go generate ./internal/gentest")
+}
+
+func TestGenerate_SelectTypes(t *testing.T) {
+	dir := writePackage(t, `package sample
+
+type Embedded struct {
+	Attrs map[string]int `+"`jsonpat:\"attr_,prefix\"`"+`
+}
+
+type Outer struct {
+	Embedded
+	Name string `+"`json:\"name\"`"+`
+}
+
+type Plain struct {
+	Name string `+"`json:\"name\"`"+`
+}
+`)
+
+	src, err := generate(dir, nil, defaultOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(src), "func (x *Outer) UnmarshalJSON")
+	assert.Contains(t, string(src), "jsonpatrt.SetEntry(x.Embedded.Attrs, key, value)")
+	assert.NotContains(t, string(src), "func (x *Embedded)")
+	assert.NotContains(t, string(src), "Plain")
+
+	src, err = generate(dir, []string{"Embedded"}, defaultOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(src), "func (x *Embedded) UnmarshalJSON")
+
+	_, err = generate(dir, []string{"Plain"}, defaultOutput)
+	assert.ErrorContains(t, err, "type Plain has no jsonpat fields")
+
+	_, err = generate(dir, []string{"Missing"}, defaultOutput)
+	assert.ErrorContains(t, err, "type Missing not found")
+}
+
+func TestGenerate_SliceFields(t *testing.T) {
+	dir := writePackage(t, `package sample
+
+import (
+	"encoding/json"
+
+	"github.com/jamieyoung5/jsonpat"
+)
+
+type Collected struct {
+	Values  []int                   `+"`jsonpat:\"v_,prefix\"`"+`
+	Entries []jsonpat.Entry[string] `+"`jsonpat:\"e_,prefix\"`"+`
+	Raw     json.RawMessage         `+"`jsonpat:\"raw_,prefix\"`"+`
+	Bytes   []byte                  `+"`jsonpat:\"b_,prefix\"`"+`
+}
+`)
+
+	src, err := generate(dir, nil, defaultOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(src), "jsonpatrt.SetValues(&x.Values, collected[0])")
+	assert.Contains(t, string(src), "jsonpatrt.SetEntries(&x.Entries, collected[1])")
+	assert.Contains(t, string(src), "json.Unmarshal(pending[i].Value, &x.Raw)", "json.RawMessage should stay a scalar field")
+	assert.Contains(t, string(src), "json.Unmarshal(pending[i].Value, &x.Bytes)", "Byte slices should stay scalar fields")
+
+	dir = writePackage(t, `package sample
+
+import "github.com/jamieyoung5/jsonpat"
+
+type Pointers struct {
+	Entries []*jsonpat.Entry[int] `+"`jsonpat:\"e_,prefix\"`"+`
+}
+`)
+	_, err = generate(dir, nil, defaultOutput)
+	assert.ErrorContains(t, err, "collect entries as []jsonpat.Entry[int]")
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	tests := map[string]string{
+		"invalid matcher":                        "Dyn map[string]int `jsonpat:\"dyn_,invalid\"`",
+		"invalid regex":                          "Dyn map[string]int `jsonpat:\"(,regex\"`",
+		"unsupported map key type":               "Dyn map[float64]int `jsonpat:\"dyn_,prefix\"`",
+		"unsupported map key type struct{}":      "Dyn map[struct{}]int `jsonpat:\"dyn_,prefix\"`",
+		"can't be resolved":                      "Dyn time.Duration `jsonpat:\"dyn_,prefix\"`",
+		"map[string]json.RawMessage":             "Rest map[string]int `jsonpat:\",remaining\"`",
+		"embedded type time.Time":                "time.Time\nDyn map[string]int `jsonpat:\"dyn_,prefix\"`",
+		"embedded pointer *Broken":               "*Broken\nDyn map[string]int `jsonpat:\"dyn_,prefix\"`",
+		"can't be combined with prefix patterns": "Dyn map[string]map[string]int `jsonpat:\"{a}_{b},template|x_,prefix\"`",
+		"only 1 levels of maps":                  "Dyn map[string]int `jsonpat:\"{a}_{b},template\"`",
+		"invalid template":                       "Dyn map[string]int `jsonpat:\"{a}{b},template\"`",
+		"string option applies":                  "D time.Duration `json:\"d,string\"`\nDyn map[string]int `jsonpat:\"dyn_,prefix\"`",
+	}
+
+	for expected, fields := range tests {
+		t.Run(expected, func(t *testing.T) {
+			dir := writePackage(t, "package sample\n\nimport \"time\"\n\nvar _ time.Time\n\ntype Broken struct {\n"+fields+"\n}\n")
+			_, err := generate(dir, nil, defaultOutput)
+			assert.ErrorContains(t, err, expected)
+		})
+	}
+}
+
+func TestGenerate_NestedNotGenerated(t *testing.T) {
+	const source = "package sample\n\n" +
+		"type Item struct {\nAttrs map[string]int `jsonpat:\"attr_,prefix\"`\n}\n\n" +
+		"type Base struct {\nExtra map[string]int `jsonpat:\"x_,prefix\"`\n}\n\n" +
+		"type Plain struct {\nItems []*Item\n}\n\n" +
+		"type Record struct {\nBase\nItem Item `json:\"item\"`\nWrapped map[string]Plain `json:\"wrapped\"`\nSkipped Item `json:\"-\"`\n" +
+		"Dyn map[string]int `jsonpat:\"dyn_,prefix\"`\n}\n\n" +
+		"type Holder struct {\nB Base `json:\"b\"`\nDyn map[string]int `jsonpat:\"dyn_,prefix\"`\n}\n"
+	dir := writePackage(t, source)
+
+	_, err := generate(dir, []string{"Record"}, defaultOutput)
+	assert.ErrorContains(t, err, "Item has jsonpat fields but is not generated, so field Record.Item would be decoded without them")
+
+	_, err = generate(dir, []string{"Record", "Item"}, defaultOutput)
+	require.NoError(t, err, "Embedded structs are generated as part of the embedding struct, and Plain reaches Item")
+
+	_, err = generate(dir, nil, defaultOutput)
+	assert.ErrorContains(t, err, "Base has jsonpat fields but is not generated, so field Holder.B would be decoded without them",
+		"Types embedded elsewhere aren't generated by default")
+}
+
+func TestGenerate_GroupPrefixPattern(t *testing.T) {
+	dir := writePackage(t, "package sample\n\ntype Prefixed struct {\nGroups map[string]int `jsonpat:\"group=,prefix\"`\n}\n")
+	src, err := generate(dir, nil, defaultOutput)
+	require.NoError(t, err, "Tags that aren't just group=<name> should still be patterns")
+	assert.Contains(t, string(src), `strings.HasPrefix(key, "group=")`)
+}
+
+func TestGenerate_CaptureErrors(t *testing.T) {
+	tests := map[string]string{
+		"not prefix patterns":                  "Dyn map[string]Sample `jsonpat:\"dyn_,prefix\"`",
+		`no regex has a group named "metric"`:  "Dyn []Sample `jsonpat:\"^(?P<region>[a-z]+)$,regex\"`",
+		"can't be filled through a pointer":    "Dyn map[string]*Sample `jsonpat:\"^(?P<region>[a-z]+)_(?P<metric>[a-z]+)$,regex\"`",
+		"needs a Value field":                  "Region string `jsonpat:\"group=region\"`",
+		"not Name":                             "Region string `jsonpat:\"group=region\"`\nName string\nValue int",
+		"unsupported group field type float64": "Ratio float64 `jsonpat:\"group=ratio\"`\nValue int",
+	}
+
+	for expected, fields := range tests {
+		t.Run(expected, func(t *testing.T) {
+			dir := writePackage(t, "package sample\n\ntype Sample struct {\n"+
+				"Region string `jsonpat:\"group=region\"`\nMetric string `jsonpat:\"group=metric\"`\nValue int\n}\n\n"+
+				"type Broken struct {\n"+fields+"\n}\n")
+			_, err := generate(dir, nil, defaultOutput)
+			assert.ErrorContains(t, err, expected)
+		})
+	}
+}
+
+// writePackage writes src as the only file of a package in a temporary directory.
+func writePackage(t *testing.T, src string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sample.go"), []byte(src), 0o644))
+	return dir
+}
+
+func TestOutputPath(t *testing.T) {
+	dir := t.TempDir()
+
+	path, replaced := outputPath(dir, "types_jsonpat.go")
+	assert.Equal(t, filepath.Join(dir, "types_jsonpat.go"), path)
+	assert.Equal(t, "types_jsonpat.go", replaced)
+
+	other := filepath.Join(t.TempDir(), "x.go")
+	path, replaced = outputPath(dir, other)
+	assert.Equal(t, other, path, "Absolute paths should be used as they are")
+	assert.Empty(t, replaced, "Files outside of the package shouldn't be left out of it")
+
+	path, replaced = outputPath(dir, filepath.Join(dir, "x.go"))
+	assert.Equal(t, filepath.Join(dir, "x.go"), path)
+	assert.Equal(t, "x.go", replaced)
+
+	path, replaced = outputPath(dir, filepath.Join("sub", "x.go"))
+	assert.Equal(t, filepath.Join(dir, "sub", "x.go"), path)
+	assert.Empty(t, replaced)
+}
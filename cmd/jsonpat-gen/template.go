@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// setNested makes a map field with template patterns store its values in
+// nested maps, one level per placeholder, mirroring the reflective decoder. It
+// returns the type of the values, along with the file declaring it.
+func (p *pkg) setNested(field *dynamicField, typ resolved) (ast.Expr, *file, error) {
+	if !slices.ContainsFunc(field.patterns, func(pat *pattern) bool { return pat.template != nil }) {
+		return typ.elem, typ.file, nil
+	}
+
+	first := field.patterns[0]
+	for _, pat := range field.patterns {
+		if pat.template == nil {
+			return nil, nil, fmt.Errorf("%s patterns of a map field can't be combined with %s patterns", tags.Template, pat.matcher)
+		}
+		if first.template == nil || len(pat.template.Names) != len(first.template.Names) {
+			return nil, nil, fmt.Errorf("%s patterns of a map field must all have the same number of placeholders", tags.Template)
+		}
+	}
+
+	field.nested = len(first.template.Names)
+	var valueExpr ast.Expr
+	var valueFile *file
+	for i := 0; i < field.nested; i++ {
+		switch {
+		case typ.kind == unknownKind:
+			return nil, nil, fmt.Errorf("the type of field %s can't be resolved", field.name)
+		case typ.kind != mapKind:
+			return nil, nil, fmt.Errorf("%s %q has %d placeholders, but only %d levels of maps to store them in",
+				tags.Template, first.value, field.nested, i)
+		case !p.mapKeyType(typ.key, typ.file):
+			return nil, nil, fmt.Errorf("unsupported map key type %s", exprString(typ.key))
+		}
+		valueExpr, valueFile = typ.elem, typ.file
+		typ = p.resolve(typ.elem, typ.file)
+	}
+	return valueExpr, valueFile, nil
+}
+
+// segmentsExpr returns an expression splitting `key` into the segments of the
+// first template of field it matches.
+func segmentsExpr(field *dynamicField) string {
+	vars := make([]string, len(field.patterns))
+	for i, pat := range field.patterns {
+		vars[i] = pat.regexVar
+	}
+	return "jsonpatrt.Segments(key, " + strings.Join(vars, ", ") + ")"
+}
+
+// literalsExpr returns the quoted literals of the first template of field, as
+// arguments to jsonpatrt.WriteNestedEntries.
+func literalsExpr(field *dynamicField) string {
+	literals := make([]string, len(field.patterns[0].template.Literals))
+	for i, literal := range field.patterns[0].template.Literals {
+		literals[i] = strconv.Quote(literal)
+	}
+	return strings.Join(literals, ", ")
+}
@@ -0,0 +1,67 @@
+package jsonpat
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// A Decoder reads and decodes json values from an input stream, supporting
+// `jsonpat` tags in the same way as Unmarshal. It mirrors encoding/json.Decoder,
+// so a stream of concatenated or newline-delimited json values can be decoded one
+// value at a time.
+type Decoder struct {
+	dec  *json.Decoder
+	opts Options
+}
+
+// NewDecoder returns a new decoder that reads from r.
+//
+// The decoder introduces its own buffering and may read data from r beyond the
+// json values requested.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Decode reads the next json value from its input and stores it in the value
+// pointed to by v, following the same rules as UnmarshalWithOptions.
+//
+// Decode returns io.EOF once the input is exhausted.
+func (d *Decoder) Decode(v interface{}) error {
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	return UnmarshalWithOptions(raw, v, d.opts)
+}
+
+// DisallowUnknownFields causes the Decoder to return an *UnknownKeysError when
+// an object holds keys that no field of the destination struct claims, as with
+// Options.DisallowUnknownFields.
+func (d *Decoder) DisallowUnknownFields() {
+	d.opts.DisallowUnknownFields = true
+}
+
+// CaseSensitiveKnownFields causes the Decoder to match known fields against
+// json keys exactly, as with Options.CaseSensitiveKnownFields.
+func (d *Decoder) CaseSensitiveKnownFields() {
+	d.opts.CaseSensitiveKnownFields = true
+}
+
+// KeySeparator causes the Decoder to route keys such as "db.host" into nested
+// struct fields, splitting them on sep, as with Options.KeySeparator.
+func (d *Decoder) KeySeparator(sep string) {
+	d.opts.KeySeparator = sep
+}
+
+// More reports whether there is another element in the current array or object
+// being parsed.
+func (d *Decoder) More() bool {
+	return d.dec.More()
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer. The
+// reader is valid until the next call to Decode.
+func (d *Decoder) Buffered() io.Reader {
+	return d.dec.Buffered()
+}
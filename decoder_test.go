@@ -0,0 +1,65 @@
+package jsonpat
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type StreamRecord struct {
+	ID      string         `json:"id"`
+	Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+}
+
+func TestDecoder_NewlineDelimited(t *testing.T) {
+	input := `{"id": "a", "dyn_x": 1}
+{"id": "b", "dyn_y": 2, "dyn_z": 3}
+`
+	dec := NewDecoder(strings.NewReader(input))
+
+	var records []StreamRecord
+	for dec.More() {
+		var record StreamRecord
+		require.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+
+	require.Len(t, records, 2)
+	assert.Equal(t, StreamRecord{ID: "a", Dynamic: map[string]int{"dyn_x": 1}}, records[0])
+	assert.Equal(t, StreamRecord{ID: "b", Dynamic: map[string]int{"dyn_y": 2, "dyn_z": 3}}, records[1])
+
+	var record StreamRecord
+	assert.True(t, errors.Is(dec.Decode(&record), io.EOF), "Expected io.EOF once input is exhausted")
+}
+
+func TestDecoder_Concatenated(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`{"id":"a","dyn_x":1}{"id":"b"} trailing`))
+
+	var first, second StreamRecord
+	require.NoError(t, dec.Decode(&first))
+	require.NoError(t, dec.Decode(&second))
+
+	assert.Equal(t, "a", first.ID)
+	assert.Equal(t, 1, first.Dynamic["dyn_x"])
+	assert.Equal(t, "b", second.ID)
+
+	rest, err := io.ReadAll(dec.Buffered())
+	require.NoError(t, err)
+	assert.Equal(t, " trailing", string(rest))
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`{"id": "a", "dyn_x": "not-a-number"}{"id": `))
+
+	var record StreamRecord
+	assert.Error(t, dec.Decode(&record), "Expected error for dynamic field type mismatch")
+	assert.Error(t, dec.Decode(&record), "Expected error for truncated json")
+
+	var i int
+	dec = NewDecoder(strings.NewReader(`{}`))
+	assert.Error(t, dec.Decode(&i), "Expected error for pointer to non-struct")
+}
@@ -19,16 +19,120 @@ Its format is: `jsonpat:"<value>,<type>"`
   - `contains`: Matches if the JSON key contains <value>.
   - `suffix`: Matches if the JSON key ends with <value>.
   - `regex`: Matches if the JSON key matches <value> (which must be a valid regex pattern)
+  - `glob`: Matches if the whole JSON key matches the glob pattern <value>, where
+    `*` matches any run of characters, `?` a single character, `[abc]` or `[!abc]`
+    a character in or out of a class, and `{a,b}` any of the alternatives.
+  - `template`: Matches if the whole JSON key matches the template <value>, made
+    of literal text around placeholders such as `{region}_{metric}`, each
+    matching a non-empty segment of the key.
 
-Fields using this tag can be one of two kinds:
+A map field with template patterns stores its values in nested maps, one level
+per placeholder, so `jsonpat:"{region}_{metric},template"` decodes "us_cpu" into
+the ["us"]["cpu"] entry of a map[string]map[string]float64. Marshal builds the
+keys back from the first template.
+
+A field may list several alternative patterns separated by `|`, e.g.
+`jsonpat:"cpu_,prefix|mem_,prefix"`, and claims the keys matching any of them.
+Only a `|` directly following a matcher separates patterns, so a `|` within a
+regex is left alone. Options follow the last pattern and apply to all of them.
+
+The repeatable `exclude=<glob>` option keeps keys matching the glob out of the
+field, e.g. `jsonpat:"x_,prefix,exclude=x_internal_*"`.
+
+The `trim` option stores the keys of a map field without the matched prefix or
+suffix, or for a regex, as the text of its capture group named "key" (or of its
+first capture group). Marshal adds the trimmed parts back.
+
+Appending the `ci` option makes a matcher case-insensitive under Unicode case
+folding, e.g. `jsonpat:"x-request-,prefix,ci"` matches both "X-Request-Id" and
+"x-request-id". It applies to exclude globs too.
+
+The type always comes right after the value, so a value may itself contain
+commas as long as the type is given explicitly, e.g. `jsonpat:"^k_\\d{1,3}$,regex"`.
+Commas can also be escaped as `\,`, in which case the type may be omitted.
+
+RegisterMatcher adds custom matchers, referenced by name like the built in ones:
+a field tagged `jsonpat:"acme globex,tenant"` claims the keys accepted by the
+Matcher that the factory registered as "tenant" builds from "acme globex".
+
+A scalar field matched by several keys takes the first of them in sorted
+order. The `last` option takes the last one instead, `document-order` the first
+one in the input, and `unique` makes Unmarshal return a *ConflictError listing
+them all.
+
+Invalid tags, such as an unknown matcher or a regex that doesn't compile, are
+reported as a *TagError the first time a struct is decoded or encoded.
+
+Fields using this tag can be one of three kinds:
 
  1. **Map Type (`map[string]T`):** All JSON keys that match the rule will be
-    unmarshaled into this map. The map must be initialized (or nil).
+    unmarshaled into this map. The map must be initialized (or nil). Like in
+    encoding/json, keys may also be integers, named string types or
+    implement encoding.TextUnmarshaler; they are converted after trimming.
 
  2. **Scalar Type (e.g., `string`, `int`, `bool`):** The *first* JSON key
     that matches the rule will have its value unmarshaled into this field.
     Any subsequent keys matching the same rule will be ignored for this field.
 
+ 3. **Slice Type (`[]T` or `[]Entry[T]`):** The values of all JSON keys that
+    match the rule are appended in the order they appear in the input, and
+    an Entry keeps the key of each value too. []byte and json.RawMessage
+    fields are scalar fields.
+
+The values of these fields can be capture structs, whose fields tagged
+`jsonpat:"group=<name>"` are filled from the named groups of the regex matching
+the key, and whose Value field holds the value of the key:
+
+	type Sample struct {
+		Region string `jsonpat:"group=region"`
+		Value  float64
+	}
+
+	type Metrics struct {
+		Samples []Sample `jsonpat:"^(?P<region>[a-z]+)_cpu$,regex"`
+	}
+
+# Remaining Keys
+
+A map field tagged `jsonpat:",remaining"` receives every key that is claimed
+by no known field and no dynamic field, so unknown attributes can be forwarded or
+logged without a second parse. It must be a map[string]json.RawMessage or a
+map[string]any, and a struct may have at most one such field.
+
+	type Event struct {
+		Name  string                     `json:"name"`
+		Extra map[string]json.RawMessage `jsonpat:",remaining"`
+	}
+
+# Options
+
+UnmarshalWithOptions accepts an Options value. Setting DisallowUnknownFields makes
+decoding fail with an *UnknownKeysError naming every key that matched neither a
+known field nor any jsonpat rule, which encoding/json's Decoder.DisallowUnknownFields
+can't provide for jsonpat structs:
+
+	err := jsonpat.UnmarshalWithOptions(data, &v, jsonpat.Options{DisallowUnknownFields: true})
+
+Like encoding/json, known fields match json keys case-insensitively, preferring
+an exact match. Setting CaseSensitiveKnownFields only accepts exact matches.
+
+Setting KeySeparator unflattens keys: with a separator of ".", the key "db.host"
+is decoded into the host field of the struct held by the known field db, whose
+own known fields, jsonpat fields and flattened keys apply to the rest of the key.
+
+# Nested Structs
+
+`jsonpat` tags are honoured at any depth: struct fields, pointers to structs,
+slices and arrays of structs and maps of structs are all decoded (and encoded) with
+the same rules as the top-level struct. Types implementing json.Unmarshaler or
+encoding.TextUnmarshaler keep using their own methods.
+
+Unmarshal also accepts a pointer to a slice, array or map of structs, so that
+documents holding a list or an object of records can be decoded directly:
+
+	var records []MyData
+	err := jsonpat.Unmarshal(data, &records)
+
 # Example Usage
 
 Given a struct:
@@ -69,5 +173,64 @@ Unmarshaling:
 	// data.DynamicByRegex["user_102"] == "u-2"
 	//
 	// data.FirstScalar == "second" (Deterministically selected because "another_val" sorts before "other_val")
+
+# Generic Helpers
+
+Decode, DecodeReader and MustDecode return a new value of the requested type
+instead of filling in a pointer, and UnmarshalInto takes a typed pointer:
+
+	data, err := jsonpat.Decode[MyData](jsonData)
+	err = jsonpat.UnmarshalInto(jsonData, &data)
+
+The type isn't constrained, so types that can't be decoded still compile, and
+are reported when decoding as with Unmarshal.
+
+# Streaming
+
+NewDecoder returns a Decoder that reads a stream of concatenated or newline-delimited
+json values from an io.Reader, decoding each of them like Unmarshal:
+
+	dec := jsonpat.NewDecoder(body)
+	for dec.More() {
+		var data MyData
+		if err := dec.Decode(&data); err != nil {
+			// handle error
+		}
+	}
+
+# Marshaling
+
+Marshal and MarshalIndent perform the reverse operation. Known fields are encoded
+exactly as encoding/json would encode them, while the entries of dynamic map fields
+are written as sibling keys of the enclosing object:
+
+	data, err := jsonpat.Marshal(MyData{
+		KnownField:      "hello",
+		DynamicByPrefix: map[string]int{"dyn_abc": 123},
+	})
+	// {"known_field":"hello","dyn_abc":123}
+
+Dynamic scalar fields are written under a key derived from their pattern (the
+prefix, suffix or substring itself, or a regex that matches a single literal key).
+
+# encoding/json Interoperability
+
+UnmarshalJSONInto and MarshalJSONFrom apply the jsonpat tags of a struct without
+calling its own UnmarshalJSON and MarshalJSON methods, so a struct can implement
+json.Unmarshaler and json.Marshaler by delegating to them:
+
+	func (d *MyData) UnmarshalJSON(data []byte) error {
+		return jsonpat.UnmarshalJSONInto(data, d)
+	}
+
+Struct wraps a struct type the same way, for types that can't be given methods.
+
+# Code Generation
+
+The jsonpat-gen command in cmd/jsonpat-gen generates UnmarshalJSON and MarshalJSON
+methods that apply the jsonpat tags of a struct without reflection, so that
+encoding/json handles the struct on its own:
+
+	//go:generate go run github.com/jamieyoung5/jsonpat/cmd/jsonpat-gen -type=MyData
 */
 package jsonpat
@@ -0,0 +1,60 @@
+package jsonpat
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A TagError describes a struct field whose `jsonpat` tag could not be analysed,
+// for example because it names an unknown matcher or holds an invalid regex.
+type TagError struct {
+	Type  reflect.Type // struct type declaring the field
+	Field string       // name of the field
+	Tag   string       // value of the field's jsonpat tag
+	Err   error        // underlying cause
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("jsonpat: invalid tag %q on field %s.%s: %v", e.Tag, e.Type, e.Field, e.Err)
+}
+
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+// An UnknownKeysError is returned when decoding with Options.DisallowUnknownFields
+// and an object holds keys that are claimed by no field of the target struct.
+//
+// Values without jsonpat fields are decoded by encoding/json, which stops at the
+// first unknown key and doesn't tell which nested struct it belongs to, so for
+// them Keys only holds that key and Type is the type of the value decoded.
+type UnknownKeysError struct {
+	Type reflect.Type // struct type the object was decoded into
+	Keys []string     // unclaimed keys, in document order
+}
+
+func (e *UnknownKeysError) Error() string {
+	quoted := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		quoted[i] = strconv.Quote(key)
+	}
+	return fmt.Sprintf("jsonpat: unknown keys %s for type %s", strings.Join(quoted, ", "), e.Type)
+}
+
+// A ConflictError is returned when several keys of an object match a dynamic
+// scalar field with the `unique` option.
+type ConflictError struct {
+	Type  reflect.Type // struct type the object was decoded into
+	Field string       // name of the field
+	Keys  []string     // matching keys, in document order
+}
+
+func (e *ConflictError) Error() string {
+	quoted := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		quoted[i] = strconv.Quote(key)
+	}
+	return fmt.Sprintf("jsonpat: conflicting keys %s for unique field %s.%s", strings.Join(quoted, ", "), e.Type, e.Field)
+}
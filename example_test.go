@@ -151,3 +151,40 @@ func ExampleUnmarshal() {
 	// ScalarContains: 12345
 	// ScalarRegex:    true
 }
+
+func ExampleMarshal() {
+	type Metrics struct {
+		Host    string         `json:"host"`
+		Metrics map[string]int `jsonpat:"metric_,prefix"`
+	}
+
+	data, err := jsonpat.Marshal(Metrics{
+		Host:    "web-1",
+		Metrics: map[string]int{"metric_cpu": 73, "metric_mem": 41},
+	})
+	if err != nil {
+		log.Fatalf("Failed to marshal: %v", err)
+	}
+
+	fmt.Println(string(data))
+
+	// Output:
+	// {"host":"web-1","metric_cpu":73,"metric_mem":41}
+}
+
+func ExampleDecode() {
+	type Metrics struct {
+		Host    string         `json:"host"`
+		Metrics map[string]int `jsonpat:"metric_,prefix"`
+	}
+
+	metrics, err := jsonpat.Decode[Metrics]([]byte(`{"host": "web-1", "metric_cpu": 73}`))
+	if err != nil {
+		log.Fatalf("Failed to decode: %v", err)
+	}
+
+	fmt.Println(metrics.Host, metrics.Metrics["metric_cpu"])
+
+	// Output:
+	// web-1 73
+}
@@ -0,0 +1,64 @@
+package jsonpat
+
+import "io"
+
+// Entry is a json key and its value, as collected by a []Entry[T] jsonpat field.
+// Such fields keep every matching member of the object, key included, in the
+// order they appear in the input:
+//
+//	type Metrics struct {
+//		Values []jsonpat.Entry[int] `jsonpat:"val_,prefix"`
+//	}
+type Entry[T any] struct {
+	Key   string
+	Value T
+}
+
+// jsonpatEntry marks Entry types, since reflection can't name a generic type
+// without its type arguments.
+func (Entry[T]) jsonpatEntry() {}
+
+// Decode parses json data into a new value of type T, which must be a struct
+// type or a slice, array or map of structs, following the same rules as Unmarshal.
+// T isn't constrained, so other types such as Decode[int] still compile, and
+// fail when decoding like they would with Unmarshal.
+//
+//	data, err := jsonpat.Decode[MyData](body)
+func Decode[T any](data []byte) (T, error) {
+	var v T
+	err := Unmarshal(data, &v)
+	return v, err
+}
+
+// UnmarshalInto parses json data into the value v points to, following the same
+// rules as Unmarshal, so existing values such as initialised maps are decoded
+// into rather than replaced. Unlike Unmarshal, passing something other than a
+// pointer doesn't compile, though T is checked when decoding, as with Decode.
+//
+//	err := jsonpat.UnmarshalInto(body, &data)
+func UnmarshalInto[T any](data []byte, v *T) error {
+	return Unmarshal(data, v)
+}
+
+// DecodeReader reads a json value from r and parses it into a new value of type
+// T, which must be a struct type or a slice, array or map of structs, following
+// the same rules as Unmarshal.
+//
+// DecodeReader consumes r: it may read past the end of the value, so whatever
+// follows it is lost. To decode a stream of values, use a Decoder from
+// NewDecoder instead.
+func DecodeReader[T any](r io.Reader) (T, error) {
+	var v T
+	err := NewDecoder(r).Decode(&v)
+	return v, err
+}
+
+// MustDecode is like Decode but panics if data can't be decoded. It is intended
+// for tests and for initialising package level variables from static data.
+func MustDecode[T any](data []byte) T {
+	v, err := Decode[T](data)
+	if err != nil {
+		panic("jsonpat: MustDecode: " + err.Error())
+	}
+	return v
+}
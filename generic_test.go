@@ -0,0 +1,56 @@
+package jsonpat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	result, err := Decode[StreamRecord]([]byte(`{"id": "a", "dyn_x": 1}`))
+	require.NoError(t, err)
+	assert.Equal(t, StreamRecord{ID: "a", Dynamic: map[string]int{"dyn_x": 1}}, result)
+
+	_, err = Decode[StreamRecord]([]byte(`{"id": 1}`))
+	assert.Error(t, err, "Expected error for known field type mismatch")
+
+	_, err = Decode[int]([]byte(`1`))
+	assert.Error(t, err, "Expected error for non-struct type")
+
+	records, err := Decode[[]StreamRecord]([]byte(`[{"id": "a", "dyn_x": 1}, {"id": "b"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []StreamRecord{
+		{ID: "a", Dynamic: map[string]int{"dyn_x": 1}},
+		{ID: "b", Dynamic: map[string]int{}},
+	}, records)
+}
+
+func TestUnmarshalInto(t *testing.T) {
+	result := StreamRecord{ID: "old", Dynamic: map[string]int{"dyn_kept": 1}}
+	require.NoError(t, UnmarshalInto([]byte(`{"dyn_x": 2}`), &result))
+	assert.Equal(t, StreamRecord{ID: "old", Dynamic: map[string]int{"dyn_kept": 1, "dyn_x": 2}}, result)
+
+	var n int
+	assert.Error(t, UnmarshalInto([]byte(`1`), &n), "Expected error for non-struct type")
+
+	assert.Error(t, UnmarshalInto[StreamRecord]([]byte(`{}`), nil), "Expected error for nil pointer")
+}
+
+func TestDecodeReader(t *testing.T) {
+	result, err := DecodeReader[StreamRecord](strings.NewReader(`{"id": "a", "dyn_x": 1}`))
+	require.NoError(t, err)
+	assert.Equal(t, StreamRecord{ID: "a", Dynamic: map[string]int{"dyn_x": 1}}, result)
+
+	_, err = DecodeReader[StreamRecord](strings.NewReader(``))
+	assert.Error(t, err, "Expected error for empty input")
+}
+
+func TestMustDecode(t *testing.T) {
+	assert.Equal(t, "a", MustDecode[StreamRecord]([]byte(`{"id": "a"}`)).ID)
+
+	assert.PanicsWithValue(t, "jsonpat: MustDecode: unexpected end of JSON input", func() {
+		MustDecode[StreamRecord]([]byte(`{"id": "a"`))
+	})
+}
@@ -0,0 +1,125 @@
+// Package fold matches strings under Unicode simple case folding, comparing
+// them rune by rune like strings.EqualFold does.
+package fold
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Key returns a canonical form of s, such that two strings have the same key
+// exactly when they are equal under simple case folding.
+func Key(s string) string {
+	return strings.Map(canonicalRune, s)
+}
+
+// AppendKey appends the key of s, as returned by Key, to dst and returns the
+// extended buffer. Looking a map up with the converted result doesn't allocate
+// when dst has room for the key, which makes it cheaper than Key on hot paths.
+func AppendKey(dst []byte, s string) []byte {
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			dst = append(dst, byte(canonicalRune(r)))
+			continue
+		}
+		dst = utf8.AppendRune(dst, canonicalRune(r))
+	}
+	return dst
+}
+
+// HasPrefix reports whether s begins with prefix, ignoring case.
+func HasPrefix(s, prefix string) bool {
+	_, ok := TrimPrefix(s, prefix)
+	return ok
+}
+
+// HasSuffix reports whether s ends with suffix, ignoring case.
+func HasSuffix(s, suffix string) bool {
+	_, ok := TrimSuffix(s, suffix)
+	return ok
+}
+
+// TrimPrefix returns s without prefix, reporting whether s begins with it,
+// ignoring case.
+func TrimPrefix(s, prefix string) (string, bool) {
+	for prefix != "" {
+		if s == "" {
+			return "", false
+		}
+		r1, n1 := utf8.DecodeRuneInString(s)
+		r2, n2 := utf8.DecodeRuneInString(prefix)
+		if !equalRune(r1, r2) {
+			return "", false
+		}
+		s, prefix = s[n1:], prefix[n2:]
+	}
+	return s, true
+}
+
+// TrimSuffix returns s without suffix, reporting whether s ends with it,
+// ignoring case.
+func TrimSuffix(s, suffix string) (string, bool) {
+	for suffix != "" {
+		if s == "" {
+			return "", false
+		}
+		r1, n1 := utf8.DecodeLastRuneInString(s)
+		r2, n2 := utf8.DecodeLastRuneInString(suffix)
+		if !equalRune(r1, r2) {
+			return "", false
+		}
+		s, suffix = s[:len(s)-n1], suffix[:len(suffix)-n2]
+	}
+	return s, true
+}
+
+// Contains reports whether substr is within s, ignoring case.
+func Contains(s, substr string) bool {
+	for {
+		if HasPrefix(s, substr) {
+			return true
+		}
+		if s == "" {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(s)
+		s = s[n:]
+	}
+}
+
+// equalRune reports whether r1 and r2 are equal under simple case folding.
+func equalRune(r1, r2 rune) bool {
+	if r1 == r2 {
+		return true
+	}
+	if r1 < utf8.RuneSelf && r2 < utf8.RuneSelf {
+		return 'a' <= r1|0x20 && r1|0x20 <= 'z' && r1|0x20 == r2|0x20
+	}
+
+	for r := unicode.SimpleFold(r1); r != r1; r = unicode.SimpleFold(r) {
+		if r == r2 {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalRune returns the smallest rune that r is equal to under simple case
+// folding.
+func canonicalRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		if 'a' <= r && r <= 'z' {
+			return r - ('a' - 'A')
+		}
+		return r
+	}
+
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
@@ -0,0 +1,71 @@
+package fold
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPrefix(t *testing.T) {
+	assert.True(t, HasPrefix("X-Dyn-Foo", "x-dyn-"))
+	assert.True(t, HasPrefix("x-dyn-foo", "X-DYN-"))
+	assert.True(t, HasPrefix("ÉTÉ_chaud", "été_"))
+	assert.True(t, HasPrefix("Key", "key"), "the Kelvin sign folds to k")
+	assert.True(t, HasPrefix("anything", ""))
+	assert.False(t, HasPrefix("x-dy", "x-dyn-"))
+	assert.False(t, HasPrefix("y-dyn-foo", "x-dyn-"))
+	assert.False(t, HasPrefix("@key", "`key"), "only letters fold in ASCII")
+}
+
+func TestHasSuffix(t *testing.T) {
+	assert.True(t, HasSuffix("Foo_SUFFIX", "_suffix"))
+	assert.True(t, HasSuffix("straße_ΣΊΣΥΦΟΣ", "σίσυφος"))
+	assert.False(t, HasSuffix("fix", "_suffix"))
+	assert.False(t, HasSuffix("foo_suffiy", "_suffix"))
+}
+
+func TestContains(t *testing.T) {
+	assert.True(t, Contains("a_VAL_b", "_val_"))
+	assert.True(t, Contains("_Val_", "_val_"))
+	assert.True(t, Contains("abc", ""))
+	assert.False(t, Contains("a_val", "_val_"))
+	assert.False(t, Contains("", "x"))
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, Key("user_id"), Key("USER_ID"))
+	assert.Equal(t, Key("key"), Key("\u212aey"), "the Kelvin sign folds to k")
+	assert.Equal(t, Key("ſ"), Key("s"))
+	assert.Equal(t, Key("σίσυφος"), Key("ΣΊΣΥΦΟΣ"))
+	assert.Equal(t, Key("ς"), Key("Σ"))
+	assert.NotEqual(t, Key("straße"), Key("STRASSE"))
+	assert.NotEqual(t, Key("@"), Key("`"))
+}
+
+func TestAppendKey(t *testing.T) {
+	for _, s := range []string{"", "user_id", "\u212aey", "ſ", "σίσυφος", "straße", "\xff"} {
+		assert.Equal(t, Key(s), string(AppendKey(nil, s)), s)
+	}
+
+	m := map[string]bool{Key("user_id"): true}
+	allocs := testing.AllocsPerRun(100, func() {
+		var buf [64]byte
+		_ = m[string(AppendKey(buf[:0], "User_Id"))]
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestTrim(t *testing.T) {
+	rest, ok := TrimPrefix("X-Dyn-Foo", "x-dyn-")
+	assert.True(t, ok)
+	assert.Equal(t, "Foo", rest)
+
+	rest, ok = TrimSuffix("Foo_ΣΊΣΥΦΟΣ", "_σίσυφος")
+	assert.True(t, ok)
+	assert.Equal(t, "Foo", rest)
+
+	_, ok = TrimPrefix("y-dyn-foo", "x-dyn-")
+	assert.False(t, ok)
+	_, ok = TrimSuffix("fix", "_suffix")
+	assert.False(t, ok)
+}
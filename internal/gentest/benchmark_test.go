@@ -0,0 +1,47 @@
+package gentest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jamieyoung5/jsonpat"
+)
+
+var benchRecord = []byte(`{
+	"id": "bench", "count": 7, "quoted": "42", "base_field": "b",
+	"dyn_a": 1, "dyn_b": 2, "dyn_c": 3, "x_lbl_y": "label", "m_12": 12, "a_sfx": true,
+	"sc_a": "scalar", "exact": 1.5, "other": {"nested": [1, 2, 3]},
+	"item": {"name": "item", "attr_a": 1, "attr_b": 2}
+}`)
+
+func BenchmarkRecord_Generated(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result Record
+		if err := json.Unmarshal(benchRecord, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRecord_Reflective(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result reflectiveRecord
+		if err := jsonpat.Unmarshal(benchRecord, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRecord_GeneratedDirect skips the validation pass encoding/json makes
+// over the input before handing it to UnmarshalJSON.
+func BenchmarkRecord_GeneratedDirect(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result Record
+		if err := result.UnmarshalJSON(benchRecord); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
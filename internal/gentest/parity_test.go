@@ -0,0 +1,354 @@
+package gentest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jamieyoung5/jsonpat"
+)
+
+// The reflective types have the fields of the generated types without their
+// methods, so jsonpat decodes and encodes them through reflection.
+type (
+	reflectiveRecord    Record
+	reflectivePattern   Pattern
+	reflectiveKeyed     Keyed
+	reflectiveCollected Collected
+	reflectivePrices    Prices
+	reflectiveCaptured  Captured
+	reflectiveTemplated Templated
+	reflectiveEmbedding Embedding
+)
+
+var recordInputs = []string{
+	`{}`,
+	`null`,
+	`{"id": "r1", "count": 3, "quoted": "42", "ptr": 1.5, "Untagged": true, "base_field": "b"}`,
+	`{"dyn_a": 1, "dyn_b": 2, "x_lbl_y": "l", "m_1": 1, "m_1234": 2, "a_sfx": [1, {"b": null}]}`,
+	`{"sc_b": "second", "sc_a": "first", "sc_c": "third", "exact": 2.5, "dyn_sc_": 1}`,
+	`{"item": {"name": "n", "attr_x": 1, "other": true}, "items": [{"name": "i", "attr_y": 2}, null]}`,
+	`{"unknown": {"nested": [1, 2]}, "id": "r2", "dyn_x": 5, "-": "ignored", "Ignored": "x"}`,
+	`{"quoted": null, "ptr": null, "item": null, "items": null}`,
+	`{"ID": "folded", "Count": 1, "ITEM": {"NAME": "n"}, "untagged": true, "Id": "again", "id": "exact"}`,
+	`{"id": 1}`,
+	`{"dyn_a": "not a number"}`,
+	`{"quoted": 42}`,
+	`{"sc_a": 1}`,
+	`[1, 2]`,
+	`{"id": "r3",}`,
+	`{"unknown": [1, }`,
+}
+
+func TestUnmarshalParity(t *testing.T) {
+	for _, input := range recordInputs {
+		t.Run(input, func(t *testing.T) {
+			var generated Record
+			generatedErr := json.Unmarshal([]byte(input), &generated)
+
+			var reflective reflectiveRecord
+			reflectiveErr := jsonpat.Unmarshal([]byte(input), &reflective)
+
+			if reflectiveErr != nil {
+				assert.Error(t, generatedErr, "reflective path failed with %v", reflectiveErr)
+				return
+			}
+			require.NoError(t, generatedErr)
+			assert.Equal(t, Record(reflective), generated)
+		})
+	}
+}
+
+func TestMarshalParity(t *testing.T) {
+	ptr := 2.5
+	records := []Record{
+		{},
+		{
+			Base:      Base{BaseField: "b", Suffixed: map[string]any{"x_sfx": "s"}},
+			ID:        "r1",
+			Count:     1,
+			Quoted:    42,
+			Ptr:       &ptr,
+			Ignored:   "not written",
+			Untagged:  true,
+			Item:      Item{Name: "n", Attrs: map[string]int{"attr_b": 2, "attr_a": 1}},
+			Items:     []Item{{Name: "i"}},
+			Prefixed:  map[string]int{"dyn_b": 2, "dyn_a": 1, "id": 3},
+			Contained: Labels{"a_lbl_b": "l"},
+			Matched:   map[string]int{"m_7": 7},
+			Scalar:    "scalar",
+			Literal:   1.5,
+			Fallback:  "shadowed by Scalar",
+			Rest:      map[string]json.RawMessage{"zeta": json.RawMessage(`[1]`), "dyn_a": json.RawMessage(`0`)},
+		},
+		{Fallback: "written", Item: Item{Attrs: map[string]int{}}},
+	}
+
+	for _, record := range records {
+		generated, err := json.Marshal(record)
+		require.NoError(t, err)
+
+		reflective, err := jsonpat.Marshal(reflectiveRecord(record))
+		require.NoError(t, err)
+		assert.Equal(t, string(reflective), string(generated))
+	}
+
+	_, generatedErr := json.Marshal(Pattern{Value: 1})
+	_, reflectiveErr := jsonpat.Marshal(reflectivePattern{Value: 1})
+	assert.Error(t, generatedErr)
+	assert.Error(t, reflectiveErr)
+}
+
+func TestPatternParity(t *testing.T) {
+	input := []byte(`{
+		"val_2": 2, "val_1": 1, "v_ab1": "x", "v_ab": "y", "val_x": 3,
+		"cpu.a.p99": 1, "mem..p90": 2, "disk.a.p99": 3, "cpu.a.p9x": 4,
+		"env_b_url": "b", "env_a_url": "a", "env_ab_url": "ab",
+		"X-Meta-Owner": "o", "x-meta-team": "t", "X-TRACE": "tr",
+		"cpu_0": 1, "mem_total": 2, "disk1": 3, "disk_x": 4, "team_owner": "t", "owner_1": "o",
+		"pub_a": 1, "PUB-b": 2, "pub_c_INTERNAL": 3, "Pub-d-tmp": 4,
+		"user_42": "u", "a_one": "a", "req_total": 5, "ERR_Total": 6, "trim_x": 7
+	}`)
+
+	var generated Pattern
+	require.NoError(t, json.Unmarshal(input, &generated))
+
+	var reflective reflectivePattern
+	require.NoError(t, jsonpat.Unmarshal(input, &reflective))
+	assert.Equal(t, Pattern(reflective), generated)
+	assert.Equal(t, 1, generated.Value)
+	assert.Equal(t, map[string]float64{"cpu.a.p99": 1, "mem..p90": 2}, generated.Globbed)
+	assert.Equal(t, "a", generated.EnvURL)
+	assert.Equal(t, map[string]string{"X-Meta-Owner": "o", "x-meta-team": "t"}, generated.Headers)
+	assert.Equal(t, "tr", generated.Trace)
+	assert.Equal(t, map[string]int{"cpu_0": 1, "mem_total": 2, "disk1": 3}, generated.Resources)
+	assert.Equal(t, "o", generated.Owner)
+	assert.Equal(t, map[string]int{"pub_a": 1, "PUB-b": 2}, generated.Public)
+	assert.Equal(t, map[string]string{"42": "u", "one": "a"}, generated.Users)
+	assert.Equal(t, map[string]int{"req": 5, "ERR": 6, "mem": 2}, generated.Totals)
+	assert.Equal(t, map[string]int{"x": 7}, generated.Trimmed)
+
+	value := Pattern{
+		Values:  map[string]string{"v_a1": "a"},
+		Trace:   "tr",
+		Owner:   "o",
+		Users:   map[string]string{"7": "u"},
+		Totals:  map[string]int{"b": 1, "a_b": 2},
+		Trimmed: map[string]int{"x": 1},
+	}
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"x-trace":"tr","owner":"o","v_a1":"a","user_7":"u","a_b_TOTAL":2,"b_TOTAL":1,"trim_x":1}`, string(data))
+
+	reflectiveData, err := jsonpat.Marshal(reflectivePattern(value))
+	require.NoError(t, err)
+	assert.Equal(t, string(reflectiveData), string(data))
+}
+
+func TestKeyedParity(t *testing.T) {
+	input := []byte(`{"port_80": "http", "port_-1": "x", "code_200": true, "v1.2": "one", "eu_region": 1}`)
+
+	var generated Keyed
+	require.NoError(t, json.Unmarshal(input, &generated))
+
+	var reflective reflectiveKeyed
+	require.NoError(t, jsonpat.Unmarshal(input, &reflective))
+	assert.Equal(t, Keyed(reflective), generated)
+	assert.Equal(t, map[int]string{80: "http", -1: "x"}, generated.Ports)
+	assert.Equal(t, map[uint16]bool{200: true}, generated.Codes)
+	assert.Equal(t, map[Version]string{{Major: 1, Minor: 2}: "one"}, generated.Versions)
+	assert.Equal(t, map[Region]int{"eu_region": 1}, generated.Regions)
+
+	data, err := json.Marshal(generated)
+	require.NoError(t, err)
+	assert.Equal(t, `{"port_-1":"x","port_80":"http","code_200":true,"v1.2":"one","eu_region":1}`, string(data))
+
+	reflectiveData, err := jsonpat.Marshal(reflective)
+	require.NoError(t, err)
+	assert.Equal(t, string(reflectiveData), string(data))
+
+	for _, invalid := range []string{`{"port_http": "x"}`, `{"code_70000": true}`, `{"vx": "x"}`} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &generated), invalid)
+		assert.Error(t, jsonpat.Unmarshal([]byte(invalid), &reflective), invalid)
+	}
+}
+
+func TestCollectedParity(t *testing.T) {
+	input := []byte(`{
+		"val_c": 3, "num_b": 20, "val_a": 1, "num_x": 0, "val_b": 2,
+		"item_z": {"name": "z", "attr_q": 1}, "item_a": {"name": "a"},
+		"lbl_z": "last", "lbl_a": "first", "raw_b": [2], "raw_a": [1]
+	}`)
+
+	var generated Collected
+	require.NoError(t, json.Unmarshal(input, &generated))
+
+	var reflective reflectiveCollected
+	require.NoError(t, jsonpat.Unmarshal(input, &reflective))
+	assert.Equal(t, Collected(reflective), generated)
+	assert.Equal(t, []int{3, 2}, generated.Values)
+	assert.Equal(t, []jsonpat.Entry[int]{{Key: "val_c", Value: 3}, {Key: "num_b", Value: 20}, {Key: "val_b", Value: 2}}, generated.Entries)
+	assert.Equal(t, []jsonpat.Entry[string]{{Key: "lbl_z", Value: "last"}, {Key: "lbl_a", Value: "first"}}, generated.Ordered)
+
+	for _, invalid := range []string{`{"val_a": 1, "val_b": "x"}`, `{"item_a": []}`} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &generated), invalid)
+		assert.Error(t, jsonpat.Unmarshal([]byte(invalid), &reflective), invalid)
+	}
+
+	value := Collected{
+		Entries: []jsonpat.Entry[int]{{Key: "val_z", Value: 26}, {Key: "val_a", Value: 1}, {Key: "val_z", Value: 0}},
+		Items:   []jsonpat.Entry[Item]{{Key: "item_b", Value: Item{Name: "b", Attrs: map[string]int{"attr_x": 1}}}},
+		Labels:  map[string]string{"lbl_a": "a"},
+		Ordered: []jsonpat.Entry[string]{{Key: "lbl_b", Value: "b"}, {Key: "lbl_a", Value: "shadowed"}},
+	}
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"lbl_a":"a","val_z":26,"val_a":1,"item_b":{"name":"b","attr_x":1},"lbl_b":"b"}`, string(data))
+
+	reflectiveData, err := jsonpat.Marshal(reflectiveCollected(value))
+	require.NoError(t, err)
+	assert.Equal(t, string(reflectiveData), string(data))
+
+	_, generatedErr := json.Marshal(Collected{Values: []int{1}})
+	_, reflectiveErr := jsonpat.Marshal(reflectiveCollected{Values: []int{1}})
+	assert.Error(t, generatedErr)
+	assert.ErrorContains(t, generatedErr, reflectiveErr.Error())
+}
+
+func TestPricesParity(t *testing.T) {
+	inputs := []string{
+		`{"price_usd": "1", "cost_a": "a", "cost_c": "c", "cost_b": "b", "fee_z": "z", "fee_a": "a", "tax_only": "t"}`,
+		`{"price_usd": "1", "price_eur": "2"}`,
+		`{"cost_a": "1", "cost_a": "2", "price_b": "b", "price_b": "c"}`,
+		`{"tax_usd": "1", "tax_eur": "2", "tax_gbp": "3"}`,
+		`{"price_usd": "1", "price_eur": "2", "price_gbp": "3"}`,
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			var generated Prices
+			generatedErr := json.Unmarshal([]byte(input), &generated)
+
+			var reflective reflectivePrices
+			reflectiveErr := jsonpat.Unmarshal([]byte(input), &reflective)
+
+			if reflectiveErr != nil {
+				var conflict *jsonpat.ConflictError
+				require.ErrorAs(t, generatedErr, &conflict)
+				assert.ErrorContains(t, reflectiveErr, strings.Join(conflict.Keys, `", "`))
+				return
+			}
+			require.NoError(t, generatedErr)
+			assert.Equal(t, Prices(reflective), generated)
+		})
+	}
+}
+
+func TestCapturedParity(t *testing.T) {
+	input := []byte(`{
+		"host": "h", "eu_cpu": 0.5, "us_mem_3": 1,
+		"s:cpu": 2, "s:mem@ap#4": 3, "E_disk@eu": 4, "e_net@us#5": 5,
+		"latest_eu_cpu": 6, "latest_us_mem_7": 7
+	}`)
+
+	var generated Captured
+	require.NoError(t, json.Unmarshal(input, &generated))
+
+	var reflective reflectiveCaptured
+	require.NoError(t, jsonpat.Unmarshal(input, &reflective))
+	assert.Equal(t, Captured(reflective), generated)
+	assert.Equal(t, map[string]Sample{
+		"eu_cpu":   {Region: "eu", Metric: "cpu", Value: 0.5},
+		"us_mem_3": {Region: "us", Metric: "mem", Shard: 3, Value: 1},
+	}, generated.ByKey)
+	assert.Equal(t, []Sample{{Metric: "cpu", Value: 2}, {Region: "ap", Metric: "mem", Shard: 4, Value: 3}}, generated.Samples)
+	assert.Equal(t, []jsonpat.Entry[Sample]{
+		{Key: "E_disk@eu", Value: Sample{Region: "eu", Metric: "disk", Value: 4}},
+		{Key: "e_net@us#5", Value: Sample{Region: "us", Metric: "net", Shard: 5, Value: 5}},
+	}, generated.Entries)
+	assert.Equal(t, Sample{Region: "us", Metric: "mem", Shard: 7, Value: 7}, generated.Latest)
+
+	for _, invalid := range []string{`{"eu_cpu_300": 1}`, `{"s:x@eu#256": 1}`, `{"latest_eu_cpu_999": 1}`, `{"eu_cpu": "x"}`} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &generated), invalid)
+		assert.Error(t, jsonpat.Unmarshal([]byte(invalid), &reflective), invalid)
+	}
+
+	value := Captured{
+		Host:    "h",
+		ByKey:   map[string]Sample{"eu_cpu": {Region: "ignored", Value: 0.5}},
+		Entries: []jsonpat.Entry[Sample]{{Key: "E_disk@eu", Value: Sample{Value: 4}}},
+	}
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+
+	reflectiveData, err := jsonpat.Marshal(reflectiveCaptured(value))
+	require.NoError(t, err)
+	assert.Equal(t, string(reflectiveData), string(data))
+	assert.Contains(t, string(data), `"eu_cpu":0.5,"E_disk@eu":4`)
+}
+
+func TestTemplatedParity(t *testing.T) {
+	input := []byte(`{
+		"host": "h", "us_cpu": 0.5, "us_mem": 0.25, "eu_disk_free": 2,
+		"shard.a.1.reads": 3, "Shard/a/2/writes": 4, "shard.b.1.reads": 5,
+		"s:eu:cpu#3": 6, "latest_cpu": 7
+	}`)
+
+	var generated Templated
+	require.NoError(t, json.Unmarshal(input, &generated))
+
+	var reflective reflectiveTemplated
+	require.NoError(t, jsonpat.Unmarshal(input, &reflective))
+	assert.Equal(t, Templated(reflective), generated)
+	assert.Equal(t, map[Region]map[string]float64{"us": {"cpu": 0.5, "mem": 0.25}, "eu": {"disk_free": 2}}, generated.ByRegion)
+	assert.Equal(t, map[string]map[int]map[string]int{"a": {1: {"reads": 3}, 2: {"writes": 4}}, "b": {1: {"reads": 5}}}, generated.Shards)
+	assert.Equal(t, []Sample{{Region: "eu", Metric: "cpu", Shard: 3, Value: 6}}, generated.Samples)
+	assert.Equal(t, 7.0, generated.Latest)
+
+	for _, invalid := range []string{`{"shard.a.x.reads": 1}`, `{"us_cpu": "x"}`, `{"s:eu:cpu#256": 1}`} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &generated), invalid)
+		assert.Error(t, jsonpat.Unmarshal([]byte(invalid), &reflective), invalid)
+	}
+
+	value := Templated{
+		ByRegion: map[Region]map[string]float64{"us": {"mem": 0.25, "cpu": 0.5}, "eu": nil},
+		Shards:   map[string]map[int]map[string]int{"a": {10: {"reads": 3}, 2: {"writes": 4}}},
+	}
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"host":"","us_cpu":0.5,"us_mem":0.25,"shard.a.10.reads":3,"shard.a.2.writes":4}`, string(data))
+
+	reflectiveData, err := jsonpat.Marshal(reflectiveTemplated(value))
+	require.NoError(t, err)
+	assert.Equal(t, string(reflectiveData), string(data))
+
+	ambiguous := Templated{ByRegion: map[Region]map[string]float64{"u_s": {"cpu": 1}}}
+	_, generatedErr := json.Marshal(ambiguous)
+	_, reflectiveErr := jsonpat.Marshal(reflectiveTemplated(ambiguous))
+	require.Error(t, reflectiveErr)
+	assert.ErrorContains(t, generatedErr, reflectiveErr.Error())
+}
+
+func TestEmbeddingParity(t *testing.T) {
+	input := []byte(`{"owner": "o", "Kind": "k", "created": "c", "tags": {"env": "e"}, "env": "x", "dyn_a": 1}`)
+
+	var generated Embedding
+	require.NoError(t, json.Unmarshal(input, &generated))
+
+	var reflective reflectiveEmbedding
+	require.NoError(t, jsonpat.Unmarshal(input, &reflective))
+	assert.Equal(t, Embedding(reflective), generated)
+	assert.Equal(t, meta{Owner: "o"}, generated.meta, "Duplicate Kind fields at the same depth are dropped")
+	assert.Equal(t, Tags{Env: "e"}, generated.Tags)
+
+	data, err := json.Marshal(generated)
+	require.NoError(t, err)
+	assert.Equal(t, `{"owner":"o","created":"c","tags":{"env":"e"},"dyn_a":1}`, string(data))
+
+	reflectiveData, err := jsonpat.Marshal(reflective)
+	require.NoError(t, err)
+	assert.Equal(t, string(reflectiveData), string(data))
+}
@@ -0,0 +1,164 @@
+// Package gentest holds structs whose methods are generated by jsonpat-gen, to
+// check that the generated code behaves like the reflective path.
+package gentest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jamieyoung5/jsonpat"
+)
+
+//go:generate go run ../../cmd/jsonpat-gen -output types_jsonpat.go
+
+// Base is embedded in Record, so its fields are generated as part of Record.
+type Base struct {
+	BaseField string         `json:"base_field"`
+	Suffixed  map[string]any `jsonpat:"_sfx,suffix"`
+}
+
+type Labels map[string]string
+
+type Record struct {
+	Base
+	ID       string   `json:"id"`
+	Count    int      `json:"count,omitempty"`
+	Quoted   int64    `json:"quoted,string"`
+	Ptr      *float64 `json:"ptr,omitempty"`
+	Ignored  string   `json:"-"`
+	Untagged bool
+	Item     Item   `json:"item"`
+	Items    []Item `json:"items"`
+
+	Prefixed  map[string]int `jsonpat:"dyn_,prefix"`
+	Contained Labels         `jsonpat:"_lbl_,contains"`
+	Matched   map[string]int `jsonpat:"^m_\\d{1,3}$,regex"`
+
+	Scalar   string  `jsonpat:"sc_,prefix"`
+	Literal  float64 `jsonpat:"^exact$,regex"`
+	Fallback string  `jsonpat:"sc_,prefix"`
+
+	Rest map[string]json.RawMessage `jsonpat:",remaining"`
+}
+
+// Item is decoded through its own generated methods when nested in Record.
+type Item struct {
+	Name  string         `json:"name"`
+	Attrs map[string]int `jsonpat:"attr_,prefix"`
+}
+
+type Pattern struct {
+	Values map[string]string `jsonpat:"^v_[a-z]+\\d$,regex"`
+	Value  int               `jsonpat:"^val_\\d+$,regex"`
+
+	Globbed map[string]float64 `jsonpat:"{cpu,mem}.*.p9[0-9],glob"`
+	EnvURL  string             `jsonpat:"env_?_url,glob"`
+
+	Headers map[string]string `jsonpat:"x-meta-,prefix,ci"`
+	Trace   string            `jsonpat:"^x-trace$,regex,ci"`
+
+	Resources map[string]int `jsonpat:"cpu_,prefix|mem_,prefix|^disk\\d+$,regex"`
+	Owner     string         `jsonpat:"^owner_\\d$,regex|owner,suffix"`
+	Public    map[string]int `jsonpat:"pub_,prefix|pub-,prefix,ci,exclude=*_internal,exclude=*-tmp"`
+
+	Users   map[string]string `jsonpat:"^(?:a|b)_(\\w+)$,regex|^user_(?P<key>\\d+)$,regex,trim"`
+	Totals  map[string]int    `jsonpat:"_TOTAL,suffix,ci,trim"`
+	Trimmed map[string]int    `jsonpat:"trim_,prefix,trim"`
+}
+
+// Version is a map key decoded and encoded through its text methods.
+type Version struct {
+	Major, Minor int
+}
+
+func (v *Version) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%d", v.Major, v.Minor)), nil
+}
+
+type Region string
+
+// Keyed has dynamic map fields whose keys aren't plain strings.
+type Keyed struct {
+	Ports    map[int]string     `jsonpat:"port_,prefix,trim"`
+	Codes    map[uint16]bool    `jsonpat:"^code_(\\d+)$,regex,trim"`
+	Versions map[Version]string `jsonpat:"v,prefix,trim"`
+	Regions  map[Region]int     `jsonpat:"_region,suffix"`
+}
+
+// Collected has dynamic slice fields, which keep every matching value in
+// document order.
+type Collected struct {
+	First   int                     `jsonpat:"val_,prefix"`
+	Values  []int                   `jsonpat:"val_,prefix"`
+	Entries []jsonpat.Entry[int]    `jsonpat:"val_,prefix|num_,prefix,exclude=num_x"`
+	Items   []jsonpat.Entry[Item]   `jsonpat:"item_,prefix"`
+	Labels  map[string]string       `jsonpat:"lbl_,prefix"`
+	Ordered []jsonpat.Entry[string] `jsonpat:"lbl_,prefix"`
+	Raw     json.RawMessage         `jsonpat:"raw_,prefix"`
+}
+
+// Prices has dynamic scalar fields choosing between several matching keys.
+type Prices struct {
+	First    string `jsonpat:"price_,prefix"`
+	Last     string `jsonpat:"cost_,prefix,last"`
+	Document string `jsonpat:"fee_,prefix,document-order"`
+	Unique   string `jsonpat:"tax_,prefix,unique"`
+	Shared   string `jsonpat:"price_,prefix,unique"`
+}
+
+// Sample is a capture struct: its group fields are filled from the named groups
+// of the regex matching the key holding it, and Value holds the key's value.
+type Sample struct {
+	Region Region `jsonpat:"group=region"`
+	Metric string `jsonpat:"group=metric"`
+	Shard  uint8  `jsonpat:"group=shard"`
+	Value  float64
+}
+
+// Captured has dynamic fields holding capture structs.
+type Captured struct {
+	Host    string                  `json:"host"`
+	ByKey   map[string]Sample       `jsonpat:"^(?P<region>[a-z]+)_(?P<metric>[a-z]+)(?:_(?P<shard>\\d+))?$,regex"`
+	Samples []Sample                `jsonpat:"^s:(?P<metric>[a-z]+)$,regex|^s:(?P<metric>[a-z]+)@(?P<region>[a-z]+)#(?P<shard>\\d+)$,regex"`
+	Entries []jsonpat.Entry[Sample] `jsonpat:"^E_(?P<metric>[a-z]+)@(?P<region>[a-z]+)(?:#(?P<shard>\\d+))?$,regex,ci"`
+	Latest  Sample                  `jsonpat:"^latest_(?P<region>[a-z]+)_(?P<metric>[a-z]+)(?:_(?P<shard>\\d+))?$,regex,last"`
+}
+
+// Templated has dynamic fields matched by key templates, whose map fields nest
+// one level per placeholder.
+type Templated struct {
+	Host     string                            `json:"host"`
+	ByRegion map[Region]map[string]float64     `jsonpat:"{region}_{metric},template"`
+	Shards   map[string]map[int]map[string]int `jsonpat:"shard.{name}.{n}.{stat},template|SHARD/{name}/{n}/{stat},template,ci"`
+	Samples  []Sample                          `jsonpat:"s:{region}:{metric}#{shard},template"`
+	Latest   float64                           `jsonpat:"latest_{metric},template"`
+}
+
+type meta struct {
+	Owner string `json:"owner"`
+	Kind  string
+}
+
+type audit struct {
+	Kind    string
+	Created string `json:"created"`
+}
+
+type Tags struct {
+	Env string `json:"env"`
+}
+
+// Embedding selects the fields of its embedded structs like encoding/json:
+// those of unexported embeds are promoted, Tags is named by its tag, and the
+// Kind fields of meta and audit cancel out.
+type Embedding struct {
+	meta
+	audit
+	Tags `json:"tags"`
+	Dyn  map[string]int `jsonpat:"dyn_,prefix"`
+}
@@ -0,0 +1,1228 @@
+// Code generated by jsonpat-gen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/jsonpatrt"
+)
+
+var jsonpatRecordLiteralRe = regexp.MustCompile(`^exact$`)
+
+var jsonpatRecordMatchedRe = regexp.MustCompile(`^m_\d{1,3}$`)
+
+var jsonpatRecordKnown = jsonpatrt.NewKnownKeys("base_field", "id", "count", "quoted", "ptr", "Untagged", "item", "items")
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Record) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.Base.Suffixed)
+	jsonpatrt.InitMap(&x.Prefixed)
+	jsonpatrt.InitMap(&x.Contained)
+	jsonpatrt.InitMap(&x.Matched)
+	jsonpatrt.InitMap(&x.Rest)
+
+	dynamic := func(key string, value []byte) error {
+		claimed := false
+		if strings.HasSuffix(key, "_sfx") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Base.Suffixed, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.HasPrefix(key, "dyn_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Prefixed, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.Contains(key, "_lbl_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Contained, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatRecordMatchedRe.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Matched, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if claimed {
+			return nil
+		}
+		if err := jsonpatrt.SetEntry(x.Rest, key, value); err != nil {
+			return fmt.Errorf("failed to unmarshal remaining key %s: %w", key, err)
+		}
+		return nil
+	}
+
+	var pending []jsonpatrt.Member
+	err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		switch jsonpatRecordKnown.Lookup(key) {
+		case "base_field":
+			if err := json.Unmarshal(value, &x.Base.BaseField); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "id":
+			if err := json.Unmarshal(value, &x.ID); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "count":
+			if err := json.Unmarshal(value, &x.Count); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "quoted":
+			if err := jsonpatrt.UnmarshalQuoted(value, &x.Quoted); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "ptr":
+			if err := json.Unmarshal(value, &x.Ptr); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "Untagged":
+			if err := json.Unmarshal(value, &x.Untagged); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "item":
+			if err := json.Unmarshal(value, &x.Item); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "items":
+			if err := json.Unmarshal(value, &x.Items); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		}
+		if strings.HasPrefix(key, "sc_") || jsonpatRecordLiteralRe.MatchString(key) {
+			pending = append(pending, jsonpatrt.Member{Key: key, Value: value})
+			return nil
+		}
+		return dynamic(key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := make([]bool, len(pending))
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return strings.HasPrefix(key, "sc_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Scalar); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return jsonpatRecordLiteralRe.MatchString(key) }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Literal); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return strings.HasPrefix(key, "sc_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Fallback); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	for i, m := range pending {
+		if !taken[i] {
+			if err = dynamic(m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Record) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if err := w.Member("base_field", &x.Base.BaseField); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "base_field", err)
+	}
+	if err := w.Member("id", &x.ID); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "id", err)
+	}
+	if x.Count != 0 {
+		if err := w.Member("count", &x.Count); err != nil {
+			return nil, fmt.Errorf("failed to marshal known key %s: %w", "count", err)
+		}
+	}
+	if err := w.Quoted("quoted", &x.Quoted); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "quoted", err)
+	}
+	if x.Ptr != nil {
+		if err := w.Member("ptr", &x.Ptr); err != nil {
+			return nil, fmt.Errorf("failed to marshal known key %s: %w", "ptr", err)
+		}
+	}
+	if err := w.Member("Untagged", &x.Untagged); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "Untagged", err)
+	}
+	if err := w.Member("item", &x.Item); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "item", err)
+	}
+	if err := w.Member("items", &x.Items); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "items", err)
+	}
+	if x.Scalar != "" && !w.Written("sc_") {
+		if err := w.Member("sc_", &x.Scalar); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "sc_", err)
+		}
+	}
+	if x.Literal != 0 && !w.Written("exact") {
+		if err := w.Member("exact", &x.Literal); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "exact", err)
+		}
+	}
+	if x.Fallback != "" && !w.Written("sc_") {
+		if err := w.Member("sc_", &x.Fallback); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "sc_", err)
+		}
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Base.Suffixed); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Prefixed); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Contained); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Matched); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Rest); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+var jsonpatItemKnown = jsonpatrt.NewKnownKeys("name")
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Item) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.Attrs)
+
+	dynamic := func(key string, value []byte) error {
+		claimed := false
+		if strings.HasPrefix(key, "attr_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Attrs, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	return jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		switch jsonpatItemKnown.Lookup(key) {
+		case "name":
+			if err := json.Unmarshal(value, &x.Name); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		}
+		return dynamic(key, value)
+	})
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Item) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if err := w.Member("name", &x.Name); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "name", err)
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Attrs); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+var jsonpatPatternValueRe = regexp.MustCompile(`^val_\d+$`)
+
+var jsonpatPatternEnvURLRe = regexp.MustCompile(`(?s)^env_._url$`)
+
+var jsonpatPatternTraceRe = regexp.MustCompile(`(?i)^x-trace$`)
+
+var jsonpatPatternOwnerRe0 = regexp.MustCompile(`^owner_\d$`)
+
+var jsonpatPatternValuesRe = regexp.MustCompile(`^v_[a-z]+\d$`)
+
+var jsonpatPatternGlobbedRe = regexp.MustCompile(`(?s)^(?:cpu|mem)\..*\.p9[0-9]$`)
+
+var jsonpatPatternResourcesRe2 = regexp.MustCompile(`^disk\d+$`)
+
+var jsonpatPatternPublicExclude0 = regexp.MustCompile(`(?i)(?s)^.*_internal$`)
+
+var jsonpatPatternPublicExclude1 = regexp.MustCompile(`(?i)(?s)^.*-tmp$`)
+
+var jsonpatPatternUsersRe0 = regexp.MustCompile(`^(?:a|b)_(\w+)$`)
+
+var jsonpatPatternUsersRe1 = regexp.MustCompile(`^user_(?P<key>\d+)$`)
+
+// jsonpatPatternUsersKey returns the key x.Users stores the value of key under.
+func jsonpatPatternUsersKey(key string) string {
+	if groups := jsonpatPatternUsersRe0.FindStringSubmatch(key); groups != nil {
+		return groups[1]
+	}
+	if groups := jsonpatPatternUsersRe1.FindStringSubmatch(key); groups != nil {
+		return groups[1]
+	}
+	return key
+}
+
+// jsonpatPatternTotalsKey returns the key x.Totals stores the value of key under.
+func jsonpatPatternTotalsKey(key string) string {
+	if jsonpatrt.HasSuffixFold(key, "_TOTAL") {
+		return jsonpatrt.TrimSuffixFold(key, "_TOTAL")
+	}
+	return key
+}
+
+// jsonpatPatternTrimmedKey returns the key x.Trimmed stores the value of key under.
+func jsonpatPatternTrimmedKey(key string) string {
+	if strings.HasPrefix(key, "trim_") {
+		return strings.TrimPrefix(key, "trim_")
+	}
+	return key
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Pattern) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.Values)
+	jsonpatrt.InitMap(&x.Globbed)
+	jsonpatrt.InitMap(&x.Headers)
+	jsonpatrt.InitMap(&x.Resources)
+	jsonpatrt.InitMap(&x.Public)
+	jsonpatrt.InitMap(&x.Users)
+	jsonpatrt.InitMap(&x.Totals)
+	jsonpatrt.InitMap(&x.Trimmed)
+
+	dynamic := func(key string, value []byte) error {
+		claimed := false
+		if jsonpatPatternValuesRe.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Values, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatPatternGlobbedRe.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Globbed, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatrt.HasPrefixFold(key, "x-meta-") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Headers, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.HasPrefix(key, "cpu_") || strings.HasPrefix(key, "mem_") || jsonpatPatternResourcesRe2.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Resources, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if (jsonpatrt.HasPrefixFold(key, "pub_") || jsonpatrt.HasPrefixFold(key, "pub-")) && !jsonpatPatternPublicExclude0.MatchString(key) && !jsonpatPatternPublicExclude1.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Public, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatPatternUsersRe0.MatchString(key) || jsonpatPatternUsersRe1.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Users, jsonpatPatternUsersKey(key), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatrt.HasSuffixFold(key, "_TOTAL") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Totals, jsonpatPatternTotalsKey(key), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.HasPrefix(key, "trim_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Trimmed, jsonpatPatternTrimmedKey(key), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	var pending []jsonpatrt.Member
+	err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		if jsonpatPatternValueRe.MatchString(key) || jsonpatPatternEnvURLRe.MatchString(key) || jsonpatPatternTraceRe.MatchString(key) || jsonpatPatternOwnerRe0.MatchString(key) || strings.HasSuffix(key, "owner") {
+			pending = append(pending, jsonpatrt.Member{Key: key, Value: value})
+			return nil
+		}
+		return dynamic(key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := make([]bool, len(pending))
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return jsonpatPatternValueRe.MatchString(key) }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Value); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return jsonpatPatternEnvURLRe.MatchString(key) }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.EnvURL); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return jsonpatPatternTraceRe.MatchString(key) }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Trace); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool {
+		return jsonpatPatternOwnerRe0.MatchString(key) || strings.HasSuffix(key, "owner")
+	}); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Owner); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	for i, m := range pending {
+		if !taken[i] {
+			if err = dynamic(m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Pattern) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if x.Value != 0 {
+		return nil, errors.New("failed to marshal dynamic scalar field Value: cannot derive a key from regex pattern \"^val_\\\\d+$\"")
+	}
+	if x.EnvURL != "" {
+		return nil, errors.New("failed to marshal dynamic scalar field EnvURL: cannot derive a key from glob pattern \"env_?_url\"")
+	}
+	if x.Trace != "" && !w.Written("x-trace") {
+		if err := w.Member("x-trace", &x.Trace); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "x-trace", err)
+		}
+	}
+	if x.Owner != "" && !w.Written("owner") {
+		if err := w.Member("owner", &x.Owner); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "owner", err)
+		}
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Values); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Globbed); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Headers); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Resources); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Public); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteAffixedEntries(&w, x.Users, "user_", ""); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteAffixedEntries(&w, x.Totals, "", "_TOTAL"); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteAffixedEntries(&w, x.Trimmed, "trim_", ""); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+var jsonpatKeyedCodesRe = regexp.MustCompile(`^code_(\d+)$`)
+
+// jsonpatKeyedPortsKey returns the key x.Ports stores the value of key under.
+func jsonpatKeyedPortsKey(key string) string {
+	if strings.HasPrefix(key, "port_") {
+		return strings.TrimPrefix(key, "port_")
+	}
+	return key
+}
+
+// jsonpatKeyedCodesKey returns the key x.Codes stores the value of key under.
+func jsonpatKeyedCodesKey(key string) string {
+	if groups := jsonpatKeyedCodesRe.FindStringSubmatch(key); groups != nil {
+		return groups[1]
+	}
+	return key
+}
+
+// jsonpatKeyedVersionsKey returns the key x.Versions stores the value of key under.
+func jsonpatKeyedVersionsKey(key string) string {
+	if strings.HasPrefix(key, "v") {
+		return strings.TrimPrefix(key, "v")
+	}
+	return key
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Keyed) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.Ports)
+	jsonpatrt.InitMap(&x.Codes)
+	jsonpatrt.InitMap(&x.Versions)
+	jsonpatrt.InitMap(&x.Regions)
+
+	dynamic := func(key string, value []byte) error {
+		claimed := false
+		if strings.HasPrefix(key, "port_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Ports, jsonpatKeyedPortsKey(key), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatKeyedCodesRe.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Codes, jsonpatKeyedCodesKey(key), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.HasPrefix(key, "v") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Versions, jsonpatKeyedVersionsKey(key), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.HasSuffix(key, "_region") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Regions, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	return jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		return dynamic(key, value)
+	})
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Keyed) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if err := jsonpatrt.WriteAffixedEntries(&w, x.Ports, "port_", ""); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteAffixedEntries(&w, x.Codes, "code_", ""); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteAffixedEntries(&w, x.Versions, "v", ""); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Regions); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+var jsonpatCollectedEntriesExclude = regexp.MustCompile(`(?s)^num_x$`)
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Collected) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.Labels)
+
+	collected := make([][]jsonpatrt.Member, 4)
+	dynamic := func(index int, key string, value []byte) error {
+		claimed := false
+		if strings.HasPrefix(key, "lbl_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Labels, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if strings.HasPrefix(key, "val_") {
+			claimed = true
+			collected[0] = append(collected[0], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if (strings.HasPrefix(key, "val_") || strings.HasPrefix(key, "num_")) && !jsonpatCollectedEntriesExclude.MatchString(key) {
+			claimed = true
+			collected[1] = append(collected[1], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if strings.HasPrefix(key, "item_") {
+			claimed = true
+			collected[2] = append(collected[2], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if strings.HasPrefix(key, "lbl_") {
+			claimed = true
+			collected[3] = append(collected[3], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	var pending []jsonpatrt.Member
+	count := 0
+	err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		index := count
+		count++
+		if strings.HasPrefix(key, "val_") || strings.HasPrefix(key, "raw_") {
+			pending = append(pending, jsonpatrt.Member{Index: index, Key: key, Value: value})
+			return nil
+		}
+		return dynamic(index, key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := make([]bool, len(pending))
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return strings.HasPrefix(key, "val_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.First); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return strings.HasPrefix(key, "raw_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Raw); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	for i, m := range pending {
+		if !taken[i] {
+			if err = dynamic(m.Index, m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	}
+	if err = jsonpatrt.SetValues(&x.Values, collected[0]); err != nil {
+		return err
+	}
+	if err = jsonpatrt.SetEntries(&x.Entries, collected[1]); err != nil {
+		return err
+	}
+	if err = jsonpatrt.SetEntries(&x.Items, collected[2]); err != nil {
+		return err
+	}
+	if err = jsonpatrt.SetEntries(&x.Ordered, collected[3]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Collected) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if x.First != 0 && !w.Written("val_") {
+		if err := w.Member("val_", &x.First); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "val_", err)
+		}
+	}
+	if x.Raw != nil && !w.Written("raw_") {
+		if err := w.Member("raw_", &x.Raw); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "raw_", err)
+		}
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Labels); err != nil {
+		return nil, err
+	}
+	if len(x.Values) != 0 {
+		return nil, errors.New("failed to marshal dynamic slice field Values: its values have no keys; use []jsonpat.Entry[T] to keep them")
+	}
+	if err := jsonpatrt.WriteEntrySlice(&w, x.Entries); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntrySlice(&w, x.Items); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteEntrySlice(&w, x.Ordered); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Prices) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+
+	dynamic := func(key string, value []byte) error {
+		return jsonpatrt.Validate(value)
+	}
+
+	var pending []jsonpatrt.Member
+	err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		if strings.HasPrefix(key, "price_") || strings.HasPrefix(key, "cost_") || strings.HasPrefix(key, "fee_") || strings.HasPrefix(key, "tax_") {
+			pending = append(pending, jsonpatrt.Member{Key: key, Value: value})
+			return nil
+		}
+		return dynamic(key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := make([]bool, len(pending))
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return strings.HasPrefix(key, "price_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.First); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.PickLast(pending, taken, func(key string) bool { return strings.HasPrefix(key, "cost_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Last); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i := jsonpatrt.PickInOrder(pending, taken, func(key string) bool { return strings.HasPrefix(key, "fee_") }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Document); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i, err := jsonpatrt.PickUnique(pending, taken, func(key string) bool { return strings.HasPrefix(key, "tax_") }, x, "Unique"); err != nil {
+		return err
+	} else if i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Unique); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	if i, err := jsonpatrt.PickUnique(pending, taken, func(key string) bool { return strings.HasPrefix(key, "price_") }, x, "Shared"); err != nil {
+		return err
+	} else if i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Shared); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	for i, m := range pending {
+		if !taken[i] {
+			if err = dynamic(m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Prices) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if x.First != "" && !w.Written("price_") {
+		if err := w.Member("price_", &x.First); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "price_", err)
+		}
+	}
+	if x.Last != "" && !w.Written("cost_") {
+		if err := w.Member("cost_", &x.Last); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "cost_", err)
+		}
+	}
+	if x.Document != "" && !w.Written("fee_") {
+		if err := w.Member("fee_", &x.Document); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "fee_", err)
+		}
+	}
+	if x.Unique != "" && !w.Written("tax_") {
+		if err := w.Member("tax_", &x.Unique); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "tax_", err)
+		}
+	}
+	if x.Shared != "" && !w.Written("price_") {
+		if err := w.Member("price_", &x.Shared); err != nil {
+			return nil, fmt.Errorf("failed to marshal dynamic scalar key %s: %w", "price_", err)
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json value into the
+// Value field of x. Its group fields are filled by the field holding x.
+func (x *Sample) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &x.Value)
+}
+
+// MarshalJSON implements json.Marshaler, encoding the Value field of x.
+func (x Sample) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&x.Value)
+}
+
+var jsonpatCapturedLatestRe = regexp.MustCompile(`^latest_(?P<region>[a-z]+)_(?P<metric>[a-z]+)(?:_(?P<shard>\d+))?$`)
+
+var jsonpatCapturedByKeyRe = regexp.MustCompile(`^(?P<region>[a-z]+)_(?P<metric>[a-z]+)(?:_(?P<shard>\d+))?$`)
+
+var jsonpatCapturedSamplesRe0 = regexp.MustCompile(`^s:(?P<metric>[a-z]+)$`)
+
+var jsonpatCapturedSamplesRe1 = regexp.MustCompile(`^s:(?P<metric>[a-z]+)@(?P<region>[a-z]+)#(?P<shard>\d+)$`)
+
+var jsonpatCapturedEntriesRe = regexp.MustCompile(`(?i)^E_(?P<metric>[a-z]+)@(?P<region>[a-z]+)(?:#(?P<shard>\d+))?$`)
+
+var jsonpatCapturedKnown = jsonpatrt.NewKnownKeys("host")
+
+// jsonpatCapturedLatestGroups fills the group fields of v from the key x.Latest holds it under.
+func jsonpatCapturedLatestGroups(key string, v *Sample) error {
+	if groups := jsonpatCapturedLatestRe.FindStringSubmatch(key); groups != nil {
+		if groups[1] != "" {
+			if err := jsonpatrt.SetGroup(&v.Region, groups[1]); err != nil {
+				return fmt.Errorf("failed to capture group region: %w", err)
+			}
+		}
+		if groups[2] != "" {
+			if err := jsonpatrt.SetGroup(&v.Metric, groups[2]); err != nil {
+				return fmt.Errorf("failed to capture group metric: %w", err)
+			}
+		}
+		if groups[3] != "" {
+			if err := jsonpatrt.SetGroup(&v.Shard, groups[3]); err != nil {
+				return fmt.Errorf("failed to capture group shard: %w", err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// jsonpatCapturedByKeyGroups fills the group fields of v from the key x.ByKey holds it under.
+func jsonpatCapturedByKeyGroups(key string, v *Sample) error {
+	if groups := jsonpatCapturedByKeyRe.FindStringSubmatch(key); groups != nil {
+		if groups[1] != "" {
+			if err := jsonpatrt.SetGroup(&v.Region, groups[1]); err != nil {
+				return fmt.Errorf("failed to capture group region: %w", err)
+			}
+		}
+		if groups[2] != "" {
+			if err := jsonpatrt.SetGroup(&v.Metric, groups[2]); err != nil {
+				return fmt.Errorf("failed to capture group metric: %w", err)
+			}
+		}
+		if groups[3] != "" {
+			if err := jsonpatrt.SetGroup(&v.Shard, groups[3]); err != nil {
+				return fmt.Errorf("failed to capture group shard: %w", err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// jsonpatCapturedSamplesGroups fills the group fields of v from the key x.Samples holds it under.
+func jsonpatCapturedSamplesGroups(key string, v *Sample) error {
+	if groups := jsonpatCapturedSamplesRe0.FindStringSubmatch(key); groups != nil {
+		if groups[1] != "" {
+			if err := jsonpatrt.SetGroup(&v.Metric, groups[1]); err != nil {
+				return fmt.Errorf("failed to capture group metric: %w", err)
+			}
+		}
+		return nil
+	}
+	if groups := jsonpatCapturedSamplesRe1.FindStringSubmatch(key); groups != nil {
+		if groups[2] != "" {
+			if err := jsonpatrt.SetGroup(&v.Region, groups[2]); err != nil {
+				return fmt.Errorf("failed to capture group region: %w", err)
+			}
+		}
+		if groups[1] != "" {
+			if err := jsonpatrt.SetGroup(&v.Metric, groups[1]); err != nil {
+				return fmt.Errorf("failed to capture group metric: %w", err)
+			}
+		}
+		if groups[3] != "" {
+			if err := jsonpatrt.SetGroup(&v.Shard, groups[3]); err != nil {
+				return fmt.Errorf("failed to capture group shard: %w", err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// jsonpatCapturedEntriesGroups fills the group fields of v from the key x.Entries holds it under.
+func jsonpatCapturedEntriesGroups(key string, v *Sample) error {
+	if groups := jsonpatCapturedEntriesRe.FindStringSubmatch(key); groups != nil {
+		if groups[2] != "" {
+			if err := jsonpatrt.SetGroup(&v.Region, groups[2]); err != nil {
+				return fmt.Errorf("failed to capture group region: %w", err)
+			}
+		}
+		if groups[1] != "" {
+			if err := jsonpatrt.SetGroup(&v.Metric, groups[1]); err != nil {
+				return fmt.Errorf("failed to capture group metric: %w", err)
+			}
+		}
+		if groups[3] != "" {
+			if err := jsonpatrt.SetGroup(&v.Shard, groups[3]); err != nil {
+				return fmt.Errorf("failed to capture group shard: %w", err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Captured) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.ByKey)
+
+	collected := make([][]jsonpatrt.Member, 2)
+	dynamic := func(index int, key string, value []byte) error {
+		claimed := false
+		if jsonpatCapturedByKeyRe.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetCapturedEntry(x.ByKey, key, key, value, jsonpatCapturedByKeyGroups); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatCapturedSamplesRe0.MatchString(key) || jsonpatCapturedSamplesRe1.MatchString(key) {
+			claimed = true
+			collected[0] = append(collected[0], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if jsonpatCapturedEntriesRe.MatchString(key) {
+			claimed = true
+			collected[1] = append(collected[1], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	var pending []jsonpatrt.Member
+	count := 0
+	err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		index := count
+		count++
+		switch jsonpatCapturedKnown.Lookup(key) {
+		case "host":
+			if err := json.Unmarshal(value, &x.Host); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		}
+		if jsonpatCapturedLatestRe.MatchString(key) {
+			pending = append(pending, jsonpatrt.Member{Index: index, Key: key, Value: value})
+			return nil
+		}
+		return dynamic(index, key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := make([]bool, len(pending))
+	if i := jsonpatrt.PickLast(pending, taken, func(key string) bool { return jsonpatCapturedLatestRe.MatchString(key) }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Latest); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+		if err = jsonpatCapturedLatestGroups(pending[i].Key, &x.Latest); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	for i, m := range pending {
+		if !taken[i] {
+			if err = dynamic(m.Index, m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	}
+	if err = jsonpatrt.SetCapturedValues(&x.Samples, collected[0], jsonpatCapturedSamplesGroups); err != nil {
+		return err
+	}
+	if err = jsonpatrt.SetCapturedEntries(&x.Entries, collected[1], jsonpatCapturedEntriesGroups); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Captured) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if err := w.Member("host", &x.Host); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "host", err)
+	}
+	if !jsonpatrt.IsZero(x.Latest) {
+		return nil, errors.New("failed to marshal dynamic scalar field Latest: cannot derive a key from regex pattern \"^latest_(?P<region>[a-z]+)_(?P<metric>[a-z]+)(?:_(?P<shard>\\\\d+))?$\"")
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.ByKey); err != nil {
+		return nil, err
+	}
+	if len(x.Samples) != 0 {
+		return nil, errors.New("failed to marshal dynamic slice field Samples: its values have no keys; use []jsonpat.Entry[T] to keep them")
+	}
+	if err := jsonpatrt.WriteEntrySlice(&w, x.Entries); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+var jsonpatTemplatedLatestRe = regexp.MustCompile(`(?s)^latest_(?P<metric>.+?)$`)
+
+var jsonpatTemplatedByRegionRe = regexp.MustCompile(`(?s)^(?P<region>.+?)_(?P<metric>.+?)$`)
+
+var jsonpatTemplatedShardsRe0 = regexp.MustCompile(`(?i)(?s)^shard\.(?P<name>.+?)\.(?P<n>.+?)\.(?P<stat>.+?)$`)
+
+var jsonpatTemplatedShardsRe1 = regexp.MustCompile(`(?i)(?s)^SHARD/(?P<name>.+?)/(?P<n>.+?)/(?P<stat>.+?)$`)
+
+var jsonpatTemplatedSamplesRe = regexp.MustCompile(`(?s)^s:(?P<region>.+?):(?P<metric>.+?)#(?P<shard>.+?)$`)
+
+var jsonpatTemplatedKnown = jsonpatrt.NewKnownKeys("host")
+
+// jsonpatTemplatedSamplesGroups fills the group fields of v from the key x.Samples holds it under.
+func jsonpatTemplatedSamplesGroups(key string, v *Sample) error {
+	if groups := jsonpatTemplatedSamplesRe.FindStringSubmatch(key); groups != nil {
+		if groups[1] != "" {
+			if err := jsonpatrt.SetGroup(&v.Region, groups[1]); err != nil {
+				return fmt.Errorf("failed to capture group region: %w", err)
+			}
+		}
+		if groups[2] != "" {
+			if err := jsonpatrt.SetGroup(&v.Metric, groups[2]); err != nil {
+				return fmt.Errorf("failed to capture group metric: %w", err)
+			}
+		}
+		if groups[3] != "" {
+			if err := jsonpatrt.SetGroup(&v.Shard, groups[3]); err != nil {
+				return fmt.Errorf("failed to capture group shard: %w", err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Templated) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.ByRegion)
+	jsonpatrt.InitMap(&x.Shards)
+
+	collected := make([][]jsonpatrt.Member, 1)
+	dynamic := func(index int, key string, value []byte) error {
+		claimed := false
+		if jsonpatTemplatedByRegionRe.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetNestedEntry(x.ByRegion, jsonpatrt.Segments(key, jsonpatTemplatedByRegionRe), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatTemplatedShardsRe0.MatchString(key) || jsonpatTemplatedShardsRe1.MatchString(key) {
+			claimed = true
+			if err := jsonpatrt.SetNestedEntry(x.Shards, jsonpatrt.Segments(key, jsonpatTemplatedShardsRe0, jsonpatTemplatedShardsRe1), value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if jsonpatTemplatedSamplesRe.MatchString(key) {
+			claimed = true
+			collected[0] = append(collected[0], jsonpatrt.Member{Index: index, Key: key, Value: value})
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	var pending []jsonpatrt.Member
+	count := 0
+	err := jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		index := count
+		count++
+		switch jsonpatTemplatedKnown.Lookup(key) {
+		case "host":
+			if err := json.Unmarshal(value, &x.Host); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		}
+		if jsonpatTemplatedLatestRe.MatchString(key) {
+			pending = append(pending, jsonpatrt.Member{Index: index, Key: key, Value: value})
+			return nil
+		}
+		return dynamic(index, key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	taken := make([]bool, len(pending))
+	if i := jsonpatrt.Pick(pending, taken, func(key string) bool { return jsonpatTemplatedLatestRe.MatchString(key) }); i >= 0 {
+		if err = json.Unmarshal(pending[i].Value, &x.Latest); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", pending[i].Key, err)
+		}
+	}
+	for i, m := range pending {
+		if !taken[i] {
+			if err = dynamic(m.Index, m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	}
+	if err = jsonpatrt.SetCapturedValues(&x.Samples, collected[0], jsonpatTemplatedSamplesGroups); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Templated) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if err := w.Member("host", &x.Host); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "host", err)
+	}
+	if x.Latest != 0 {
+		return nil, errors.New("failed to marshal dynamic scalar field Latest: cannot derive a key from template pattern \"latest_{metric}\"")
+	}
+	if err := jsonpatrt.WriteNestedEntries(&w, x.ByRegion, jsonpatTemplatedByRegionRe, "", "_", ""); err != nil {
+		return nil, err
+	}
+	if err := jsonpatrt.WriteNestedEntries(&w, x.Shards, jsonpatTemplatedShardsRe0, "shard.", ".", ".", ""); err != nil {
+		return nil, err
+	}
+	if len(x.Samples) != 0 {
+		return nil, errors.New("failed to marshal dynamic slice field Samples: its values have no keys; use []jsonpat.Entry[T] to keep them")
+	}
+	return w.Bytes(), nil
+}
+
+var jsonpatEmbeddingKnown = jsonpatrt.NewKnownKeys("owner", "created", "tags")
+
+// UnmarshalJSON implements json.Unmarshaler, decoding a json object into x
+// according to its jsonpat tags.
+func (x *Embedding) UnmarshalJSON(data []byte) error {
+	if jsonpatrt.IsNull(data) {
+		return nil
+	}
+	if err := jsonpatrt.ExpectObject(data, x); err != nil {
+		return err
+	}
+	jsonpatrt.InitMap(&x.Dyn)
+
+	dynamic := func(key string, value []byte) error {
+		claimed := false
+		if strings.HasPrefix(key, "dyn_") {
+			claimed = true
+			if err := jsonpatrt.SetEntry(x.Dyn, key, value); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+			}
+		}
+		if claimed {
+			return nil
+		}
+		return jsonpatrt.Validate(value)
+	}
+
+	return jsonpatrt.ForEachMember(data, func(key string, value []byte) error {
+		switch jsonpatEmbeddingKnown.Lookup(key) {
+		case "owner":
+			if err := json.Unmarshal(value, &x.meta.Owner); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "created":
+			if err := json.Unmarshal(value, &x.audit.Created); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		case "tags":
+			if err := json.Unmarshal(value, &x.Tags); err != nil {
+				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+			}
+			return nil
+		}
+		return dynamic(key, value)
+	})
+}
+
+// MarshalJSON implements json.Marshaler, encoding x as a json object
+// according to its jsonpat tags.
+func (x Embedding) MarshalJSON() ([]byte, error) {
+	var w jsonpatrt.Writer
+	if err := w.Member("owner", &x.meta.Owner); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "owner", err)
+	}
+	if err := w.Member("created", &x.audit.Created); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "created", err)
+	}
+	if err := w.Member("tags", &x.Tags); err != nil {
+		return nil, fmt.Errorf("failed to marshal known key %s: %w", "tags", err)
+	}
+	if err := jsonpatrt.WriteEntries(&w, x.Dyn); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+// Package mapkey converts between json object keys and the keys of go maps,
+// following the rules of encoding/json: keys can be strings, integers, or
+// implement encoding.TextUnmarshaler and encoding.TextMarshaler.
+package mapkey
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Check reports an error if json keys can't be decoded into map keys of type
+// typ.
+func Check(typ reflect.Type) error {
+	if reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return nil
+	}
+	return fmt.Errorf("unsupported map key type %s", typ)
+}
+
+// Set decodes a json key into the addressable map key v.
+func Set(v reflect.Value, key string) error {
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		v.Set(reflect.Zero(v.Type()))
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid map key %q for type %s", key, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(key, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid map key %q for type %s", key, v.Type())
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported map key type %s", v.Type())
+	}
+	return nil
+}
+
+// Format returns the json key the map key v is encoded as.
+func Format(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return "", nil
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %s", v.Type())
+}
+
+// SetNested stores v in the nested maps m, under one key per segment, creating
+// the inner maps as needed.
+func SetNested(m reflect.Value, segments []string, v reflect.Value) error {
+	for i, segment := range segments {
+		key := reflect.New(m.Type().Key()).Elem()
+		if err := Set(key, segment); err != nil {
+			return err
+		}
+		if i == len(segments)-1 {
+			m.SetMapIndex(key, v)
+			break
+		}
+
+		inner := m.MapIndex(key)
+		if !inner.IsValid() || inner.IsNil() {
+			inner = reflect.MakeMap(m.Type().Elem())
+			m.SetMapIndex(key, inner)
+		}
+		m = inner
+	}
+	return nil
+}
+
+// Walk calls fn with every value held levels deep in the nested maps m, along
+// with the json keys leading to it.
+func Walk(m reflect.Value, levels int, fn func(segments []string, v reflect.Value) error) error {
+	return walk(m, levels, nil, fn)
+}
+
+func walk(m reflect.Value, levels int, segments []string, fn func(segments []string, v reflect.Value) error) error {
+	iter := m.MapRange()
+	for iter.Next() {
+		key, err := Format(iter.Key())
+		if err != nil {
+			return err
+		}
+
+		path := append(slices.Clip(segments), key)
+		if levels == 1 {
+			err = fn(path, iter.Value())
+		} else {
+			err = walk(iter.Value(), levels-1, path, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+// Package scan walks json documents in place, handing out the raw members of
+// objects and elements of arrays without decoding them.
+package scan
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// errUnexpectedEnd is returned when the scanner can't find a syntax error to
+// report through encoding/json, which should only happen for truncated input.
+var errUnexpectedEnd = errors.New("unexpected end of JSON input")
+
+// scanner walks a json document in place. It only checks the structure of the
+// objects and arrays it iterates over; the values it hands out are raw slices of
+// the input, which are validated when they are decoded.
+type scanner struct {
+	data []byte
+	off  int
+}
+
+// ForEachMember calls fn with the key and raw value of every member of the json
+// object in data, in document order.
+func ForEachMember(data []byte, fn func(key string, value []byte) error) error {
+	s := scanner{data: data}
+	if err := s.consume('{'); err != nil {
+		return err
+	}
+	if s.peek() == '}' {
+		s.off++
+		return s.end()
+	}
+
+	for {
+		key, err := s.readKey()
+		if err != nil {
+			return err
+		}
+		if err = s.consume(':'); err != nil {
+			return err
+		}
+		value, err := s.readValue()
+		if err != nil {
+			return err
+		}
+		if err = fn(key, value); err != nil {
+			return err
+		}
+
+		switch s.peek() {
+		case ',':
+			s.off++
+		case '}':
+			s.off++
+			return s.end()
+		default:
+			return s.syntaxError()
+		}
+	}
+}
+
+// ForEachElement calls fn with the index and raw value of every element of the
+// json array in data.
+func ForEachElement(data []byte, fn func(i int, value []byte) error) error {
+	s := scanner{data: data}
+	if err := s.consume('['); err != nil {
+		return err
+	}
+	if s.peek() == ']' {
+		s.off++
+		return s.end()
+	}
+
+	for i := 0; ; i++ {
+		value, err := s.readValue()
+		if err != nil {
+			return err
+		}
+		if err = fn(i, value); err != nil {
+			return err
+		}
+
+		switch s.peek() {
+		case ',':
+			s.off++
+		case ']':
+			s.off++
+			return s.end()
+		default:
+			return s.syntaxError()
+		}
+	}
+}
+
+// ExpectKind checks that data holds a json value of the kind opened by c ('{' or
+// '['), returning the same errors as encoding/json when decoding into typ.
+func ExpectKind(data []byte, c byte, typ reflect.Type) error {
+	s := scanner{data: data}
+	found := s.peek()
+	if found == c {
+		return nil
+	}
+
+	var kind string
+	switch found {
+	case '{':
+		kind = "object"
+	case '[':
+		kind = "array"
+	case '"':
+		kind = "string"
+	case 't', 'f':
+		kind = "bool"
+	case 'n':
+		kind = "null"
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		kind = "number"
+	}
+
+	if kind == "" || !json.Valid(data) {
+		return SyntaxError(data)
+	}
+	return &json.UnmarshalTypeError{Value: kind, Type: typ, Offset: int64(s.off + 1)}
+}
+
+// Validate checks that a value which won't be decoded is still valid json.
+func Validate(value []byte) error {
+	if json.Valid(value) {
+		return nil
+	}
+	return SyntaxError(value)
+}
+
+// peek skips whitespace and returns the next byte, or 0 at the end of the input.
+func (s *scanner) peek() byte {
+	s.skipSpace()
+	if s.off >= len(s.data) {
+		return 0
+	}
+	return s.data[s.off]
+}
+
+// consume skips whitespace and the expected byte c.
+func (s *scanner) consume(c byte) error {
+	if s.peek() != c {
+		return s.syntaxError()
+	}
+	s.off++
+	return nil
+}
+
+// end checks that nothing but whitespace follows the current offset.
+func (s *scanner) end() error {
+	if s.peek() != 0 || s.off < len(s.data) {
+		return s.syntaxError()
+	}
+	return nil
+}
+
+func (s *scanner) skipSpace() {
+	for s.off < len(s.data) {
+		switch s.data[s.off] {
+		case ' ', '\t', '\n', '\r':
+			s.off++
+		default:
+			return
+		}
+	}
+}
+
+// readKey reads an object key. Keys without escapes or non-ASCII characters are
+// sliced straight from the input, anything else is unquoted by encoding/json.
+func (s *scanner) readKey() (string, error) {
+	if s.peek() != '"' {
+		return "", s.syntaxError()
+	}
+
+	start := s.off
+	for i := start + 1; i < len(s.data); i++ {
+		c := s.data[i]
+		if c == '"' {
+			s.off = i + 1
+			return string(s.data[start+1 : i]), nil
+		}
+		if c == '\\' || c < 0x20 || c >= 0x80 {
+			break
+		}
+	}
+
+	if err := s.skipString(); err != nil {
+		return "", err
+	}
+	var key string
+	if err := json.Unmarshal(s.data[start:s.off], &key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// readValue returns the raw bytes of the next value.
+func (s *scanner) readValue() ([]byte, error) {
+	c := s.peek()
+	start := s.off
+
+	switch c {
+	case 0:
+		return nil, s.syntaxError()
+	case '"':
+		if err := s.skipString(); err != nil {
+			return nil, err
+		}
+	case '{', '[':
+		if err := s.skipContainer(); err != nil {
+			return nil, err
+		}
+	default:
+		for s.off < len(s.data) && !isDelimiter(s.data[s.off]) {
+			s.off++
+		}
+		if s.off == start {
+			return nil, s.syntaxError()
+		}
+	}
+
+	return s.data[start:s.off], nil
+}
+
+// skipString moves past the string starting at the current offset.
+func (s *scanner) skipString() error {
+	for i := s.off + 1; i < len(s.data); i++ {
+		switch s.data[i] {
+		case '\\':
+			i++
+		case '"':
+			s.off = i + 1
+			return nil
+		}
+	}
+	return s.syntaxError()
+}
+
+// skipContainer moves past the object or array starting at the current offset.
+func (s *scanner) skipContainer() error {
+	depth := 0
+	for s.off < len(s.data) {
+		switch s.data[s.off] {
+		case '"':
+			if err := s.skipString(); err != nil {
+				return err
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				s.off++
+				return nil
+			}
+		}
+		s.off++
+	}
+	return s.syntaxError()
+}
+
+// syntaxError returns the error encoding/json reports for the document.
+func (s *scanner) syntaxError() error {
+	return SyntaxError(s.data)
+}
+
+// SyntaxError returns the error encoding/json reports for malformed data, so that
+// callers see the same *json.SyntaxError as they would from the std lib. Its
+// message and offset describe data, so for a value sliced out of a document,
+// InDocument should be used to describe the document instead.
+func SyntaxError(data []byte) error {
+	var discard json.RawMessage
+	if err := json.Unmarshal(data, &discard); err != nil {
+		return err
+	}
+	return errUnexpectedEnd
+}
+
+// InDocument returns err, unless it is a syntax error found while decoding a
+// value sliced out of document, in which case the error encoding/json reports
+// for the whole document is returned, with its message and offset.
+func InDocument(document []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if (errors.As(err, &syntaxErr) || errors.Is(err, errUnexpectedEnd)) && !json.Valid(document) {
+		return SyntaxError(document)
+	}
+	return err
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case ',', ':', '}', ']', ' ', '\t', '\n', '\r', '"', '{', '[':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package scan
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachMember(t *testing.T) {
+	data := []byte(` { "a" : 1, "bA": "x\"}", "c": {"d": [1, {"e": "]"}]}, "é": null, "f": -1.5e3 } `)
+
+	var keys []string
+	var values []string
+	err := ForEachMember(data, func(key string, value []byte) error {
+		keys = append(keys, key)
+		values = append(values, string(value))
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "bA", "c", "é", "f"}, keys)
+	assert.Equal(t, []string{`1`, `"x\"}"`, `{"d": [1, {"e": "]"}]}`, `null`, `-1.5e3`}, values)
+}
+
+func TestForEachMember_Empty(t *testing.T) {
+	called := false
+	err := ForEachMember([]byte(` {} `), func(string, []byte) error {
+		called = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, called)
+}
+
+func TestForEachMember_SyntaxErrors(t *testing.T) {
+	inputs := []string{
+		``,
+		`{`,
+		`{"a"}`,
+		`{"a":}`,
+		`{"a":1,}`,
+		`{"a":1 "b":2}`,
+		`{"a":1}}`,
+		`{"a":"unterminated}`,
+		`{"a":[1,2}`,
+		`{a:1}`,
+	}
+
+	for _, input := range inputs {
+		err := ForEachMember([]byte(input), func(string, []byte) error { return nil })
+		var syntaxErr *json.SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr), "Expected *json.SyntaxError for %q, got %v", input, err)
+	}
+}
+
+func TestInDocument(t *testing.T) {
+	document := []byte(`{"zz": tru}`)
+	err := InDocument(document, Validate(document[7:10]))
+	var syntaxErr *json.SyntaxError
+	require.True(t, errors.As(err, &syntaxErr), "Expected *json.SyntaxError, got %v", err)
+	assert.Equal(t, "invalid character '}' in literal true (expecting 'e')", syntaxErr.Error())
+	assert.Equal(t, int64(11), syntaxErr.Offset)
+
+	other := errors.New("other")
+	assert.Equal(t, other, InDocument(document, other))
+	assert.NoError(t, InDocument(document, nil))
+}
+
+func TestForEachElement(t *testing.T) {
+	var values []string
+	err := ForEachElement([]byte(`[1, "two", [3], {"four": 4}]`), func(i int, value []byte) error {
+		assert.Equal(t, len(values), i)
+		values = append(values, string(value))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`1`, `"two"`, `[3]`, `{"four": 4}`}, values)
+
+	err = ForEachElement([]byte(`[1,]`), func(int, []byte) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestExpectKind(t *testing.T) {
+	typ := struct{ Name string }{}
+	assert.NoError(t, ExpectKind([]byte(` {}`), '{', reflect.TypeOf(typ)))
+
+	var typeErr *json.UnmarshalTypeError
+	require.True(t, errors.As(ExpectKind([]byte(`[1]`), '{', reflect.TypeOf(typ)), &typeErr))
+	assert.Equal(t, "array", typeErr.Value)
+
+	var syntaxErr *json.SyntaxError
+	assert.True(t, errors.As(ExpectKind([]byte(`[1`), '{', reflect.TypeOf(typ)), &syntaxErr))
+}
@@ -0,0 +1,114 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GlobRegex translates a glob pattern into an anchored regex. The pattern
+// matches whole keys, and supports:
+//
+//   - `*` matching any sequence of characters, including an empty one
+//   - `?` matching any single character
+//   - `[abc]`, `[a-z]` matching one character of a class, `[!abc]` or `[^abc]`
+//     one character outside of it
+//   - `{a,b}` matching any of the comma separated alternatives, which may
+//     themselves hold glob patterns
+//   - `\` escaping the next character
+func GlobRegex(glob string) (string, error) {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+
+	runes := []rune(glob)
+	depth := 0
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '\\':
+			if i+1 == len(runes) {
+				return "", fmt.Errorf("glob %q ends with an unfinished escape", glob)
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			end, class, err := globClass(runes, i)
+			if err != nil {
+				return "", fmt.Errorf("glob %q: %w", glob, err)
+			}
+			b.WriteString(class)
+			i = end
+		case '{':
+			depth++
+			b.WriteString(`(?:`)
+		case '}':
+			if depth == 0 {
+				b.WriteString(`\}`)
+				continue
+			}
+			depth--
+			b.WriteString(`)`)
+		case ',':
+			if depth == 0 {
+				b.WriteString(`,`)
+				continue
+			}
+			b.WriteString(`|`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if depth > 0 {
+		return "", fmt.Errorf("glob %q has an unterminated {", glob)
+	}
+
+	b.WriteString(`$`)
+	return b.String(), nil
+}
+
+// globClass translates the character class opened at runes[start], returning
+// the index of its closing bracket along with the equivalent regex class.
+func globClass(runes []rune, start int) (int, string, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+
+	i := start + 1
+	if i < len(runes) && (runes[i] == '!' || runes[i] == '^') {
+		b.WriteByte('^')
+		i++
+	}
+
+	// a closing bracket right at the start of the class is a literal one
+	for first := true; i < len(runes); i, first = i+1, false {
+		c := runes[i]
+		switch {
+		case c == ']' && !first:
+			b.WriteByte(']')
+			return i, b.String(), nil
+		case c == '\\' && i+1 < len(runes):
+			// escaped characters are literal, even a '-' or a closing bracket
+			i++
+			writeClassLiteral(&b, runes[i])
+		case c == '\\' || c == '[' || c == ']' || c == '^':
+			writeClassLiteral(&b, c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return 0, "", fmt.Errorf("unterminated [")
+}
+
+// writeClassLiteral writes c to a regex character class as a literal character.
+func writeClassLiteral(b *strings.Builder, c rune) {
+	if c < utf8.RuneSelf && (unicode.IsPunct(c) || unicode.IsSymbol(c)) {
+		b.WriteByte('\\')
+	}
+	b.WriteRune(c)
+}
@@ -0,0 +1,66 @@
+package tags
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobRegex(t *testing.T) {
+	tests := []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{glob: "metric.*.p99", matches: []string{"metric.cpu.p99", "metric..p99", "metric.a.b.p99"}, misses: []string{"metricXcpu.p99", "metric.cpu.p999"}},
+		{glob: "env_?_url", matches: []string{"env_a_url", "env_é_url"}, misses: []string{"env__url", "env_ab_url"}},
+		{glob: "k[abc]", matches: []string{"ka", "kc"}, misses: []string{"kd", "k"}},
+		{glob: "k[a-c0-9]", matches: []string{"kb", "k5"}, misses: []string{"kd"}},
+		{glob: "k[!abc]", matches: []string{"kd"}, misses: []string{"ka"}},
+		{glob: "k[^a]", matches: []string{"kb"}, misses: []string{"ka"}},
+		{glob: "k[]]", matches: []string{"k]"}, misses: []string{"ka"}},
+		{glob: `k[\-x]`, matches: []string{"k-", "kx"}, misses: []string{"kw"}},
+		{glob: "{cpu,mem}_*", matches: []string{"cpu_a", "mem_"}, misses: []string{"disk_a"}},
+		{glob: "{a,b{c,d}}", matches: []string{"a", "bc", "bd"}, misses: []string{"b"}},
+		{glob: `lit\*`, matches: []string{"lit*"}, misses: []string{"lita"}},
+		{glob: "a,b}", matches: []string{"a,b}"}},
+		{glob: "(x)+$", matches: []string{"(x)+$"}, misses: []string{"x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			pattern, err := GlobRegex(tt.glob)
+			require.NoError(t, err)
+			re := regexp.MustCompile(pattern)
+
+			for _, key := range tt.matches {
+				assert.True(t, re.MatchString(key), "%q should match %q", tt.glob, key)
+			}
+			for _, key := range tt.misses {
+				assert.False(t, re.MatchString(key), "%q should not match %q", tt.glob, key)
+			}
+		})
+	}
+}
+
+func TestGlobRegex_Errors(t *testing.T) {
+	for _, glob := range []string{"k[abc", "{a,b", `trailing\`} {
+		_, err := GlobRegex(glob)
+		assert.Error(t, err, glob)
+	}
+}
+
+func TestGlobRegex_Literal(t *testing.T) {
+	pattern, err := GlobRegex("env.url")
+	require.NoError(t, err)
+	literal, ok := RegexLiteral(pattern)
+	assert.True(t, ok)
+	assert.Equal(t, "env.url", literal)
+
+	pattern, err = GlobRegex("env_*")
+	require.NoError(t, err)
+	_, ok = RegexLiteral(pattern)
+	assert.False(t, ok)
+}
@@ -0,0 +1,492 @@
+// Package tags implements the grammar of the `jsonpat` and `json` struct tags,
+// shared by the reflective decoder and the jsonpat-gen code generator so that
+// both interpret a struct the same way.
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// Name is the key of the jsonpat struct tag
+	Name = "jsonpat"
+	// Separator separates the elements of a tag
+	Separator = ","
+	// PatternSeparator separates the alternative patterns of a tag
+	PatternSeparator = "|"
+
+	escape             = '\\'
+	optionArgSeparator = "="
+)
+
+// matchers
+const (
+	Prefix   = "prefix"
+	Contains = "contains"
+	Suffix   = "suffix"
+	Regex    = "regex"
+	Glob     = "glob"
+	Template = "template"
+
+	DefaultMatcher = Prefix
+)
+
+var matchers = []string{Prefix, Contains, Suffix, Regex, Glob, Template}
+
+// customMatchers holds the names registered with RegisterMatcher
+var (
+	customMatchersMu sync.RWMutex
+	customMatchers   = make(map[string]bool)
+)
+
+// RegisterMatcher makes name usable as a matcher in jsonpat tags. The name must
+// be told apart from values and options, so it can't be empty, contain
+// separators or spaces, or clash with a built in matcher, an option or a
+// matcher registered before.
+func RegisterMatcher(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("matcher name must not be empty")
+	case strings.ContainsAny(name, Separator+PatternSeparator+optionArgSeparator+string(escape)) ||
+		strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return fmt.Errorf("matcher name %q must not contain spaces or any of %q", name, Separator+PatternSeparator+optionArgSeparator+string(escape))
+	case slices.Contains(matchers, name):
+		return fmt.Errorf("matcher name %q is a built in matcher", name)
+	case slices.Contains(options, name):
+		return fmt.Errorf("matcher name %q is a %s tag option", name, Name)
+	}
+
+	customMatchersMu.Lock()
+	defer customMatchersMu.Unlock()
+	if customMatchers[name] {
+		return fmt.Errorf("matcher %q is already registered", name)
+	}
+	customMatchers[name] = true
+	return nil
+}
+
+// IsCustom reports whether matcher was registered with RegisterMatcher.
+func IsCustom(matcher string) bool {
+	customMatchersMu.RLock()
+	defer customMatchersMu.RUnlock()
+	return customMatchers[matcher]
+}
+
+// options
+const (
+	// Remaining marks a map field collecting every key claimed by no other field
+	Remaining = "remaining"
+	// CaseInsensitive makes the matcher ignore case, using Unicode case folding
+	CaseInsensitive = "ci"
+	// Exclude takes a glob; keys matching it are never claimed by the field
+	Exclude = "exclude"
+	// Trim stores map keys without the part matched by the pattern
+	Trim = "trim"
+
+	// First makes a scalar field take the first matching key in sorted order,
+	// which is the default
+	First = "first"
+	// Last makes a scalar field take the last matching key in sorted order
+	Last = "last"
+	// DocumentOrder makes a scalar field take the first matching key in the
+	// order of the input
+	DocumentOrder = "document-order"
+	// Unique makes it an error for more than one key to match a scalar field
+	Unique = "unique"
+)
+
+// KeyGroup is the name of the regex capture group holding the trimmed key
+const KeyGroup = "key"
+
+// Group tags a field of a capture struct with the regex capture group it is
+// filled from, as `group=<name>`
+const Group = "group"
+
+// ParseGroup reports whether tag is a group tag, returning the name of the
+// group it names. Only a tag made of nothing but `group=` and a valid group
+// name is one, so that patterns such as `group=,prefix` keep their meaning.
+func ParseGroup(tag string) (string, bool) {
+	name, ok := strings.CutPrefix(tag, Group+optionArgSeparator)
+	if !ok || !placeholderName.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+var options = []string{Remaining, CaseInsensitive, Exclude, Trim, First, Last, DocumentOrder, Unique}
+
+// flagOptions are the options that don't take an argument
+var flagOptions = []string{Remaining, CaseInsensitive, Trim, First, Last, DocumentOrder, Unique}
+
+// policies are the options choosing which key a scalar field takes when several
+// match it
+var policies = []string{First, Last, DocumentOrder, Unique}
+
+// argOptions are the options that require an argument
+var argOptions = []string{Exclude}
+
+// Option is an option following the matcher of a jsonpat tag, with its
+// argument when given as `name=arg`.
+type Option struct {
+	Name string
+	Arg  string
+}
+
+// Pattern is a single value and matcher of a jsonpat tag.
+type Pattern struct {
+	Value   string
+	Matcher string
+}
+
+// JsonPat holds the parsed parts of a jsonpat tag: its alternative patterns, a
+// key matching any of which is claimed by the field, and the options applying
+// to all of them.
+type JsonPat struct {
+	Patterns []Pattern
+	Options  []Option
+}
+
+// HasOption reports whether the tag sets the named option.
+func (d JsonPat) HasOption(name string) bool {
+	return slices.ContainsFunc(d.Options, func(opt Option) bool {
+		return opt.Name == name
+	})
+}
+
+// OptionArgs returns the arguments of every occurrence of the named option.
+func (d JsonPat) OptionArgs(name string) []string {
+	var args []string
+	for _, opt := range d.Options {
+		if opt.Name == name {
+			args = append(args, opt.Arg)
+		}
+	}
+	return args
+}
+
+// Policy returns the option choosing which of several matching keys a scalar
+// field takes, First if the tag sets none.
+func (d JsonPat) Policy() (string, error) {
+	var set []string
+	for _, opt := range d.Options {
+		if slices.Contains(policies, opt.Name) && !slices.Contains(set, opt.Name) {
+			set = append(set, opt.Name)
+		}
+	}
+
+	switch len(set) {
+	case 0:
+		return First, nil
+	case 1:
+		return set[0], nil
+	}
+	return "", fmt.Errorf("tag %s options %s can't be combined", Name, strings.Join(set, " and "))
+}
+
+// IsPolicy reports whether option is one of the options choosing which key a
+// scalar field takes.
+func IsPolicy(option string) bool {
+	return slices.Contains(policies, option)
+}
+
+// ParseJsonPat parses a jsonpat tag of the form
+// `<value>[,<matcher>][|<value>,<matcher>...][,<option>...]`.
+//
+// Options and the matcher are always the last elements of a pattern, so any
+// unescaped commas before them belong to the value: `^k_\d{1,3}$,regex` is read
+// as the regex `^k_\d{1,3}$`. A value containing commas therefore needs an
+// explicit matcher, unless its commas are escaped as `\,`.
+//
+// Alternative patterns are separated by `|`. Only a `|` directly following a
+// matcher separates patterns, so every pattern but the last must name its
+// matcher, and a `|` within a value (such as a regex alternation) is kept as is.
+func ParseJsonPat(tag string) (JsonPat, error) {
+	alternatives, err := splitPatterns(tag)
+	if err != nil {
+		return JsonPat{}, err
+	}
+
+	var data JsonPat
+	for _, alternative := range alternatives[:len(alternatives)-1] {
+		pattern, err := parsePattern(split(alternative))
+		if err != nil {
+			return JsonPat{}, err
+		}
+		data.Patterns = append(data.Patterns, pattern)
+	}
+
+	parts := split(alternatives[len(alternatives)-1])
+	for len(parts) > 1 {
+		opt, ok := parseOption(strings.TrimSpace(parts[len(parts)-1]))
+		if !ok {
+			break
+		}
+		if opt.Arg != "" && slices.Contains(flagOptions, opt.Name) {
+			return JsonPat{}, fmt.Errorf("tag %s option %s doesn't take an argument", Name, opt.Name)
+		}
+		if opt.Arg == "" && slices.Contains(argOptions, opt.Name) {
+			return JsonPat{}, fmt.Errorf("tag %s option %s requires an argument, as %s=<value>", Name, opt.Name, opt.Name)
+		}
+		data.Options = append([]Option{opt}, data.Options...)
+		parts = parts[:len(parts)-1]
+	}
+
+	pattern, err := parsePattern(parts)
+	if err != nil {
+		return JsonPat{}, err
+	}
+	data.Patterns = append(data.Patterns, pattern)
+	return data, nil
+}
+
+// parsePattern parses the elements of a single pattern, its options removed.
+func parsePattern(parts []string) (Pattern, error) {
+	if len(parts) == 1 {
+		return Pattern{Value: strings.TrimSpace(parts[0]), Matcher: DefaultMatcher}, nil
+	}
+
+	last := strings.TrimSpace(parts[len(parts)-1])
+	matcher, err := extractMatcher(last)
+	if err != nil {
+		// a matcher followed by something else most likely means extra arguments
+		if len(parts) > 2 && isMatcher(strings.TrimSpace(parts[len(parts)-2])) {
+			return Pattern{}, fmt.Errorf(
+				"tag %s must have a value and optional search type; unexpected %q after the search type",
+				Name,
+				last,
+			)
+		}
+		return Pattern{}, err
+	}
+
+	return Pattern{
+		Value:   strings.TrimSpace(strings.Join(parts[:len(parts)-1], Separator)),
+		Matcher: matcher,
+	}, nil
+}
+
+// splitPatterns splits a tag into its alternative patterns, on every `|` that
+// directly follows a matcher.
+func splitPatterns(tag string) ([]string, error) {
+	var alternatives []string
+	start := 0
+	for i := 0; i < len(tag); i++ {
+		if tag[i] != PatternSeparator[0] {
+			continue
+		}
+
+		parts := split(tag[start:i])
+		if len(parts) < 2 {
+			continue
+		}
+		if isMatcher(strings.TrimSpace(parts[len(parts)-1])) {
+			alternatives = append(alternatives, tag[start:i])
+			start = i + 1
+			continue
+		}
+
+		// options placed between patterns would otherwise silently become part
+		// of the next value
+		n := len(parts)
+		for n > 1 {
+			if _, ok := parseOption(strings.TrimSpace(parts[n-1])); !ok {
+				break
+			}
+			n--
+		}
+		if n < len(parts) && n > 1 && isMatcher(strings.TrimSpace(parts[n-1])) {
+			return nil, fmt.Errorf("tag %s options must follow the last pattern, as they apply to all of them", Name)
+		}
+	}
+
+	return append(alternatives, tag[start:]), nil
+}
+
+// extractMatcher validates the matcher named in a jsonpat tag.
+func extractMatcher(name string) (string, error) {
+	if !isMatcher(name) {
+		return "", fmt.Errorf(
+			"tag %s has invalid matcher %q; must be one of %s",
+			Name,
+			name,
+			strings.Join(knownMatchers(), ", "),
+		)
+	}
+	return name, nil
+}
+
+// isMatcher reports whether name is a built in or registered matcher.
+func isMatcher(name string) bool {
+	return slices.Contains(matchers, name) || IsCustom(name)
+}
+
+// knownMatchers returns the built in matchers followed by the registered ones,
+// in sorted order.
+func knownMatchers() []string {
+	customMatchersMu.RLock()
+	defer customMatchersMu.RUnlock()
+
+	custom := make([]string, 0, len(customMatchers))
+	for name := range customMatchers {
+		custom = append(custom, name)
+	}
+	slices.Sort(custom)
+	return append(slices.Clone(matchers), custom...)
+}
+
+// parseOption parses a tag element as an option, reporting whether it is one.
+func parseOption(part string) (Option, bool) {
+	name, arg, _ := strings.Cut(part, optionArgSeparator)
+	if !slices.Contains(options, name) {
+		return Option{}, false
+	}
+	return Option{Name: name, Arg: arg}, true
+}
+
+// split splits a tag on every comma that isn't escaped as `\,`, unescaping the
+// escaped ones. Any other backslash is kept as is, so regex escapes such as `\d`
+// need no special treatment.
+func split(tag string) []string {
+	var parts []string
+	var current strings.Builder
+
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case c == escape && i+1 < len(tag) && tag[i+1] == Separator[0]:
+			current.WriteByte(Separator[0])
+			i++
+		case c == Separator[0]:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	return append(parts, current.String())
+}
+
+// Json holds the parts of a `json` tag that jsonpat takes into account.
+type Json struct {
+	Name      string // key of the field, empty when the tag doesn't name one
+	Skip      bool   // the field is ignored, as `json:"-"`
+	OmitEmpty bool
+	Quoted    bool // the `string` option is set
+}
+
+// ParseJson parses a `json` struct tag.
+func ParseJson(tag string) Json {
+	parts := strings.Split(tag, Separator)
+	if parts[0] == "-" {
+		return Json{Skip: true}
+	}
+
+	data := Json{Name: parts[0]}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			data.OmitEmpty = true
+		case "string":
+			data.Quoted = true
+		}
+	}
+	return data
+}
+
+// foldFlag is the regex flag making a pattern case-insensitive
+const foldFlag = "(?i)"
+
+// FoldRegex returns the case-insensitive form of a regex.
+func FoldRegex(pattern string) string {
+	return foldFlag + pattern
+}
+
+// UnfoldRegex reverses FoldRegex.
+func UnfoldRegex(pattern string) string {
+	return strings.TrimPrefix(pattern, foldFlag)
+}
+
+// TrimGroup returns the index of the capture group of a regex holding the part
+// of a key kept by the trim option: the group named KeyGroup, or else the first.
+func TrimGroup(re *regexp.Regexp) (int, error) {
+	if i := re.SubexpIndex(KeyGroup); i >= 0 {
+		return i, nil
+	}
+	if re.NumSubexp() == 0 {
+		return 0, fmt.Errorf("option %s needs a capture group in regex %q", Trim, re.String())
+	}
+	return 1, nil
+}
+
+// RegexAffixes returns the literal text around capture group `group` of the
+// regex pattern, if the pattern is made of nothing else (optionally anchored,
+// e.g. "^user_(\d+)$"), so that a key captured by the group can be turned back
+// into a key matching the pattern.
+func RegexAffixes(pattern string, group int) (prefix, suffix string, ok bool) {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", "", false
+	}
+	parsed = parsed.Simplify()
+
+	subs := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		subs = parsed.Sub
+	}
+	if len(subs) > 0 && subs[0].Op == syntax.OpBeginText {
+		subs = subs[1:]
+	}
+	if len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText {
+		subs = subs[:len(subs)-1]
+	}
+
+	var affixes [2]strings.Builder
+	side := 0
+	for _, sub := range subs {
+		switch {
+		case sub.Op == syntax.OpCapture && sub.Cap == group && side == 0:
+			side = 1
+		case sub.Op == syntax.OpLiteral:
+			affixes[side].WriteString(string(sub.Rune))
+		default:
+			return "", "", false
+		}
+	}
+	if side == 0 {
+		return "", "", false
+	}
+	return affixes[0].String(), affixes[1].String(), true
+}
+
+// RegexLiteral returns the only string matched by the regex pattern, if it
+// matches exactly one string (optionally anchored, e.g. "^key$").
+func RegexLiteral(pattern string) (string, bool) {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	parsed = parsed.Simplify()
+
+	subs := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		subs = parsed.Sub
+	}
+	if len(subs) > 0 && subs[0].Op == syntax.OpBeginText {
+		subs = subs[1:]
+	}
+	if len(subs) > 0 && subs[len(subs)-1].Op == syntax.OpEndText {
+		subs = subs[:len(subs)-1]
+	}
+
+	if len(subs) != 1 || subs[0].Op != syntax.OpLiteral || subs[0].Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	return string(subs[0].Rune), true
+}
@@ -0,0 +1,206 @@
+package tags
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseJsonPat(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected JsonPat
+	}{
+		{tag: "dyn_", expected: JsonPat{Patterns: []Pattern{{Value: "dyn_", Matcher: Prefix}}}},
+		{tag: "dyn_,suffix", expected: JsonPat{Patterns: []Pattern{{Value: "dyn_", Matcher: Suffix}}}},
+		{tag: " dyn_ , contains ", expected: JsonPat{Patterns: []Pattern{{Value: "dyn_", Matcher: Contains}}}},
+		{tag: `^k_\d{1,3}$,regex`, expected: JsonPat{Patterns: []Pattern{{Value: `^k_\d{1,3}$`, Matcher: Regex}}}},
+		{tag: `^[a,b,c]+_(x|y){2,}$,regex`, expected: JsonPat{Patterns: []Pattern{{Value: `^[a,b,c]+_(x|y){2,}$`, Matcher: Regex}}}},
+		{tag: `a\,b`, expected: JsonPat{Patterns: []Pattern{{Value: "a,b", Matcher: Prefix}}}},
+		{tag: `a\,b\,prefix`, expected: JsonPat{Patterns: []Pattern{{Value: "a,b,prefix", Matcher: Prefix}}}},
+		{tag: `a\,b,suffix`, expected: JsonPat{Patterns: []Pattern{{Value: "a,b", Matcher: Suffix}}}},
+		{tag: `\d+\\x,regex`, expected: JsonPat{Patterns: []Pattern{{Value: `\d+\\x`, Matcher: Regex}}}},
+		{tag: "{cpu,mem}_*,glob", expected: JsonPat{Patterns: []Pattern{{Value: "{cpu,mem}_*", Matcher: Glob}}}},
+		{tag: "x-dyn-,prefix,ci", expected: JsonPat{Patterns: []Pattern{{Value: "x-dyn-", Matcher: Prefix}}, Options: []Option{{Name: CaseInsensitive}}}},
+		{tag: "x-dyn-,ci", expected: JsonPat{Patterns: []Pattern{{Value: "x-dyn-", Matcher: Prefix}}, Options: []Option{{Name: CaseInsensitive}}}},
+		{
+			tag: `cpu_,prefix|mem_,prefix|^disk\d+$,regex`,
+			expected: JsonPat{Patterns: []Pattern{
+				{Value: "cpu_", Matcher: Prefix},
+				{Value: "mem_", Matcher: Prefix},
+				{Value: `^disk\d+$`, Matcher: Regex},
+			}},
+		},
+		{
+			tag:      "a_ , contains | b,ci",
+			expected: JsonPat{Patterns: []Pattern{{Value: "a_", Matcher: Contains}, {Value: "b", Matcher: Prefix}}, Options: []Option{{Name: CaseInsensitive}}},
+		},
+		{tag: `^(a|b)$,regex`, expected: JsonPat{Patterns: []Pattern{{Value: `^(a|b)$`, Matcher: Regex}}}},
+		{
+			tag:      `^(a|b)$,regex|{x,y}|z_*,glob`,
+			expected: JsonPat{Patterns: []Pattern{{Value: `^(a|b)$`, Matcher: Regex}, {Value: "{x,y}|z_*", Matcher: Glob}}},
+		},
+		{
+			tag: `x_,prefix,exclude=x_internal_*,exclude={a\,b}_*,ci`,
+			expected: JsonPat{
+				Patterns: []Pattern{{Value: "x_", Matcher: Prefix}},
+				Options:  []Option{{Name: Exclude, Arg: "x_internal_*"}, {Name: Exclude, Arg: "{a,b}_*"}, {Name: CaseInsensitive}},
+			},
+		},
+		{tag: `a\,prefix|b`, expected: JsonPat{Patterns: []Pattern{{Value: "a,prefix|b", Matcher: Prefix}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			data, err := ParseJsonPat(tt.tag)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, data)
+		})
+	}
+}
+
+func TestParseJsonPat_Errors(t *testing.T) {
+	_, err := ParseJsonPat("val,invalid_type")
+	assert.ErrorContains(t, err, "invalid matcher")
+
+	_, err = ParseJsonPat(`^k_\d{1,3}$`)
+	assert.ErrorContains(t, err, "invalid matcher", "Unescaped commas need an explicit matcher")
+
+	_, err = ParseJsonPat("val,prefix,extra")
+	assert.ErrorContains(t, err, "must have a value and optional search type")
+
+	_, err = ParseJsonPat("a,prefix,ci|b,prefix")
+	assert.ErrorContains(t, err, "options must follow the last pattern")
+
+	_, err = ParseJsonPat("a,prefix|b,invalid_type")
+	assert.ErrorContains(t, err, "invalid matcher")
+
+	_, err = ParseJsonPat("val,prefix,exclude=")
+	assert.ErrorContains(t, err, "option exclude requires an argument")
+
+	_, err = ParseJsonPat("val,prefix,ci=yes")
+	assert.ErrorContains(t, err, "option ci doesn't take an argument")
+}
+
+func TestJsonPat_OptionArgs(t *testing.T) {
+	data, err := ParseJsonPat("x_,exclude=a*,ci,exclude=b*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a*", "b*"}, data.OptionArgs(Exclude))
+	assert.Nil(t, data.OptionArgs(Remaining))
+}
+
+func TestJsonPat_Policy(t *testing.T) {
+	tests := map[string]string{
+		"x_":                    First,
+		"x_,prefix,last":        Last,
+		"x_,document-order,ci":  DocumentOrder,
+		"x_,unique,unique":      Unique,
+		"^x$,regex|y,last,trim": Last,
+	}
+	for tag, expected := range tests {
+		data, err := ParseJsonPat(tag)
+		require.NoError(t, err)
+		policy, err := data.Policy()
+		require.NoError(t, err)
+		assert.Equal(t, expected, policy, tag)
+	}
+
+	data, err := ParseJsonPat("x_,first,last")
+	require.NoError(t, err)
+	_, err = data.Policy()
+	assert.ErrorContains(t, err, "options first and last can't be combined")
+
+	_, err = ParseJsonPat("x_,unique=yes")
+	assert.ErrorContains(t, err, "option unique doesn't take an argument")
+}
+
+func TestParseGroup(t *testing.T) {
+	name, ok := ParseGroup("group=region")
+	assert.True(t, ok)
+	assert.Equal(t, "region", name)
+
+	for _, tag := range []string{"region,prefix", "group=,prefix", "group=", "group=x_,prefix", "group=a-b"} {
+		_, ok = ParseGroup(tag)
+		assert.False(t, ok, tag)
+	}
+}
+
+func TestRegisterMatcher(t *testing.T) {
+	require.NoError(t, RegisterMatcher("tags_test_uuid"))
+	assert.True(t, IsCustom("tags_test_uuid"))
+	assert.False(t, IsCustom(Prefix))
+
+	data, err := ParseJsonPat("v4,tags_test_uuid|x_,prefix|y,tags_test_uuid,ci")
+	require.NoError(t, err)
+	assert.Equal(t, []Pattern{{"v4", "tags_test_uuid"}, {"x_", Prefix}, {"y", "tags_test_uuid"}}, data.Patterns)
+
+	_, err = ParseJsonPat("v4,tags_test_unregistered")
+	assert.ErrorContains(t, err, "must be one of prefix, contains, suffix, regex, glob, template, tags_test_uuid")
+
+	assert.ErrorContains(t, RegisterMatcher("tags_test_uuid"), "already registered")
+	assert.ErrorContains(t, RegisterMatcher(""), "must not be empty")
+	assert.ErrorContains(t, RegisterMatcher(Glob), "built in matcher")
+	assert.ErrorContains(t, RegisterMatcher(CaseInsensitive), "tag option")
+	for _, name := range []string{"a,b", "a|b", "a=b", `a\b`, "a b"} {
+		assert.ErrorContains(t, RegisterMatcher(name), "must not contain", name)
+	}
+}
+
+func TestTrimGroup(t *testing.T) {
+	group, err := TrimGroup(regexp.MustCompile(`^(a|b)_(?P<key>\w+)$`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, group)
+
+	group, err = TrimGroup(regexp.MustCompile(`^user_(\d+)_(x)$`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, group)
+
+	_, err = TrimGroup(regexp.MustCompile(`^user_\d+$`))
+	assert.ErrorContains(t, err, "needs a capture group")
+}
+
+func TestRegexAffixes(t *testing.T) {
+	tests := []struct {
+		pattern        string
+		group          int
+		prefix, suffix string
+		ok             bool
+	}{
+		{pattern: `^user_(\d+)$`, group: 1, prefix: "user_", ok: true},
+		{pattern: `(\w+)_total`, group: 1, suffix: "_total", ok: true},
+		{pattern: `^m\.(?P<key>.+)\.p99$`, group: 1, prefix: "m.", suffix: ".p99", ok: true},
+		{pattern: `^(.+)$`, group: 1, ok: true},
+		{pattern: `^(a|b)_(\w+)$`, group: 2},
+		{pattern: `^user_\d+_(\w+)$`, group: 1},
+		{pattern: `^user_(\d+)$`, group: 2},
+		{pattern: `(`, group: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			prefix, suffix, ok := RegexAffixes(tt.pattern, tt.group)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.prefix, prefix)
+			assert.Equal(t, tt.suffix, suffix)
+		})
+	}
+}
+
+func TestParseJson(t *testing.T) {
+	assert.Equal(t, Json{Name: "name"}, ParseJson("name"))
+	assert.Equal(t, Json{OmitEmpty: true, Quoted: true}, ParseJson(",omitempty,string"))
+	assert.Equal(t, Json{Skip: true}, ParseJson("-"))
+}
+
+func TestRegexLiteral(t *testing.T) {
+	literal, ok := RegexLiteral("^scalar_re$")
+	assert.True(t, ok)
+	assert.Equal(t, "scalar_re", literal)
+
+	_, ok = RegexLiteral(`^scalar_\d+$`)
+	assert.False(t, ok)
+	_, ok = RegexLiteral("(?i)^key$")
+	assert.False(t, ok)
+}
@@ -0,0 +1,102 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// placeholderName is the form of the names of template placeholders, which
+// become the names of regex capture groups, and of the groups named by group
+// tags
+var placeholderName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// KeyTemplate is a parsed template pattern, such as "{region}_{metric}": literal
+// text around named placeholders, each matching a non-empty segment of a key.
+type KeyTemplate struct {
+	// Names are the names of the placeholders, in order
+	Names []string
+	// Literals are the text before, between and after the placeholders, so
+	// there is one more of them than of Names
+	Literals []string
+}
+
+// ParseTemplate parses a template pattern. Placeholders are written as
+// `{name}`, and must be separated by literal text so that keys can be split
+// unambiguously; `\` escapes the next character.
+func ParseTemplate(pattern string) (KeyTemplate, error) {
+	var t KeyTemplate
+	var literal strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '\\':
+			if i+1 == len(pattern) {
+				return t, fmt.Errorf("template %q ends with an unfinished escape", pattern)
+			}
+			i++
+			literal.WriteByte(pattern[i])
+		case '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return t, fmt.Errorf("template %q has an unterminated {", pattern)
+			}
+			name := pattern[i+1 : i+end]
+			switch {
+			case !placeholderName.MatchString(name):
+				return t, fmt.Errorf("template %q has an invalid placeholder name %q", pattern, name)
+			case slices.Contains(t.Names, name):
+				return t, fmt.Errorf("template %q has placeholder %s more than once", pattern, name)
+			case len(t.Names) > 0 && literal.Len() == 0:
+				return t, fmt.Errorf("template %q needs literal text between placeholders %s and %s", pattern, t.Names[len(t.Names)-1], name)
+			}
+			t.Names = append(t.Names, name)
+			t.Literals = append(t.Literals, literal.String())
+			literal.Reset()
+			i += end
+		case '}':
+			return t, fmt.Errorf("template %q has an unmatched }", pattern)
+		default:
+			literal.WriteByte(c)
+		}
+	}
+
+	if len(t.Names) == 0 {
+		return t, fmt.Errorf("template %q has no placeholders", pattern)
+	}
+	t.Literals = append(t.Literals, literal.String())
+	return t, nil
+}
+
+// Regex returns the anchored regex matching the keys of the template, with a
+// capture group named after each placeholder. Segments are as short as
+// possible from the left, so "{a}_{b}" splits "x_y_z" into "x" and "y_z".
+func (t KeyTemplate) Regex() string {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	for i, name := range t.Names {
+		b.WriteString(regexp.QuoteMeta(t.Literals[i]))
+		b.WriteString(`(?P<` + name + `>.+?)`)
+	}
+	b.WriteString(regexp.QuoteMeta(t.Literals[len(t.Names)]))
+	b.WriteString(`$`)
+	return b.String()
+}
+
+// FormatTemplate builds the key holding segments from the literals of a
+// template. re is the compiled template, used to check that the key splits
+// back into the same segments.
+func FormatTemplate(re *regexp.Regexp, literals, segments []string) (string, error) {
+	var b strings.Builder
+	for i, segment := range segments {
+		b.WriteString(literals[i])
+		b.WriteString(segment)
+	}
+	b.WriteString(literals[len(segments)])
+
+	key := b.String()
+	if groups := re.FindStringSubmatch(key); groups == nil || !slices.Equal(groups[1:], segments) {
+		return "", fmt.Errorf("segments %q would be read back differently from key %q", segments, key)
+	}
+	return key, nil
+}
@@ -0,0 +1,88 @@
+package tags
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		names    []string
+		literals []string
+		segments map[string][]string
+		misses   []string
+	}{
+		{
+			template: "{region}_{metric}",
+			names:    []string{"region", "metric"},
+			literals: []string{"", "_", ""},
+			segments: map[string][]string{"us_cpu": {"us", "cpu"}, "eu_cpu_total": {"eu", "cpu_total"}},
+			misses:   []string{"us", "_cpu", "us_"},
+		},
+		{
+			template: "m.{host}.{metric}.p99",
+			names:    []string{"host", "metric"},
+			literals: []string{"m.", ".", ".p99"},
+			segments: map[string][]string{"m.web.cpu.p99": {"web", "cpu"}},
+			misses:   []string{"mxweb.cpu.p99", "m.web.cpu"},
+		},
+		{
+			template: `\{{key}\}`,
+			names:    []string{"key"},
+			literals: []string{"{", "}"},
+			segments: map[string][]string{"{a}": {"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			template, err := ParseTemplate(tt.template)
+			require.NoError(t, err)
+			assert.Equal(t, tt.names, template.Names)
+			assert.Equal(t, tt.literals, template.Literals)
+
+			re := regexp.MustCompile(template.Regex())
+			for key, segments := range tt.segments {
+				assert.Equal(t, segments, re.FindStringSubmatch(key)[1:], key)
+			}
+			for _, key := range tt.misses {
+				assert.False(t, re.MatchString(key), key)
+			}
+		})
+	}
+}
+
+func TestParseTemplate_Errors(t *testing.T) {
+	tests := map[string]string{
+		"plain":   "has no placeholders",
+		"{a":      "unterminated {",
+		"a}":      "unmatched }",
+		"{a-b}":   `invalid placeholder name "a-b"`,
+		"{}":      `invalid placeholder name ""`,
+		"{a}_{a}": "placeholder a more than once",
+		"{a}{b}":  "between placeholders a and b",
+		`{a}\`:    "unfinished escape",
+	}
+
+	for template, expected := range tests {
+		_, err := ParseTemplate(template)
+		assert.ErrorContains(t, err, expected, template)
+	}
+}
+
+func TestFormatTemplate(t *testing.T) {
+	template, err := ParseTemplate("{region}_{metric}")
+	require.NoError(t, err)
+	re := regexp.MustCompile(template.Regex())
+
+	key, err := FormatTemplate(re, template.Literals, []string{"us", "cpu_total"})
+	require.NoError(t, err)
+	assert.Equal(t, "us_cpu_total", key)
+
+	_, err = FormatTemplate(re, template.Literals, []string{"u_s", "cpu"})
+	assert.ErrorContains(t, err, `would be read back differently from key "u_s_cpu"`)
+}
@@ -0,0 +1,78 @@
+package jsonpat
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/jamieyoung5/jsonpat/internal/scan"
+)
+
+// UnmarshalJSONInto decodes a json object into v, which must be a non-nil pointer
+// to a struct, applying its jsonpat tags. Unlike Unmarshal, it never hands v over
+// to its own UnmarshalJSON method, so a struct can implement json.Unmarshaler by
+// delegating to it without recursing back into the method:
+//
+//	func (r *Record) UnmarshalJSON(data []byte) error {
+//		return jsonpat.UnmarshalJSONInto(data, r)
+//	}
+//
+// This makes the struct decode with its patterns wherever encoding/json is used,
+// for example as a field of a struct without jsonpat tags or in a web framework's
+// request binding.
+func UnmarshalJSONInto(data []byte, v interface{}) error {
+	structVal, err := structPointer(v)
+	if err != nil {
+		return err
+	}
+
+	d := &decodeState{}
+	return scan.InDocument(data, d.unmarshalStruct(data, structVal))
+}
+
+// MarshalJSONFrom encodes v, a struct or a pointer to a struct, applying its
+// jsonpat tags. Like UnmarshalJSONInto, it never calls the MarshalJSON method of
+// v itself, so it can be used to implement json.Marshaler:
+//
+//	func (r Record) MarshalJSON() ([]byte, error) {
+//		return jsonpat.MarshalJSONFrom(r)
+//	}
+func MarshalJSONFrom(v interface{}) ([]byte, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return []byte("null"), nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("v must be a struct or a pointer to a struct")
+	}
+
+	var buf bytes.Buffer
+	if err := marshalStruct(&buf, val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Struct wraps a struct type T with jsonpat tags so that encoding/json decodes
+// and encodes it with its patterns, for types that can't be given their own
+// UnmarshalJSON and MarshalJSON methods:
+//
+//	type Request struct {
+//		Metrics jsonpat.Struct[Metrics] `json:"metrics"`
+//	}
+type Struct[T any] struct {
+	Value T
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Struct[T]) UnmarshalJSON(data []byte) error {
+	return UnmarshalJSONInto(data, &s.Value)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Struct[T]) MarshalJSON() ([]byte, error) {
+	return MarshalJSONFrom(&s.Value)
+}
@@ -0,0 +1,88 @@
+package jsonpat
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SelfDecoding implements the std lib interfaces by delegating to jsonpat.
+type SelfDecoding struct {
+	Name  string         `json:"name"`
+	Attrs map[string]int `jsonpat:"attr_,prefix"`
+}
+
+func (s *SelfDecoding) UnmarshalJSON(data []byte) error {
+	return UnmarshalJSONInto(data, s)
+}
+
+func (s SelfDecoding) MarshalJSON() ([]byte, error) {
+	return MarshalJSONFrom(s)
+}
+
+type PlainHolder struct {
+	ID      string                   `json:"id"`
+	Self    SelfDecoding             `json:"self"`
+	Wrapped Struct[NestedItem]       `json:"wrapped"`
+	ByName  map[string]*SelfDecoding `json:"by_name"`
+	List    []Struct[EmbeddedStruct] `json:"list"`
+}
+
+func TestInterop_StdLib(t *testing.T) {
+	typeCache = sync.Map{}
+
+	jsonData := []byte(`{
+		"id": "root",
+		"self": {"name": "self", "attr_a": 1, "other": 2},
+		"wrapped": {"name": "wrapped", "attr_b": 2},
+		"by_name": {"x": {"name": "x", "attr_c": 3}, "y": null},
+		"list": [{"embedded_field": "e", "one_suffix": true}]
+	}`)
+
+	var result PlainHolder
+	require.NoError(t, json.Unmarshal(jsonData, &result))
+
+	assert.Equal(t, "root", result.ID)
+	assert.Equal(t, SelfDecoding{Name: "self", Attrs: map[string]int{"attr_a": 1}}, result.Self)
+	assert.Equal(t, NestedItem{Name: "wrapped", Attrs: map[string]int{"attr_b": 2}}, result.Wrapped.Value)
+	assert.Equal(t, map[string]int{"attr_c": 3}, result.ByName["x"].Attrs)
+	assert.Nil(t, result.ByName["y"])
+	assert.Equal(t, map[string]interface{}{"one_suffix": true}, result.List[0].Value.DynamicSuffix)
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": "root",
+		"self": {"name": "self", "attr_a": 1},
+		"wrapped": {"name": "wrapped", "attr_b": 2},
+		"by_name": {"x": {"name": "x", "attr_c": 3}, "y": null},
+		"list": [{"embedded_field": "e", "one_suffix": true}]
+	}`, string(data))
+}
+
+func TestInterop_ThroughJsonpat(t *testing.T) {
+	var self SelfDecoding
+	require.NoError(t, Unmarshal([]byte(`{"name": "n", "attr_a": 1}`), &self))
+	assert.Equal(t, map[string]int{"attr_a": 1}, self.Attrs)
+
+	data, err := Marshal(&self)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"n","attr_a":1}`, string(data))
+}
+
+func TestInterop_Errors(t *testing.T) {
+	var self SelfDecoding
+	assert.Error(t, UnmarshalJSONInto([]byte(`{}`), self), "Expected error for non-pointer")
+	assert.Error(t, UnmarshalJSONInto([]byte(`[1]`), &self), "Expected error for non-object")
+	assert.NoError(t, UnmarshalJSONInto([]byte(`null`), &self))
+
+	_, err := MarshalJSONFrom(map[string]int{})
+	assert.Error(t, err, "Expected error for non-struct")
+
+	data, err := MarshalJSONFrom((*SelfDecoding)(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+}
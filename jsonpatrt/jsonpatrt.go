@@ -0,0 +1,516 @@
+// Package jsonpatrt holds the helpers called by the UnmarshalJSON and
+// MarshalJSON methods generated by cmd/jsonpat-gen. It isn't meant to be used
+// directly, and its API follows the needs of the generator.
+package jsonpatrt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+
+	"github.com/jamieyoung5/jsonpat"
+	"github.com/jamieyoung5/jsonpat/internal/fold"
+	"github.com/jamieyoung5/jsonpat/internal/mapkey"
+	"github.com/jamieyoung5/jsonpat/internal/scan"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// Member is an object member whose dispatch is deferred until the whole object
+// has been read. Index is its position in the object.
+type Member struct {
+	Index int
+	Key   string
+	Value []byte
+}
+
+// IsNull reports whether data holds the json null literal.
+func IsNull(data []byte) bool {
+	return string(bytes.TrimSpace(data)) == "null"
+}
+
+// ExpectObject checks that data holds a json object, returning the same errors
+// as encoding/json when decoding into v, a pointer to a struct.
+func ExpectObject(data []byte, v any) error {
+	return scan.ExpectKind(data, '{', reflect.TypeOf(v).Elem())
+}
+
+// ForEachMember calls fn with the key and raw value of every member of the json
+// object in data, in document order.
+func ForEachMember(data []byte, fn func(key string, value []byte) error) error {
+	return scan.ForEachMember(data, fn)
+}
+
+// Validate checks that a value which won't be decoded is still valid json.
+func Validate(value []byte) error {
+	return scan.Validate(value)
+}
+
+// Pick returns the index of the first pending member in sorted key order that
+// matches and isn't taken yet, marking it as taken, or -1 if there is none.
+func Pick(pending []Member, taken []bool, match func(key string) bool) int {
+	return pick(pending, taken, match, func(key, chosen string) bool { return key < chosen })
+}
+
+// PickLast is like Pick, but picks the last matching member in sorted key
+// order, as the `last` option does.
+func PickLast(pending []Member, taken []bool, match func(key string) bool) int {
+	return pick(pending, taken, match, func(key, chosen string) bool { return key >= chosen })
+}
+
+// PickInOrder is like Pick, but picks the first matching member in document
+// order, as the `document-order` option does.
+func PickInOrder(pending []Member, taken []bool, match func(key string) bool) int {
+	return pick(pending, taken, match, func(string, string) bool { return false })
+}
+
+// PickUnique is like PickInOrder, but returns a *jsonpat.ConflictError naming
+// field of the struct v points to if several members match, as the `unique`
+// option does.
+func PickUnique(pending []Member, taken []bool, match func(key string) bool, v any, field string) (int, error) {
+	var keys []string
+	for i, candidate := range pending {
+		if !taken[i] && match(candidate.Key) {
+			keys = append(keys, candidate.Key)
+		}
+	}
+	if len(keys) > 1 {
+		return -1, &jsonpat.ConflictError{Type: reflect.TypeOf(v).Elem(), Field: field, Keys: keys}
+	}
+	return PickInOrder(pending, taken, match), nil
+}
+
+// pick returns the index of the pending member that matches, isn't taken yet
+// and that no other such member is better than, marking it as taken.
+func pick(pending []Member, taken []bool, match func(key string) bool, better func(key, chosen string) bool) int {
+	chosen := -1
+	for i, candidate := range pending {
+		if taken[i] || !match(candidate.Key) {
+			continue
+		}
+		if chosen < 0 || better(candidate.Key, pending[chosen].Key) {
+			chosen = i
+		}
+	}
+	if chosen >= 0 {
+		taken[chosen] = true
+	}
+	return chosen
+}
+
+// KnownKeys resolves json keys to the names of known fields like encoding/json
+// does: an exact match is preferred, falling back to a case-insensitive match.
+type KnownKeys struct {
+	exact  map[string]bool
+	folded map[string]string
+}
+
+// NewKnownKeys returns the KnownKeys of the given names, in field order.
+func NewKnownKeys(names ...string) *KnownKeys {
+	k := &KnownKeys{exact: make(map[string]bool, len(names)), folded: make(map[string]string, len(names))}
+	for _, name := range names {
+		k.exact[name] = true
+		if _, ok := k.folded[fold.Key(name)]; !ok {
+			k.folded[fold.Key(name)] = name
+		}
+	}
+	return k
+}
+
+// Lookup returns the name key addresses, or key itself if it addresses none.
+func (k *KnownKeys) Lookup(key string) string {
+	if k.exact[key] {
+		return key
+	}
+	var buf [64]byte
+	if name, ok := k.folded[string(fold.AppendKey(buf[:0], key))]; ok {
+		return name
+	}
+	return key
+}
+
+// HasPrefixFold reports whether key begins with prefix under Unicode case
+// folding, as the `ci` option of prefix matchers does.
+func HasPrefixFold(key, prefix string) bool {
+	return fold.HasPrefix(key, prefix)
+}
+
+// ContainsFold reports whether key contains substr under Unicode case folding.
+func ContainsFold(key, substr string) bool {
+	return fold.Contains(key, substr)
+}
+
+// HasSuffixFold reports whether key ends with suffix under Unicode case folding.
+func HasSuffixFold(key, suffix string) bool {
+	return fold.HasSuffix(key, suffix)
+}
+
+// TrimPrefixFold returns key without prefix, which it begins with under
+// Unicode case folding.
+func TrimPrefixFold(key, prefix string) string {
+	trimmed, _ := fold.TrimPrefix(key, prefix)
+	return trimmed
+}
+
+// TrimSuffixFold returns key without suffix, which it ends with under Unicode
+// case folding.
+func TrimSuffixFold(key, suffix string) string {
+	trimmed, _ := fold.TrimSuffix(key, suffix)
+	return trimmed
+}
+
+// InitMap makes *m an empty map if it is nil.
+func InitMap[M ~map[K]V, K comparable, V any](m *M) {
+	if *m == nil {
+		*m = make(M)
+	}
+}
+
+// SetEntry decodes a json value and stores it in m under key, converted to the
+// key type of m as encoding/json converts object keys.
+func SetEntry[M ~map[K]V, K comparable, V any](m M, key string, value []byte) error {
+	return SetCapturedEntry(m, key, key, value, nil)
+}
+
+// SetCapturedEntry is like SetEntry for the values of the json key key, stored
+// under mapKey. capture, when not nil, fills the group fields of the value from
+// key.
+func SetCapturedEntry[M ~map[K]V, K comparable, V any](m M, key, mapKey string, value []byte, capture func(key string, v *V) error) error {
+	var v V
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	if capture != nil {
+		if err := capture(key, &v); err != nil {
+			return err
+		}
+	}
+
+	var k K
+	if s, ok := any(&k).(*string); ok {
+		*s = mapKey
+	} else if err := mapkey.Set(reflect.ValueOf(&k).Elem(), mapKey); err != nil {
+		return err
+	}
+	m[k] = v
+	return nil
+}
+
+// Segments returns the segments of key, as split by the first of the compiled
+// templates res it matches.
+func Segments(key string, res ...*regexp.Regexp) []string {
+	for _, re := range res {
+		if groups := re.FindStringSubmatch(key); groups != nil {
+			return groups[1:]
+		}
+	}
+	return nil
+}
+
+// SetNestedEntry decodes a json value and stores it in the nested maps m, under
+// one key per segment, creating the inner maps as needed.
+func SetNestedEntry(m any, segments []string, value []byte) error {
+	mv := reflect.ValueOf(m)
+	typ := mv.Type()
+	for range segments {
+		typ = typ.Elem()
+	}
+
+	v := reflect.New(typ)
+	if err := json.Unmarshal(value, v.Interface()); err != nil {
+		return err
+	}
+	return mapkey.SetNested(mv, segments, v.Elem())
+}
+
+// SetCapturedNestedEntry is like SetNestedEntry, filling the group fields of the
+// value from key with capture.
+func SetCapturedNestedEntry[V any](m any, key string, segments []string, value []byte, capture func(key string, v *V) error) error {
+	var v V
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	if err := capture(key, &v); err != nil {
+		return err
+	}
+	return mapkey.SetNested(reflect.ValueOf(m), segments, reflect.ValueOf(v))
+}
+
+// SetGroup stores a named capture group of a key in the group field v points
+// to, converted as map keys are.
+func SetGroup(v any, group string) error {
+	if s, ok := v.(*string); ok {
+		*s = group
+		return nil
+	}
+	return mapkey.Set(reflect.ValueOf(v).Elem(), group)
+}
+
+// SetValues decodes the values of members into *s in document order, as a
+// dynamic slice field collects them. *s is left untouched when there are none.
+func SetValues[S ~[]T, T any](s *S, members []Member) error {
+	return SetCapturedValues(s, members, nil)
+}
+
+// SetCapturedValues is like SetValues, filling the group fields of each value
+// from its key with capture when it isn't nil.
+func SetCapturedValues[S ~[]T, T any](s *S, members []Member, capture func(key string, v *T) error) error {
+	if len(members) == 0 {
+		return nil
+	}
+	sortByIndex(members)
+
+	values := make(S, len(members))
+	for i, m := range members {
+		if err := decodeCaptured(m, &values[i], capture); err != nil {
+			return err
+		}
+	}
+	*s = values
+	return nil
+}
+
+// SetEntries is like SetValues for slices of jsonpat.Entry, which keep the keys
+// of the members along with their values.
+func SetEntries[S ~[]jsonpat.Entry[T], T any](s *S, members []Member) error {
+	return SetCapturedEntries(s, members, nil)
+}
+
+// SetCapturedEntries is like SetEntries, filling the group fields of each value
+// from its key with capture when it isn't nil.
+func SetCapturedEntries[S ~[]jsonpat.Entry[T], T any](s *S, members []Member, capture func(key string, v *T) error) error {
+	if len(members) == 0 {
+		return nil
+	}
+	sortByIndex(members)
+
+	entries := make(S, len(members))
+	for i, m := range members {
+		entries[i].Key = m.Key
+		if err := decodeCaptured(m, &entries[i].Value, capture); err != nil {
+			return err
+		}
+	}
+	*s = entries
+	return nil
+}
+
+// decodeCaptured decodes the value of m into v, then fills its group fields with
+// capture when it isn't nil.
+func decodeCaptured[T any](m Member, v *T, capture func(key string, v *T) error) error {
+	if err := json.Unmarshal(m.Value, v); err != nil {
+		return fmt.Errorf("failed to unmarshal dynamic key %s: %w", m.Key, err)
+	}
+	if capture == nil {
+		return nil
+	}
+	if err := capture(m.Key, v); err != nil {
+		return fmt.Errorf("failed to unmarshal dynamic key %s: %w", m.Key, err)
+	}
+	return nil
+}
+
+// sortByIndex puts members back in document order, since the keys that fell
+// through from the scalar fields are collected last.
+func sortByIndex(members []Member) {
+	slices.SortFunc(members, func(a, b Member) int { return a.Index - b.Index })
+}
+
+// UnmarshalQuoted decodes a value into a field with the `string` json tag
+// option, as encoding/json does.
+func UnmarshalQuoted(data []byte, v any) error {
+	if len(data) == 0 || data[0] != '"' {
+		if string(data) != "null" {
+			return fmt.Errorf("invalid use of ,string struct tag, trying to unmarshal %s into %s", data, reflect.TypeOf(v).Elem())
+		}
+		return json.Unmarshal(data, v)
+	}
+
+	var inner string
+	if err := json.Unmarshal(data, &inner); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(inner), v)
+}
+
+// Writer writes a json object, keeping track of the keys already written so
+// that no key is written twice.
+type Writer struct {
+	buf     bytes.Buffer
+	written map[string]bool
+}
+
+// Written reports whether key has already been written.
+func (w *Writer) Written(key string) bool {
+	return w.written[key]
+}
+
+// Member writes the json encoding of v under key.
+func (w *Writer) Member(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.write(key, value)
+}
+
+// Quoted writes v under key, encoded as a json string as the `string` json tag
+// option does.
+func (w *Writer) Quoted(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if string(value) != "null" {
+		if value, err = json.Marshal(string(value)); err != nil {
+			return err
+		}
+	}
+	return w.write(key, value)
+}
+
+// Bytes closes the object and returns its encoding.
+func (w *Writer) Bytes() []byte {
+	if w.buf.Len() == 0 {
+		w.buf.WriteByte('{')
+	}
+	w.buf.WriteByte('}')
+	return w.buf.Bytes()
+}
+
+func (w *Writer) write(key string, value []byte) error {
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	if w.written == nil {
+		w.written = make(map[string]bool)
+		w.buf.WriteByte('{')
+	} else {
+		w.buf.WriteByte(',')
+	}
+	w.written[key] = true
+
+	w.buf.Write(encodedKey)
+	w.buf.WriteByte(':')
+	w.buf.Write(value)
+	return nil
+}
+
+// WriteEntries writes the entries of m in sorted key order, skipping any key
+// that has already been written.
+func WriteEntries[M ~map[K]V, K comparable, V any](w *Writer, m M) error {
+	return WriteAffixedEntries(w, m, "", "")
+}
+
+// WriteAffixedEntries is like WriteEntries, but wraps every key of m in prefix
+// and suffix, rebuilding the keys trimmed by the `trim` option.
+func WriteAffixedEntries[M ~map[K]V, K comparable, V any](w *Writer, m M, prefix, suffix string) error {
+	keys := make([]string, 0, len(m))
+	values := make(map[string]V, len(m))
+	for k, v := range m {
+		key, err := formatKey(k)
+		if err != nil {
+			return err
+		}
+		key = prefix + key + suffix
+		keys = append(keys, key)
+		values[key] = v
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if w.Written(key) {
+			continue
+		}
+		if err := w.Member(key, values[key]); err != nil {
+			return fmt.Errorf("failed to marshal map key %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// WriteNestedEntries writes the values of the nested maps m in sorted key order,
+// under the keys built from the literals of the compiled template re, skipping
+// any key that has already been written.
+func WriteNestedEntries(w *Writer, m any, re *regexp.Regexp, literals ...string) error {
+	var keys []string
+	values := make(map[string]reflect.Value)
+	err := mapkey.Walk(reflect.ValueOf(m), len(literals)-1, func(segments []string, v reflect.Value) error {
+		key, err := tags.FormatTemplate(re, literals, segments)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested map entry: %w", err)
+		}
+		keys = append(keys, key)
+		values[key] = v
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if w.Written(key) {
+			continue
+		}
+		if err := w.Member(key, values[key].Interface()); err != nil {
+			return fmt.Errorf("failed to marshal map key %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// WriteEntrySlice writes entries in slice order, skipping any key that has
+// already been written.
+func WriteEntrySlice[S ~[]jsonpat.Entry[T], T any](w *Writer, entries S) error {
+	for i := range entries {
+		entry := &entries[i]
+		if w.Written(entry.Key) {
+			continue
+		}
+		if err := w.Member(entry.Key, &entry.Value); err != nil {
+			return fmt.Errorf("failed to marshal dynamic key %s: %w", entry.Key, err)
+		}
+	}
+	return nil
+}
+
+// formatKey returns the json key the map key k is encoded as.
+func formatKey[K comparable](k K) (string, error) {
+	if s, ok := any(k).(string); ok {
+		return s, nil
+	}
+	return mapkey.Format(reflect.ValueOf(k))
+}
+
+// IsZero reports whether v is its type's zero value. The generator only calls
+// it for types whose zero value it can't compare against directly.
+func IsZero(v any) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+// IsEmpty reports whether v is empty according to the `omitempty` rules of
+// encoding/json. Like IsZero, it is only called for types the generator can't
+// resolve.
+func IsEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return rv.IsZero()
+	}
+	return false
+}
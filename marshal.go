@@ -0,0 +1,414 @@
+package jsonpat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/internal/mapkey"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// Marshal returns the json encoding of v, supporting `jsonpat` tags while
+// preserving existing `json` tagging functionality. Known fields are encoded as
+// encoding/json would encode them, and the entries of dynamic map fields are
+// written as sibling keys of the enclosing object rather than as a nested object.
+//
+// Known fields are selected from embedded structs by the rules of encoding/json,
+// so fields behind nil embedded pointers are left out. Embedded structs of
+// unexported types named by a json tag are skipped, as their values can't be
+// reached.
+//
+// Dynamic scalar fields are written under a key derived from their pattern, so
+// they are only supported for prefix, contains and suffix matchers, and for regex
+// and glob matchers whose pattern is a literal string. Zero valued dynamic scalar fields
+// are omitted.
+//
+// Dynamic map fields with template patterns are written under the keys that
+// their first template builds from the keys of their nested maps.
+//
+// Dynamic slice fields of Entry values are written in slice order under their
+// keys. Other dynamic slice fields carry no keys, so they can only be encoded
+// when empty.
+//
+// When a key would be written more than once, known fields take precedence over
+// dynamic scalar fields, then dynamic map fields, then dynamic slice fields, then
+// the remaining field.
+func Marshal(v interface{}) ([]byte, error) {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		return json.Marshal(v)
+	}
+
+	patterns, err := hasPatterns(val.Type(), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze type %s: %w", val.Type(), err)
+	}
+
+	// no jsonpat fields, delegate completely to std lib
+	if !patterns {
+		return json.Marshal(v)
+	}
+
+	var buf bytes.Buffer
+	if err = marshalValue(&buf, val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalIndent is like Marshal but applies json.Indent to format the output.
+func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	b, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = json.Indent(&buf, b, prefix, indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalValue encodes v, applying jsonpat tags to any struct reachable from v
+// through pointers, slices, arrays and maps. Values that don't reach any jsonpat
+// fields are encoded by the std lib.
+func marshalValue(buf *bytes.Buffer, v reflect.Value) error {
+	patterns, err := hasPatterns(v.Type(), true)
+	if err != nil {
+		return fmt.Errorf("failed to analyze type %s: %w", v.Type(), err)
+	}
+	if !patterns {
+		value, err := json.Marshal(addrInterface(v))
+		if err != nil {
+			return err
+		}
+		buf.Write(value)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return marshalValue(buf, v.Elem())
+	case reflect.Struct:
+		return marshalStruct(buf, v)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err = marshalValue(buf, v.Index(i)); err != nil {
+				return fmt.Errorf("failed to marshal element %d: %w", i, err)
+			}
+		}
+		buf.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		buf.WriteByte('{')
+		if err = marshalMapEntries(buf, make(map[string]bool), v, nil); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func marshalStruct(buf *bytes.Buffer, structVal reflect.Value) error {
+	info, err := getStructInfo(structVal.Type())
+	if err != nil {
+		return fmt.Errorf("failed to analyze struct %s: %w", structVal.Type().Name(), err)
+	}
+	if info.tagging.capture != nil {
+		field, err := structVal.FieldByIndexErr(info.tagging.capture.value)
+		if err != nil {
+			buf.WriteString("null") // the Value field is behind a nil embedded pointer
+			return nil
+		}
+		return marshalValue(buf, field)
+	}
+
+	written := make(map[string]bool)
+	buf.WriteByte('{')
+
+	// like encoding/json, fields behind nil embedded pointers are left out
+	for _, known := range info.tagging.knownFieldOrder {
+		field, err := structVal.FieldByIndexErr(known.fieldIndices)
+		if err != nil || known.omitEmpty && isEmptyValue(field) {
+			continue
+		}
+
+		if err = writeKey(buf, written, known.name); err != nil {
+			return err
+		}
+		if err = marshalKnown(buf, field, known); err != nil {
+			return fmt.Errorf("failed to marshal known key %s: %w", known.name, err)
+		}
+	}
+
+	for _, dynInfo := range info.tagging.dynamicScalarFields {
+		field, err := structVal.FieldByIndexErr(dynInfo.fieldIndices)
+		if err != nil || field.IsZero() {
+			continue
+		}
+
+		key, ok := scalarKey(dynInfo)
+		if !ok {
+			return fmt.Errorf(
+				"failed to marshal dynamic scalar field %s: cannot derive a key from %s",
+				structVal.Type().FieldByIndex(dynInfo.fieldIndices).Name,
+				describePatterns(dynInfo.matchers),
+			)
+		}
+		if written[key] {
+			continue
+		}
+
+		if err = writeKey(buf, written, key); err != nil {
+			return err
+		}
+		if err = marshalValue(buf, field); err != nil {
+			return fmt.Errorf("failed to marshal dynamic scalar key %s: %w", key, err)
+		}
+	}
+
+	for _, dynInfo := range info.tagging.dynamicMapFields {
+		field, err := structVal.FieldByIndexErr(dynInfo.fieldIndices)
+		if err != nil {
+			continue
+		}
+		if dynInfo.nested > 0 {
+			if err = marshalNestedEntries(buf, written, field, dynInfo); err != nil {
+				return err
+			}
+			continue
+		}
+		if !dynInfo.trim {
+			if err = marshalMapEntries(buf, written, field, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if dynInfo.affixes == nil {
+			if field.Len() == 0 {
+				continue
+			}
+			return fmt.Errorf(
+				"failed to marshal dynamic map field %s: cannot rebuild keys trimmed by %s",
+				structVal.Type().FieldByIndex(dynInfo.fieldIndices).Name,
+				describePatterns(dynInfo.matchers),
+			)
+		}
+		if err = marshalMapEntries(buf, written, field, dynInfo.affixes); err != nil {
+			return err
+		}
+	}
+
+	for _, dynInfo := range info.tagging.dynamicSliceFields {
+		field, err := structVal.FieldByIndexErr(dynInfo.fieldIndices)
+		if err != nil {
+			continue
+		}
+		if !dynInfo.entries {
+			if field.Len() == 0 {
+				continue
+			}
+			return fmt.Errorf(
+				"failed to marshal dynamic slice field %s: its values have no keys; use []jsonpat.Entry[T] to keep them",
+				structVal.Type().FieldByIndex(dynInfo.fieldIndices).Name,
+			)
+		}
+		if err = marshalEntries(buf, written, field); err != nil {
+			return err
+		}
+	}
+
+	if info.tagging.remainingField != nil {
+		if field, err := structVal.FieldByIndexErr(info.tagging.remainingField); err == nil {
+			if err = marshalMapEntries(buf, written, field, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	buf.WriteByte('}')
+	return nil
+}
+
+// marshalKnown encodes a known field, honouring the `string` json tag option.
+func marshalKnown(buf *bytes.Buffer, field reflect.Value, known *knownFieldInfo) error {
+	if !known.quoted {
+		return marshalValue(buf, field)
+	}
+
+	value, err := json.Marshal(addrInterface(field))
+	if err != nil {
+		return err
+	}
+	if string(value) != "null" {
+		if value, err = json.Marshal(string(value)); err != nil {
+			return err
+		}
+	}
+	buf.Write(value)
+	return nil
+}
+
+// marshalMapEntries writes the entries of a map in sorted key order, skipping any
+// key that has already been written. Keys are wrapped in affixes when given.
+func marshalMapEntries(buf *bytes.Buffer, written map[string]bool, m reflect.Value, affixes *keyAffixes) error {
+	keys := make([]string, 0, m.Len())
+	values := make(map[string]reflect.Value, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		key, err := mapkey.Format(iter.Key())
+		if err != nil {
+			return err
+		}
+		if affixes != nil {
+			key = affixes.prefix + key + affixes.suffix
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	return writeEntries(buf, written, keys, values)
+}
+
+// writeEntries writes values in the sorted order of keys, skipping any key that
+// has already been written.
+func writeEntries(buf *bytes.Buffer, written map[string]bool, keys []string, values map[string]reflect.Value) error {
+	slices.Sort(keys)
+	for _, key := range keys {
+		if written[key] {
+			continue
+		}
+
+		if err := writeKey(buf, written, key); err != nil {
+			return err
+		}
+		if err := marshalValue(buf, values[key]); err != nil {
+			return fmt.Errorf("failed to marshal map key %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// marshalEntries writes a slice of Entry values in slice order, skipping any key
+// that has already been written.
+func marshalEntries(buf *bytes.Buffer, written map[string]bool, entries reflect.Value) error {
+	for i := 0; i < entries.Len(); i++ {
+		entry := entries.Index(i)
+		key := entry.Field(0).String()
+		if written[key] {
+			continue
+		}
+
+		if err := writeKey(buf, written, key); err != nil {
+			return err
+		}
+		if err := marshalValue(buf, entry.Field(1)); err != nil {
+			return fmt.Errorf("failed to marshal dynamic key %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// writeKey writes the key of an object member, preceded by a separator when it
+// isn't the first member of the object.
+func writeKey(buf *bytes.Buffer, written map[string]bool, key string) error {
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	if len(written) > 0 {
+		buf.WriteByte(',')
+	}
+	written[key] = true
+
+	buf.Write(encodedKey)
+	buf.WriteByte(':')
+	return nil
+}
+
+// scalarKey derives the json key a dynamic scalar field is written under, from
+// the first of its patterns a key that isn't excluded can be derived from. No
+// key is derived from custom matchers.
+func scalarKey(fieldInfo dynamicFieldInfo) (string, bool) {
+	for _, m := range fieldInfo.matchers {
+		if m.custom != nil {
+			continue
+		}
+
+		key, ok := m.value, true
+		if m.re != nil {
+			pattern := m.re.String()
+			if fieldInfo.fold {
+				// any spelling of a literal matches its case-insensitive form
+				pattern = tags.UnfoldRegex(pattern)
+			}
+			key, ok = tags.RegexLiteral(pattern)
+		}
+
+		if ok && !fieldInfo.excluded(key) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// describePatterns describes the patterns of a field for error messages.
+func describePatterns(matchers []patternMatcher) string {
+	descriptions := make([]string, len(matchers))
+	for i, m := range matchers {
+		descriptions[i] = fmt.Sprintf("%s pattern %q", m.loadType, m.value)
+	}
+	return strings.Join(descriptions, " or ")
+}
+
+// addrInterface returns a pointer to v when possible, so that methods with
+// pointer receivers (such as MarshalJSON) are used like in encoding/json.
+func addrInterface(v reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	return v.Interface()
+}
+
+// isEmptyValue reports whether v is empty according to the `omitempty` rules
+// of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Ptr:
+		return v.IsZero()
+	}
+	return false
+}
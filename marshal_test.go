@@ -0,0 +1,446 @@
+package jsonpat
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type MarshalStruct struct {
+	EmbeddedStruct
+	KnownField string `json:"known_field"`
+	OtherKnown int    `json:"other,omitempty"`
+	Quoted     int    `json:"quoted,string"`
+	Ignored    string `json:"-"`
+
+	DynamicPrefix map[string]int    `jsonpat:"dyn_,prefix"`
+	DynamicRegex  map[string]string `jsonpat:"^re_.*$,regex"`
+
+	ScalarPrefix string `jsonpat:"scalar_pfx_,prefix"`
+	ScalarRegex  bool   `jsonpat:"^scalar_re$,regex"`
+}
+
+func TestMarshal(t *testing.T) {
+	typeCache = sync.Map{}
+
+	input := MarshalStruct{
+		EmbeddedStruct: EmbeddedStruct{
+			EmbeddedField: "i am embedded",
+			DynamicSuffix: map[string]interface{}{"some_suffix": "test"},
+		},
+		KnownField:    "hello",
+		Quoted:        42,
+		Ignored:       "should not be written",
+		DynamicPrefix: map[string]int{"dyn_xyz": 2, "dyn_abc": 1},
+		DynamicRegex:  map[string]string{"re_a123": "regex-A"},
+		ScalarPrefix:  "scalar-prefix-val",
+		ScalarRegex:   true,
+	}
+
+	data, err := Marshal(&input)
+	require.NoError(t, err, "Marshal should not fail")
+
+	assert.JSONEq(t, `{
+		"embedded_field": "i am embedded",
+		"some_suffix": "test",
+		"known_field": "hello",
+		"quoted": "42",
+		"dyn_abc": 1,
+		"dyn_xyz": 2,
+		"re_a123": "regex-A",
+		"scalar_pfx_": "scalar-prefix-val",
+		"scalar_re": true
+	}`, string(data))
+
+	// known fields keep their struct order, dynamic map keys are sorted
+	assert.Equal(t,
+		`{"embedded_field":"i am embedded","known_field":"hello","quoted":"42",`+
+			`"scalar_pfx_":"scalar-prefix-val","scalar_re":true,`+
+			`"some_suffix":"test","dyn_abc":1,"dyn_xyz":2,"re_a123":"regex-A"}`,
+		string(data),
+	)
+
+	var result MarshalStruct
+	require.NoError(t, Unmarshal(data, &result), "Unmarshal of marshaled data should not fail")
+	input.Ignored = ""
+	assert.Equal(t, input, result, "round trip mismatch")
+}
+
+func TestMarshal_KnownFieldsTakePrecedence(t *testing.T) {
+	type Conflicting struct {
+		Name    string         `json:"dyn_name"`
+		Scalar  string         `jsonpat:"dyn_scalar,prefix"`
+		Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+	}
+
+	data, err := Marshal(Conflicting{
+		Name:    "known",
+		Scalar:  "scalar",
+		Dynamic: map[string]int{"dyn_name": 1, "dyn_scalar": 2, "dyn_other": 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"dyn_name":"known","dyn_scalar":"scalar","dyn_other":3}`, string(data))
+}
+
+func TestMarshal_StandardStructOptimization(t *testing.T) {
+	type PlainStruct struct {
+		Name string `json:"name"`
+		Age  int    `json:"age,omitempty"`
+	}
+
+	data, err := Marshal(PlainStruct{Name: "test"})
+	require.NoError(t, err)
+
+	expected, err := json.Marshal(PlainStruct{Name: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(data))
+}
+
+func TestMarshal_NonStruct(t *testing.T) {
+	data, err := Marshal(map[string]int{"a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(data))
+
+	var nilPtr *TestStruct
+	data, err = Marshal(nilPtr)
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+}
+
+func TestMarshal_Errors(t *testing.T) {
+	typeCache = sync.Map{}
+
+	type NonLiteralRegex struct {
+		Scalar string `jsonpat:"^scalar_\\d+$,regex"`
+	}
+
+	_, err := Marshal(NonLiteralRegex{Scalar: "value"})
+	assert.Error(t, err, "Expected error for scalar field with a non-literal regex")
+
+	_, err = Marshal(NonLiteralRegex{})
+	assert.NoError(t, err, "Zero valued scalar fields should be omitted")
+
+	type BadValue struct {
+		Dynamic map[string]interface{} `jsonpat:"dyn_,prefix"`
+	}
+	_, err = Marshal(BadValue{Dynamic: map[string]interface{}{"dyn_a": make(chan int)}})
+	assert.Error(t, err, "Expected error for unsupported dynamic value")
+
+	type BadTag struct {
+		Dynamic map[string]int `jsonpat:"dyn_,invalid_type"`
+	}
+	_, err = Marshal(BadTag{})
+	assert.Error(t, err, "Expected error for invalid tag")
+}
+
+func TestMarshalIndent(t *testing.T) {
+	type Indented struct {
+		Name    string         `json:"name"`
+		Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+	}
+
+	data, err := MarshalIndent(Indented{Name: "a", Dynamic: map[string]int{"dyn_b": 1}}, "", "  ")
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"name\": \"a\",\n  \"dyn_b\": 1\n}", string(data))
+}
+
+func TestMarshal_Nested(t *testing.T) {
+	typeCache = sync.Map{}
+
+	input := NestedStruct{
+		ID:      "root",
+		Meta:    NestedItem{Name: "meta", Attrs: map[string]int{"attr_a": 1}},
+		MetaPtr: &NestedItem{Name: "ptr"},
+		Items:   []NestedItem{{Name: "first", Attrs: map[string]int{"attr_c": 3}}},
+		Pair:    [2]NestedItem{{Name: "left"}, {Name: "right"}},
+		ByName:  map[string]NestedItem{"x": {Name: "mapped", Attrs: map[string]int{"attr_f": 6}}},
+		Tree: &NestedNode{
+			Label:    "parent",
+			Children: []NestedNode{{Label: "child", Tags: map[string]int{"tag_c": 8}}},
+		},
+	}
+
+	data, err := Marshal(input)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"id": "root",
+		"meta": {"name": "meta", "attr_a": 1},
+		"meta_ptr": {"name": "ptr"},
+		"items": [{"name": "first", "attr_c": 3}],
+		"pair": [{"name": "left"}, {"name": "right"}],
+		"by_name": {"x": {"name": "mapped", "attr_f": 6}},
+		"tree": {"label": "parent", "children": [{"label": "child", "children": null, "tag_c": 8}]},
+		"untagged": null
+	}`, string(data))
+
+	var result NestedStruct
+	require.NoError(t, Unmarshal(data, &result))
+	assert.Equal(t, input.Items, result.Items)
+	assert.Equal(t, input.ByName, result.ByName)
+	assert.Equal(t, input.Tree.Children[0].Tags, result.Tree.Children[0].Tags)
+}
+
+func TestMarshal_Remaining(t *testing.T) {
+	type WithRemaining struct {
+		Known   string                     `json:"known"`
+		Dynamic map[string]int             `jsonpat:"dyn_,prefix"`
+		Rest    map[string]json.RawMessage `jsonpat:",remaining"`
+	}
+
+	input := WithRemaining{
+		Known:   "k",
+		Dynamic: map[string]int{"dyn_x": 1},
+		Rest: map[string]json.RawMessage{
+			"known": json.RawMessage(`"shadowed"`),
+			"zeta":  json.RawMessage(`{"a": [1, 2]}`),
+			"alpha": json.RawMessage(`true`),
+		},
+	}
+
+	data, err := Marshal(input)
+	require.NoError(t, err)
+	assert.Equal(t, `{"known":"k","dyn_x":1,"alpha":true,"zeta":{"a":[1,2]}}`, string(data))
+
+	var result WithRemaining
+	require.NoError(t, Unmarshal(data, &result))
+	assert.Equal(t, json.RawMessage(`{"a":[1,2]}`), result.Rest["zeta"])
+	assert.Len(t, result.Rest, 2)
+}
+
+func TestMarshal_Glob(t *testing.T) {
+	type Globbed struct {
+		Literal string         `jsonpat:"env.url,glob"`
+		Wild    string         `jsonpat:"env_*,glob"`
+		Dynamic map[string]int `jsonpat:"{a,b}_*,glob"`
+	}
+
+	data, err := Marshal(Globbed{Literal: "x", Dynamic: map[string]int{"a_1": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"env.url":"x","a_1":1}`, string(data))
+
+	_, err = Marshal(Globbed{Wild: "x"})
+	assert.Error(t, err, "Expected error for scalar field with a wildcard glob")
+}
+
+func TestMarshal_CaseInsensitive(t *testing.T) {
+	type Folded struct {
+		Prefix string `jsonpat:"X-Request-,prefix,ci"`
+		Regex  string `jsonpat:"^x-trace$,regex,ci"`
+	}
+
+	data, err := Marshal(Folded{Prefix: "a", Regex: "b"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"X-Request-":"a","x-trace":"b"}`, string(data))
+}
+
+func TestMarshal_MultiplePatterns(t *testing.T) {
+	type Alternatives struct {
+		Owner   string         `jsonpat:"^owner_\\d+$,regex|owner,prefix"`
+		Wild    string         `jsonpat:"^a+$,regex|b_*,glob"`
+		Dynamic map[string]int `jsonpat:"cpu_,prefix|mem_,prefix"`
+	}
+
+	data, err := Marshal(Alternatives{Owner: "o", Dynamic: map[string]int{"mem_1": 1, "cpu_1": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"owner":"o","cpu_1":1,"mem_1":1}`, string(data), "The key should come from the first pattern it can be derived from")
+
+	_, err = Marshal(Alternatives{Wild: "x"})
+	assert.ErrorContains(t, err, `cannot derive a key from regex pattern "^a+$" or glob pattern "b_*"`)
+}
+
+func TestMarshal_Exclude(t *testing.T) {
+	type Excluded struct {
+		Owner string `jsonpat:"owner,prefix|^maintainer$,regex,exclude=owner"`
+		None  string `jsonpat:"none,prefix,exclude=none"`
+	}
+
+	data, err := Marshal(Excluded{Owner: "o"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"maintainer":"o"}`, string(data), "Excluded keys shouldn't be derived")
+
+	_, err = Marshal(Excluded{None: "n"})
+	assert.Error(t, err)
+}
+
+func TestMarshal_Trim(t *testing.T) {
+	type Trimmed struct {
+		Dynamic map[string]int    `jsonpat:"dyn_,prefix,trim"`
+		Totals  map[string]int    `jsonpat:"_total,suffix,trim"`
+		Metrics map[string]string `jsonpat:"^(a|b)_(\\w+)$,regex|^m\\.(?P<key>.+)\\.p99$,regex,trim"`
+		Loose   map[string]int    `jsonpat:"^(a|b)_(\\w+)$,regex,trim"`
+	}
+
+	value := Trimmed{
+		Dynamic: map[string]int{"b": 2, "a": 1},
+		Totals:  map[string]int{"req": 3},
+		Metrics: map[string]string{"cpu": "c"},
+	}
+	data, err := Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"dyn_a":1,"dyn_b":2,"req_total":3,"m.cpu.p99":"c"}`, string(data), "Keys should be rebuilt from the first pattern allowing it")
+
+	var result Trimmed
+	require.NoError(t, Unmarshal(data, &result))
+	assert.Equal(t, value.Dynamic, result.Dynamic)
+	assert.Equal(t, value.Totals, result.Totals)
+	assert.Equal(t, value.Metrics, result.Metrics)
+
+	_, err = Marshal(Trimmed{Loose: map[string]int{"x": 1}})
+	assert.ErrorContains(t, err, "cannot rebuild keys trimmed by regex pattern")
+}
+
+func TestMarshal_TypedMapKeys(t *testing.T) {
+	type Typed struct {
+		Ports  map[int]string     `jsonpat:"port_,prefix,trim"`
+		Shards map[shardID]string `jsonpat:"_shard,suffix,trim"`
+		Codes  map[uint16]bool    `jsonpat:"code_,prefix"`
+	}
+
+	value := Typed{
+		Ports:  map[int]string{80: "http", 443: "https", -1: "none"},
+		Shards: map[shardID]string{{region: "eu", n: 3}: "s"},
+		Codes:  map[uint16]bool{},
+	}
+	data, err := Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"port_-1":"none","port_443":"https","port_80":"http","eu-3_shard":"s"}`, string(data), "Keys should be sorted by their encoded form")
+
+	var result Typed
+	require.NoError(t, Unmarshal(data, &result))
+	assert.Equal(t, value, result)
+
+	data, err = Marshal(map[uint16]Typed{8: {}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"8":{}}`, string(data))
+}
+
+func TestMarshal_SliceFields(t *testing.T) {
+	type Collected struct {
+		ID      string           `json:"id"`
+		Entries []Entry[int]     `jsonpat:"val_,prefix"`
+		Labels  map[string]int   `jsonpat:"lbl_,prefix"`
+		Ordered []Entry[float64] `jsonpat:"lbl_,prefix"`
+		Values  []int            `jsonpat:"num_,prefix"`
+	}
+
+	value := Collected{
+		ID:      "c",
+		Entries: []Entry[int]{{"val_z", 26}, {"id", 0}, {"val_a", 1}, {"val_z", 0}},
+		Labels:  map[string]int{"lbl_a": 1},
+		Ordered: []Entry[float64]{{"lbl_b", 2}, {"lbl_a", 0}},
+	}
+	data, err := Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"c","lbl_a":1,"val_z":26,"val_a":1,"lbl_b":2}`, string(data), "Entries should keep their order, skipping written keys")
+
+	var result Collected
+	require.NoError(t, Unmarshal(data, &result))
+	assert.Equal(t, []Entry[int]{{"val_z", 26}, {"val_a", 1}}, result.Entries)
+
+	_, err = Marshal(Collected{Values: []int{1}})
+	assert.ErrorContains(t, err, "failed to marshal dynamic slice field Values")
+}
+
+// The embedding structs below have a jsonpat field hidden from encoding/json,
+// left empty so that both encode the same keys.
+type embedInner struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+type EmbedExported struct {
+	A string `json:"a"`
+	C string `json:"c"`
+}
+
+type EmbedOther struct {
+	D string
+	G string `json:"g"`
+}
+
+type EmbedMore struct {
+	D string
+}
+
+type EmbedTagged struct {
+	EmbedExported `json:"exported"`
+	M             map[string]int `json:"-" jsonpat:"m_,prefix"`
+}
+
+type EmbedUnexported struct {
+	embedInner
+	M map[string]int `json:"-" jsonpat:"m_,prefix"`
+}
+
+type EmbedPointer struct {
+	*EmbedExported
+	E string         `json:"e"`
+	M map[string]int `json:"-" jsonpat:"m_,prefix"`
+}
+
+type EmbedDuplicates struct {
+	EmbedOther
+	EmbedMore
+	B string         `json:"b"`
+	M map[string]int `json:"-" jsonpat:"m_,prefix"`
+}
+
+type EmbedNamed struct {
+	Named string `json:"D"`
+}
+
+type EmbedTaggedWins struct {
+	EmbedOther
+	EmbedNamed
+	M map[string]int `json:"-" jsonpat:"m_,prefix"`
+}
+
+type EmbedShadowed struct {
+	*EmbedExported
+	embedInner
+	A string         `json:"a"`
+	M map[string]int `json:"-" jsonpat:"m_,prefix"`
+}
+
+func TestMarshal_EmbeddedFieldsMatchEncodingJSON(t *testing.T) {
+	testCases := map[string]any{
+		"tagged embed is a named field": EmbedTagged{EmbedExported: EmbedExported{A: "a", C: "c"}},
+		"unexported embed is promoted":  EmbedUnexported{embedInner: embedInner{A: "a", B: "b"}},
+		"pointer embed is promoted":     EmbedPointer{EmbedExported: &EmbedExported{A: "a", C: "c"}, E: "e"},
+		"nil pointer embed is left out": EmbedPointer{E: "e"},
+		"same depth duplicates are dropped": EmbedDuplicates{
+			EmbedOther: EmbedOther{D: "d1", G: "g"},
+			EmbedMore:  EmbedMore{D: "d2"},
+			B:          "b",
+		},
+		"tagged duplicate wins": EmbedTaggedWins{EmbedOther: EmbedOther{D: "d1", G: "g"}, EmbedNamed: EmbedNamed{Named: "d2"}},
+		"shallower fields win": EmbedShadowed{
+			EmbedExported: &EmbedExported{A: "a1", C: "c"},
+			embedInner:    embedInner{A: "a2", B: "b"},
+			A:             "a3",
+		},
+	}
+
+	for name, value := range testCases {
+		t.Run(name, func(t *testing.T) {
+			expected, err := json.Marshal(value)
+			require.NoError(t, err)
+
+			data, err := Marshal(value)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(data))
+
+			// decoding fills the same fields encoding/json would
+			result := reflect.New(reflect.TypeOf(value))
+			require.NoError(t, Unmarshal(expected, result.Interface()))
+			decoded, err := json.Marshal(result.Interface())
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(decoded))
+		})
+	}
+}
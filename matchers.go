@@ -3,55 +3,176 @@ package jsonpat
 import (
 	"fmt"
 	"strings"
+	"sync"
+
+	"github.com/jamieyoung5/jsonpat/internal/fold"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
 )
 
 const (
-	prefixLoadType   = "prefix"
-	containsLoadType = "contains"
-	suffixLoadType   = "suffix"
-	regexLoadType    = "regex"
+	prefixLoadType   = tags.Prefix
+	containsLoadType = tags.Contains
+	suffixLoadType   = tags.Suffix
+	regexLoadType    = tags.Regex
+	globLoadType     = tags.Glob
+	templateLoadType = tags.Template
+)
+
+// A Matcher decides which json keys a field with a custom matcher claims. It is
+// built from the value of a pattern by the factory given to RegisterMatcher, and
+// may be called concurrently.
+type Matcher interface {
+	Match(key string) bool
+}
+
+// MatcherFunc adapts an ordinary function to the Matcher interface.
+type MatcherFunc func(key string) bool
+
+// Match calls f(key).
+func (f MatcherFunc) Match(key string) bool {
+	return f(key)
+}
 
-	defaultMatcher = prefixLoadType
+// matcherFactories holds the factories of the matchers registered with
+// RegisterMatcher, keyed by name
+var (
+	matcherFactoriesMu sync.RWMutex
+	matcherFactories   = make(map[string]func(value string) (Matcher, error))
 )
 
-var loadTypes = []string{prefixLoadType, containsLoadType, suffixLoadType, regexLoadType}
+// RegisterMatcher makes a custom matcher available to `jsonpat` tags under name,
+// so that a field tagged `jsonpat:"<value>,<name>"` claims the keys accepted by
+// the Matcher that factory builds from <value>. The factory is called once per
+// field, when its struct is first analysed; the error it returns is reported as
+// a *TagError.
+//
+// RegisterMatcher returns an error if factory is nil, or if name is empty,
+// contains spaces or any of `,|=\`, or clashes with a built in matcher, a tag
+// option or a previously registered matcher. Matchers are usually registered
+// from an init function, before any struct using them is decoded.
+func RegisterMatcher(name string, factory func(value string) (Matcher, error)) error {
+	if factory == nil {
+		return fmt.Errorf("jsonpat: matcher %q registered with a nil factory", name)
+	}
 
-func extractMatcher(tagValues []string) (string, error) {
-	if len(tagValues) < 1 || len(tagValues) > 2 {
-		return "", fmt.Errorf(
-			"tag %s must have a value and optional search type",
-			jsonPatTag,
-		)
+	matcherFactoriesMu.Lock()
+	defer matcherFactoriesMu.Unlock()
+	if err := tags.RegisterMatcher(name); err != nil {
+		return fmt.Errorf("jsonpat: %w", err)
 	}
+	matcherFactories[name] = factory
+	return nil
+}
 
-	if len(tagValues) == 2 {
-		matcher := strings.TrimSpace(tagValues[1])
+// newCustomMatcher builds the Matcher of a pattern using a registered matcher.
+func newCustomMatcher(name, value string) (Matcher, error) {
+	matcherFactoriesMu.RLock()
+	factory := matcherFactories[name]
+	matcherFactoriesMu.RUnlock()
 
-		switch matcher {
-		case prefixLoadType, containsLoadType, suffixLoadType, regexLoadType:
-			return matcher, nil
-		default:
-			return "", fmt.Errorf(
-				"tag %s has invalid matcher; must be one of %s",
-				jsonPatTag,
-				strings.Join(loadTypes, ", "),
-			)
+	m, err := factory(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern: %w", name, err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("invalid %s pattern: factory returned a nil Matcher", name)
+	}
+	return m, nil
+}
+
+// match reports whether key matches any of the patterns of a field, and none
+// of its excludes.
+func match(key string, fieldInfo dynamicFieldInfo) bool {
+	for _, m := range fieldInfo.matchers {
+		if m.match(key, fieldInfo.fold) {
+			return !fieldInfo.excluded(key)
 		}
 	}
+	return false
+}
 
-	return defaultMatcher, nil
+// mapKey returns the key a dynamic map field stores the value of a json key it
+// claims under: the json key itself, or with the trim option, the part of the
+// key that the first matching pattern didn't match.
+func (fieldInfo dynamicFieldInfo) mapKey(key string) string {
+	if !fieldInfo.trim {
+		return key
+	}
+	for _, m := range fieldInfo.matchers {
+		if m.match(key, fieldInfo.fold) {
+			return m.trimKey(key, fieldInfo.fold)
+		}
+	}
+	return key
 }
 
-func match(key string, fieldInfo dynamicFieldInfo) bool {
-	switch fieldInfo.loadType {
+// trimKey strips a key matching the pattern of the matched part.
+func (m patternMatcher) trimKey(key string, ci bool) string {
+	switch m.loadType {
 	case prefixLoadType:
-		return strings.HasPrefix(key, fieldInfo.value)
-	case containsLoadType:
-		return strings.Contains(key, fieldInfo.value)
+		if ci {
+			trimmed, _ := fold.TrimPrefix(key, m.value)
+			return trimmed
+		}
+		return strings.TrimPrefix(key, m.value)
 	case suffixLoadType:
-		return strings.HasSuffix(key, fieldInfo.value)
+		if ci {
+			trimmed, _ := fold.TrimSuffix(key, m.value)
+			return trimmed
+		}
+		return strings.TrimSuffix(key, m.value)
 	case regexLoadType:
-		return fieldInfo.re.MatchString(key)
+		if groups := m.re.FindStringSubmatch(key); groups != nil {
+			return groups[m.keyGroup]
+		}
+	}
+	return key
+}
+
+// excluded reports whether key matches any of the excludes of a field.
+func (fieldInfo dynamicFieldInfo) excluded(key string) bool {
+	for _, re := range fieldInfo.excludes {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether key matches the pattern, ignoring case when fold is set.
+func (m patternMatcher) match(key string, fold bool) bool {
+	if m.custom != nil {
+		return m.custom.Match(key)
+	}
+	if fold {
+		return m.matchFold(key)
+	}
+
+	switch m.loadType {
+	case prefixLoadType:
+		return strings.HasPrefix(key, m.value)
+	case containsLoadType:
+		return strings.Contains(key, m.value)
+	case suffixLoadType:
+		return strings.HasSuffix(key, m.value)
+	case regexLoadType, globLoadType, templateLoadType:
+		return m.re.MatchString(key)
+	}
+	return false
+}
+
+// matchFold is the case-insensitive form of match. Regex and glob patterns are
+// compiled as case-insensitive regexes already.
+func (m patternMatcher) matchFold(key string) bool {
+	switch m.loadType {
+	case prefixLoadType:
+		return fold.HasPrefix(key, m.value)
+	case containsLoadType:
+		return fold.Contains(key, m.value)
+	case suffixLoadType:
+		return fold.HasSuffix(key, m.value)
+	case regexLoadType, globLoadType, templateLoadType:
+		return m.re.MatchString(key)
 	}
 	return false
 }
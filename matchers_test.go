@@ -0,0 +1,115 @@
+package jsonpat
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func init() {
+	// uuid claims uuid keys, optionally restricted to a version
+	mustRegister("uuid", func(value string) (Matcher, error) {
+		if value != "" && (len(value) != 1 || value[0] < '1' || value[0] > '8') {
+			return nil, errors.New("uuid version must be between 1 and 8")
+		}
+		return MatcherFunc(func(key string) bool {
+			return uuidPattern.MatchString(key) && (value == "" || key[14] == value[0])
+		}), nil
+	})
+
+	// tenant claims the keys prefixed by one of a set of tenants
+	mustRegister("tenant", func(value string) (Matcher, error) {
+		return tenantMatcher(strings.Split(value, " ")), nil
+	})
+
+	mustRegister("nil_matcher", func(string) (Matcher, error) {
+		return nil, nil
+	})
+}
+
+func mustRegister(name string, factory func(value string) (Matcher, error)) {
+	if err := RegisterMatcher(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+type tenantMatcher []string
+
+func (t tenantMatcher) Match(key string) bool {
+	tenant, _, ok := strings.Cut(key, ".")
+	for _, candidate := range t {
+		if ok && tenant == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUnmarshal_CustomMatcher(t *testing.T) {
+	type Custom struct {
+		Sessions map[string]int    `jsonpat:",uuid"`
+		V4       string            `jsonpat:"4,uuid"`
+		Tenants  map[string]string `jsonpat:"acme globex,tenant|shared_,prefix,exclude=globex.secret"`
+	}
+
+	jsonData := []byte(`{
+		"0b6f6a5e-57a4-4c1e-8d2a-7c1d4b8f9e21": "v4",
+		"1b6f6a5e-57a4-1c1e-8d2a-7c1d4b8f9e21": 1,
+		"not-a-uuid": 2,
+		"acme.plan": "pro", "globex.plan": "free", "globex.secret": "s", "initech.plan": "basic", "shared_x": "x"
+	}`)
+
+	var result Custom
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, "v4", result.V4)
+	assert.Equal(t, map[string]int{"1b6f6a5e-57a4-1c1e-8d2a-7c1d4b8f9e21": 1}, result.Sessions)
+	assert.Equal(t, map[string]string{"acme.plan": "pro", "globex.plan": "free", "shared_x": "x"}, result.Tenants)
+
+	_, err := Marshal(Custom{V4: "v4"})
+	assert.ErrorContains(t, err, "cannot derive a key", "No key can be derived from a custom matcher")
+}
+
+func TestUnmarshal_CustomMatcherErrors(t *testing.T) {
+	var tagErr *TagError
+
+	type BadValue struct {
+		Dynamic map[string]int `jsonpat:"9,uuid"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &BadValue{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "invalid uuid pattern: uuid version must be between 1 and 8")
+
+	type NilMatcher struct {
+		Dynamic map[string]int `jsonpat:"x,nil_matcher"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &NilMatcher{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "nil Matcher")
+
+	type FoldedCustom struct {
+		Dynamic map[string]int `jsonpat:"4,uuid,ci"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &FoldedCustom{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "option ci can't be used with custom matcher uuid")
+
+	type Unregistered struct {
+		Dynamic map[string]int `jsonpat:"x,semver"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &Unregistered{}), &tagErr)
+	assert.ErrorContains(t, tagErr, `invalid matcher "semver"`)
+}
+
+func TestRegisterMatcher_Errors(t *testing.T) {
+	factory := func(string) (Matcher, error) { return MatcherFunc(func(string) bool { return true }), nil }
+
+	assert.ErrorContains(t, RegisterMatcher("uuid", factory), "already registered")
+	assert.ErrorContains(t, RegisterMatcher("regex", factory), "built in matcher")
+	assert.ErrorContains(t, RegisterMatcher("remaining", factory), "tag option")
+	assert.ErrorContains(t, RegisterMatcher("semver,strict", factory), "must not contain")
+	assert.ErrorContains(t, RegisterMatcher("", factory), "must not be empty")
+	assert.ErrorContains(t, RegisterMatcher("semver", nil), "nil factory")
+}
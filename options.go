@@ -0,0 +1,32 @@
+package jsonpat
+
+// Options configures how Unmarshal decodes json data. The zero value gives the
+// same behaviour as Unmarshal.
+type Options struct {
+	// DisallowUnknownFields makes decoding fail with an *UnknownKeysError when an
+	// object holds keys that match neither a known field nor any jsonpat rule of
+	// the struct it is decoded into. Structs with a remaining field never have
+	// unknown keys. Values without jsonpat fields only report their first unknown
+	// key, as encoding/json stops there.
+	DisallowUnknownFields bool
+
+	// CaseSensitiveKnownFields makes known fields match json keys exactly. By
+	// default they are matched like encoding/json does: an exact match is
+	// preferred, falling back to a case-insensitive match. Structs without any
+	// jsonpat fields are decoded by encoding/json unless KeySeparator is set, so
+	// they otherwise always match case-insensitively.
+	CaseSensitiveKnownFields bool
+
+	// KeySeparator unflattens keys such as "db.host": a key that doesn't match a
+	// known field, but starts with the name of a known struct (or pointer to
+	// struct) field followed by the separator, is decoded into that field under
+	// the rest of the key, so that its known fields, jsonpat fields and flattened
+	// keys apply in turn. The shortest such prefix wins. Flattened keys are
+	// decoded after the rest of the object, merging into any value the field was
+	// given under its own key. When set, structs without jsonpat fields are
+	// decoded by jsonpat too rather than by encoding/json, so that their keys can
+	// be unflattened. Fields of types that decode themselves, through
+	// UnmarshalJSON or UnmarshalText (including types generated by jsonpat-gen),
+	// don't take flattened keys, and options don't apply within their values.
+	KeySeparator string
+}
@@ -0,0 +1,243 @@
+package jsonpat
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type StrictItem struct {
+	Name string `json:"name"`
+}
+
+type StrictStruct struct {
+	Known   string         `json:"known"`
+	Ignored string         `json:"-"`
+	Scalar  string         `jsonpat:"pfx_,prefix"`
+	Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+	Items   []NestedItem   `json:"items"`
+	Plain   StrictItem     `json:"plain"`
+}
+
+func TestUnmarshalWithOptions_DisallowUnknownFields(t *testing.T) {
+	opts := Options{DisallowUnknownFields: true}
+
+	var result StrictStruct
+	require.NoError(t, UnmarshalWithOptions(
+		[]byte(`{"known": "k", "pfx_a": "a", "pfx_b": "b", "dyn_x": 1, "items": [{"name": "i", "attr_a": 1}]}`),
+		&result,
+		opts,
+	), "Keys claimed by known or dynamic fields should be allowed")
+	assert.Equal(t, "a", result.Scalar)
+	assert.Equal(t, map[string]int{"dyn_x": 1}, result.Dynamic)
+
+	err := UnmarshalWithOptions(
+		[]byte(`{"known": "k", "zeta": 1, "dyn_x": 1, "Ignored": "x", "alpha": {"a": 1}}`),
+		&result,
+		opts,
+	)
+	var unknownErr *UnknownKeysError
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError, got %v", err)
+	assert.Equal(t, []string{"zeta", "Ignored", "alpha"}, unknownErr.Keys, "Every unknown key should be named in document order")
+	assert.Contains(t, err.Error(), `"zeta", "Ignored", "alpha"`)
+
+	err = UnmarshalWithOptions([]byte(`{"items": [{"name": "i", "other": 1}]}`), &result, opts)
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError for nested structs, got %v", err)
+	assert.Equal(t, []string{"other"}, unknownErr.Keys)
+
+	err = UnmarshalWithOptions([]byte(`{"plain": {"name": "p", "other": 1}}`), &result, opts)
+	require.True(t, errors.As(err, &unknownErr), "Structs without jsonpat fields should be strict too, got %v", err)
+	assert.Equal(t, reflect.TypeOf(StrictItem{}), unknownErr.Type)
+	assert.Equal(t, []string{"other"}, unknownErr.Keys)
+
+	assert.NoError(t, UnmarshalWithOptions([]byte(`{"zeta": 1}`), &result, Options{}), "Unknown keys are allowed by default")
+}
+
+func TestUnmarshalWithOptions_DisallowUnknownFieldsPlainStruct(t *testing.T) {
+	opts := Options{DisallowUnknownFields: true}
+
+	var result StrictItem
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"name": "a"} `), &result, opts))
+	assert.Equal(t, "a", result.Name)
+
+	var unknownErr *UnknownKeysError
+	err := UnmarshalWithOptions([]byte(`{"other": 1}`), &result, opts)
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError, got %v", err)
+	assert.Equal(t, reflect.TypeOf(result), unknownErr.Type)
+	assert.Equal(t, []string{"other"}, unknownErr.Keys)
+
+	err = UnmarshalWithOptions([]byte(`{"name": "a", "weird\"key": 1}`), &result, opts)
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError, got %v", err)
+	assert.Equal(t, []string{`weird"key`}, unknownErr.Keys)
+	assert.Error(t, UnmarshalWithOptions([]byte(`{"name": "a"}}`), &result, opts), "Expected error for trailing data")
+}
+
+func TestUnmarshalWithOptions_DisallowUnknownFieldsRemaining(t *testing.T) {
+	type WithRemaining struct {
+		Known string                 `json:"known"`
+		Rest  map[string]interface{} `jsonpat:",remaining"`
+	}
+
+	var result WithRemaining
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"known": "k", "other": 1}`), &result, Options{DisallowUnknownFields: true}))
+	assert.Equal(t, map[string]interface{}{"other": float64(1)}, result.Rest)
+}
+
+func TestDecoder_DisallowUnknownFields(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(`{"id": "a", "dyn_x": 1} {"id": "b", "extra": true}`))
+	dec.DisallowUnknownFields()
+
+	var record StreamRecord
+	require.NoError(t, dec.Decode(&record))
+
+	var unknownErr *UnknownKeysError
+	err := dec.Decode(&record)
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError, got %v", err)
+	assert.Equal(t, []string{"extra"}, unknownErr.Keys)
+}
+
+type FoldedStruct struct {
+	Name    string         `json:"name"`
+	Upper   string         `json:"NAME"`
+	ID      int            `json:"id"`
+	Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+}
+
+func TestUnmarshal_KnownFieldsFoldCase(t *testing.T) {
+	var result FoldedStruct
+	require.NoError(t, Unmarshal([]byte(`{"Id": 1, "NAME": "upper", "name": "lower", "Dyn_x": 2}`), &result))
+	assert.Equal(t, 1, result.ID, "Known fields should match case-insensitively like encoding/json")
+	assert.Equal(t, "lower", result.Name, "Exact matches should be preferred")
+	assert.Equal(t, "upper", result.Upper)
+	assert.Empty(t, result.Dynamic, "jsonpat matchers stay case-sensitive")
+
+	result = FoldedStruct{}
+	require.NoError(t, Unmarshal([]byte(`{"Name": "folded"}`), &result))
+	assert.Equal(t, "folded", result.Name, "The first field in field order should win among folded matches")
+	assert.Empty(t, result.Upper)
+
+	var plain StrictItem
+	require.NoError(t, json.Unmarshal([]byte(`{"NAME": "n"}`), &plain))
+	var withPatterns StrictStruct
+	require.NoError(t, Unmarshal([]byte(`{"PLAIN": {"NAME": "n"}, "KNOWN": "k"}`), &withPatterns))
+	assert.Equal(t, plain, withPatterns.Plain)
+	assert.Equal(t, "k", withPatterns.Known, "Structs with jsonpat fields should fold like those without")
+
+	err := UnmarshalWithOptions([]byte(`{"KNOWN": "k"}`), &withPatterns, Options{DisallowUnknownFields: true})
+	assert.NoError(t, err, "Keys matching a known field case-insensitively aren't unknown")
+}
+
+func TestUnmarshalWithOptions_CaseSensitiveKnownFields(t *testing.T) {
+	opts := Options{CaseSensitiveKnownFields: true}
+
+	var result FoldedStruct
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"Id": 1, "name": "lower", "Name": "folded"}`), &result, opts))
+	assert.Zero(t, result.ID)
+	assert.Equal(t, "lower", result.Name)
+
+	err := UnmarshalWithOptions([]byte(`{"Id": 1}`), &result, Options{CaseSensitiveKnownFields: true, DisallowUnknownFields: true})
+	var unknownErr *UnknownKeysError
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError, got %v", err)
+	assert.Equal(t, []string{"Id"}, unknownErr.Keys)
+
+	dec := NewDecoder(strings.NewReader(`{"ID": 1}`))
+	dec.CaseSensitiveKnownFields()
+	result = FoldedStruct{}
+	require.NoError(t, dec.Decode(&result))
+	assert.Zero(t, result.ID)
+}
+
+type FlatDB struct {
+	Host    string            `json:"host"`
+	Port    int               `json:"port"`
+	Primary *FlatDB           `json:"primary"`
+	Options map[string]string `jsonpat:"opt_,prefix"`
+}
+
+type FlatConfig struct {
+	Name    string         `json:"name"`
+	DB      FlatDB         `json:"db"`
+	Cache   *StrictItem    `json:"cache"`
+	Tags    []string       `json:"tags"`
+	Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+}
+
+func TestUnmarshalWithOptions_KeySeparator(t *testing.T) {
+	opts := Options{KeySeparator: "."}
+
+	jsonData := []byte(`{
+		"name": "app",
+		"db.host": "db-1", "DB.port": 5432, "db.opt_ssl": "on",
+		"db.primary.host": "db-0",
+		"cache.name": "redis",
+		"dyn_a.b": 1, "tags.x": 2, "other.y": 3
+	}`)
+
+	var result FlatConfig
+	require.NoError(t, UnmarshalWithOptions(jsonData, &result, opts))
+	assert.Equal(t, "app", result.Name)
+	assert.Equal(t, FlatDB{
+		Host:    "db-1",
+		Port:    5432,
+		Primary: &FlatDB{Host: "db-0", Options: map[string]string{}},
+		Options: map[string]string{"opt_ssl": "on"},
+	}, result.DB, "Flattened keys should reach known and jsonpat fields at every level")
+	assert.Equal(t, &StrictItem{Name: "redis"}, result.Cache, "Pointers to structs without jsonpat fields should be allocated")
+	assert.Equal(t, map[string]int{"dyn_a.b": 1}, result.Dynamic, "Keys not starting with a struct field should be left to jsonpat fields")
+	assert.Nil(t, result.Tags)
+
+	result = FlatConfig{}
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"db.port": 1, "db": {"host": "nested", "port": 2}}`), &result, opts))
+	assert.Equal(t, "nested", result.DB.Host, "Flattened keys should be merged into the nested object")
+	assert.Equal(t, 1, result.DB.Port, "Flattened keys should be decoded after the nested object")
+
+	var plain struct {
+		Inner struct {
+			Deep struct {
+				Value int
+			}
+		}
+	}
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"inner__deep__value": 4}`), &plain, Options{KeySeparator: "__"}))
+	assert.Equal(t, 4, plain.Inner.Deep.Value, "Structs without jsonpat fields should be unflattened too")
+
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"db.host": "x"}`), &result, Options{}))
+	assert.Equal(t, "nested", result.DB.Host, "Keys shouldn't be split without a separator")
+
+	err := UnmarshalWithOptions([]byte(`{"db.port": "x"}`), &result, opts)
+	assert.ErrorContains(t, err, "failed to unmarshal flattened keys of db: failed to unmarshal known key port")
+
+	result = FlatConfig{}
+	err = UnmarshalWithOptions(
+		[]byte(`{"DB.other": 1, "db.host": "x", "zeta": 0, "cache.other": 2, "db.primary.other": 3, "db.other": 4}`),
+		&result,
+		Options{KeySeparator: ".", DisallowUnknownFields: true},
+	)
+	var unknownErr *UnknownKeysError
+	require.True(t, errors.As(err, &unknownErr), "Expected an *UnknownKeysError, got %v", err)
+	assert.Equal(t, reflect.TypeOf(result), unknownErr.Type)
+	assert.Equal(t, []string{"DB.other", "zeta", "cache.other", "db.primary.other", "db.other"}, unknownErr.Keys,
+		"Every unknown flattened key should be named as it appears, in document order")
+	assert.Equal(t, "x", result.DB.Host)
+
+	var withTime struct {
+		Created time.Time      `json:"created"`
+		Stamp   *time.Time     `json:"stamp"`
+		Rest    map[string]int `jsonpat:"*.*,glob"`
+	}
+	require.NoError(t, UnmarshalWithOptions([]byte(`{"created.x": 1, "stamp.y": 2}`), &withTime, opts))
+	assert.Equal(t, map[string]int{"created.x": 1, "stamp.y": 2}, withTime.Rest, "Keys of types decoding themselves shouldn't be split")
+	assert.Nil(t, withTime.Stamp)
+
+	dec := NewDecoder(strings.NewReader(`{"db/host": "streamed"}`))
+	dec.KeySeparator("/")
+	result = FlatConfig{}
+	require.NoError(t, dec.Decode(&result))
+	assert.Equal(t, "streamed", result.DB.Host)
+}
@@ -0,0 +1,24 @@
+package jsonpat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshal_CommasInTag(t *testing.T) {
+	type Commas struct {
+		Bounded map[string]int `jsonpat:"^k_\\d{1,3}$,regex"`
+		Class   map[string]int `jsonpat:"^[x,y]_,regex"`
+		Escaped map[string]int `jsonpat:"a\\,b_,prefix"`
+	}
+
+	jsonData := []byte(`{"k_1": 1, "k_123": 2, "k_1234": 3, "x_a": 4, ",_b": 5, "a,b_c": 6}`)
+
+	var result Commas
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]int{"k_1": 1, "k_123": 2}, result.Bounded)
+	assert.Equal(t, map[string]int{"x_a": 4, ",_b": 5}, result.Class)
+	assert.Equal(t, map[string]int{"a,b_c": 6}, result.Escaped)
+}
@@ -0,0 +1,85 @@
+package jsonpat
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/jamieyoung5/jsonpat/internal/mapkey"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
+)
+
+// setNested makes a map field with template patterns store the values of the
+// keys it claims in nested maps, one level per placeholder, keyed by the
+// segments of the keys. It returns the type of the values.
+func (fieldInfo *dynamicFieldInfo) setNested(typ reflect.Type) (reflect.Type, error) {
+	if !slices.ContainsFunc(fieldInfo.matchers, func(m patternMatcher) bool { return m.template != nil }) {
+		return typ.Elem(), nil
+	}
+
+	first := fieldInfo.matchers[0]
+	for _, m := range fieldInfo.matchers {
+		if m.template == nil {
+			return nil, fmt.Errorf("%s patterns of a map field can't be combined with %s patterns", tags.Template, m.loadType)
+		}
+		if first.template == nil || len(m.template.Names) != len(first.template.Names) {
+			return nil, fmt.Errorf("%s patterns of a map field must all have the same number of placeholders", tags.Template)
+		}
+	}
+
+	fieldInfo.nested = len(first.template.Names)
+	for i := 0; i < fieldInfo.nested; i++ {
+		if typ.Kind() != reflect.Map {
+			return nil, fmt.Errorf("%s %q has %d placeholders, but only %d levels of maps to store them in",
+				tags.Template, first.value, fieldInfo.nested, i)
+		}
+		if err := mapkey.Check(typ.Key()); err != nil {
+			return nil, err
+		}
+		typ = typ.Elem()
+	}
+	return typ, nil
+}
+
+// nestedValueType returns the type of the values held levels deep in nested maps
+// of type typ.
+func nestedValueType(typ reflect.Type, levels int) reflect.Type {
+	for i := 0; i < max(levels, 1); i++ {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// segments returns the segments of key, as split by the first template pattern
+// of the field it matches.
+func (fieldInfo dynamicFieldInfo) segments(key string) []string {
+	for _, m := range fieldInfo.matchers {
+		if groups := m.re.FindStringSubmatch(key); groups != nil {
+			return groups[1:]
+		}
+	}
+	return nil
+}
+
+// marshalNestedEntries writes the values of the nested maps of a field with
+// template patterns in sorted key order, under the keys built from the first
+// template, skipping any key that has already been written.
+func marshalNestedEntries(buf *bytes.Buffer, written map[string]bool, m reflect.Value, fieldInfo dynamicFieldInfo) error {
+	first := fieldInfo.matchers[0]
+	var keys []string
+	values := make(map[string]reflect.Value)
+	err := mapkey.Walk(m, fieldInfo.nested, func(segments []string, v reflect.Value) error {
+		key, err := tags.FormatTemplate(first.re, first.template.Literals, segments)
+		if err != nil {
+			return fmt.Errorf("failed to marshal nested map entry: %w", err)
+		}
+		keys = append(keys, key)
+		values[key] = v
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeEntries(buf, written, keys, values)
+}
@@ -0,0 +1,102 @@
+package jsonpat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshal_Template(t *testing.T) {
+	type Metrics struct {
+		Host     string                            `json:"host"`
+		ByRegion map[string]map[string]float64     `jsonpat:"{region}_{metric},template"`
+		Shards   map[string]map[int]map[string]int `jsonpat:"shard.{name}.{n}.{stat},template|SHARD/{name}/{n}/{stat},template,ci"`
+		Samples  map[string]map[string]sample      `jsonpat:"s:{region}:{metric},template"`
+		Latest   float64                           `jsonpat:"latest_{metric},template"`
+	}
+
+	jsonData := []byte(`{
+		"host": "web-1",
+		"us_cpu": 0.5, "us_mem": 0.25, "eu_cpu": 1, "eu_disk_free": 2,
+		"shard.a.1.reads": 3, "shard/a/2/writes": 4, "shard.b.1.reads": 5,
+		"s:us:cpu": 6,
+		"latest_cpu": 7
+	}`)
+
+	result := Metrics{ByRegion: map[string]map[string]float64{"ap": {"cpu": 9}, "us": {"net": 8}}}
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, "web-1", result.Host)
+	assert.Equal(t, map[string]map[string]float64{
+		"ap": {"cpu": 9},
+		"us": {"net": 8, "cpu": 0.5, "mem": 0.25},
+		"eu": {"cpu": 1, "disk_free": 2},
+	}, result.ByRegion, "Keys should be split on the first separator, and existing inner maps kept")
+	assert.Equal(t, map[string]map[int]map[string]int{
+		"a": {1: {"reads": 3}, 2: {"writes": 4}},
+		"b": {1: {"reads": 5}},
+	}, result.Shards)
+	assert.Equal(t, map[string]map[string]sample{"us": {"cpu": {Region: "us", Metric: "cpu", Value: 6}}}, result.Samples,
+		"Placeholders should fill the group fields of capture structs")
+	assert.Equal(t, 7.0, result.Latest, "Template patterns should match scalar fields too")
+
+	err := Unmarshal([]byte(`{"shard.a.x.reads": 1}`), &result)
+	assert.ErrorContains(t, err, `failed to unmarshal dynamic key shard.a.x.reads: invalid map key "x" for type int`)
+}
+
+func TestMarshal_Template(t *testing.T) {
+	type Metrics struct {
+		Host     string                            `json:"host"`
+		ByRegion map[string]map[string]float64     `jsonpat:"{region}_{metric},template"`
+		Shards   map[string]map[int]map[string]int `jsonpat:"shard.{name}.{n}.{stat},template"`
+	}
+
+	value := Metrics{
+		Host:     "web-1",
+		ByRegion: map[string]map[string]float64{"us": {"mem": 0.25, "cpu": 0.5}, "eu": {"disk_free": 2}, "ap": nil},
+		Shards:   map[string]map[int]map[string]int{"a": {10: {"reads": 3}, 2: {"writes": 4}}},
+	}
+	data, err := Marshal(value)
+	require.NoError(t, err)
+	assert.Equal(t, `{"host":"web-1","eu_disk_free":2,"us_cpu":0.5,"us_mem":0.25,"shard.a.10.reads":3,"shard.a.2.writes":4}`, string(data))
+
+	var result Metrics
+	require.NoError(t, Unmarshal(data, &result))
+	value.ByRegion = map[string]map[string]float64{"us": {"mem": 0.25, "cpu": 0.5}, "eu": {"disk_free": 2}}
+	assert.Equal(t, value, result)
+
+	_, err = Marshal(Metrics{ByRegion: map[string]map[string]float64{"u_s": {"cpu": 1}}})
+	assert.ErrorContains(t, err, `segments ["u_s" "cpu"] would be read back differently from key "u_s_cpu"`)
+}
+
+func TestUnmarshal_TemplateErrors(t *testing.T) {
+	var tagErr *TagError
+
+	tests := map[string]any{
+		"template patterns of a map field can't be combined with prefix patterns": &struct {
+			Dyn map[string]map[string]int `jsonpat:"{a}_{b},template|x_,prefix"`
+		}{},
+		"must all have the same number of placeholders": &struct {
+			Dyn map[string]map[string]int `jsonpat:"{a}_{b},template|{a}.{b}.{c},template"`
+		}{},
+		`template "{a}_{b}" has 2 placeholders, but only 1 levels of maps`: &struct {
+			Dyn map[string]int `jsonpat:"{a}_{b},template"`
+		}{},
+		"unsupported map key type float64": &struct {
+			Dyn map[string]map[float64]int `jsonpat:"{a}_{b},template"`
+		}{},
+		`invalid template: template "{a}{b}" needs literal text`: &struct {
+			Dyn map[string]map[string]int `jsonpat:"{a}{b},template"`
+		}{},
+		"option trim can't be used with template patterns": &struct {
+			Dyn map[string]int `jsonpat:"{a}_x,template,trim"`
+		}{},
+	}
+
+	for expected, v := range tests {
+		t.Run(expected, func(t *testing.T) {
+			require.ErrorAs(t, Unmarshal([]byte(`{}`), v), &tagErr)
+			assert.ErrorContains(t, tagErr, expected)
+		})
+	}
+}
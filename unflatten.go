@@ -0,0 +1,150 @@
+package jsonpat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// flattened holds the members of an object routed into a nested struct field
+// through Options.KeySeparator, under the rest of their keys. originals holds
+// the members as they appear in the object.
+type flattened struct {
+	known     *knownFieldInfo
+	members   []member
+	originals []member
+}
+
+// handles reports whether values of typ are decoded through jsonpat rather than
+// handed to the std lib: when they reach jsonpat fields, or any struct at all
+// when flattened keys are unflattened, since encoding/json wouldn't split them.
+func (d *decodeState) handles(typ reflect.Type) (bool, error) {
+	if d.opts.KeySeparator != "" && reachesStruct(typ) {
+		return true, nil
+	}
+	return hasPatterns(typ, false)
+}
+
+// reachesStruct reports whether typ is, or holds through pointers, slices,
+// arrays or maps, a struct that doesn't decode itself.
+func reachesStruct(typ reflect.Type) bool {
+	for !isCustomCodec(typ, false) {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			typ = typ.Elem()
+		case reflect.Struct:
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// route holds back a member whose key starts with the name of a known struct
+// field followed by the key separator, to be decoded into that field under the
+// rest of its key. The shortest such prefix wins. It reports whether the member
+// was routed.
+func (s *structDecoder) route(m member) bool {
+	sep := s.opts.KeySeparator
+	if sep == "" {
+		return false
+	}
+
+	for i := strings.Index(m.key, sep); i >= 0; {
+		known, ok := s.info.tagging.knownField(m.key[:i], s.opts.CaseSensitiveKnownFields)
+		if ok && isStructField(s.structVal.Type().FieldByIndex(known.fieldIndices).Type) {
+			s.addFlattened(known, member{index: m.index, key: m.key[i+len(sep):], value: m.value}, m)
+			return true
+		}
+
+		next := strings.Index(m.key[i+len(sep):], sep)
+		if next < 0 {
+			break
+		}
+		i += len(sep) + next
+	}
+	return false
+}
+
+// addFlattened adds a member to those routed into a known field, along with the
+// original member, keeping the fields in the order their first key appeared.
+func (s *structDecoder) addFlattened(known *knownFieldInfo, m, original member) {
+	for i := range s.flattened {
+		if s.flattened[i].known == known {
+			s.flattened[i].members = append(s.flattened[i].members, m)
+			s.flattened[i].originals = append(s.flattened[i].originals, original)
+			return
+		}
+	}
+	s.flattened = append(s.flattened, flattened{known: known, members: []member{m}, originals: []member{original}})
+}
+
+// resolveFlattened decodes the members routed into each nested struct field as
+// a single object, so that its own known fields, jsonpat fields and flattened
+// keys apply to them. They are decoded after the rest of the object, so they
+// are merged into any value the field was given under its own key.
+func (s *structDecoder) resolveFlattened() error {
+	for _, routed := range s.flattened {
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, m := range routed.members {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(m.key)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(m.value)
+		}
+		buf.WriteByte('}')
+
+		field, err := fieldByIndex(s.structVal, routed.known.fieldIndices)
+		if err == nil {
+			err = s.unmarshalValue(buf.Bytes(), field)
+		}
+		// the nested struct was fully decoded, so its unknown keys are reported
+		// along with those of the rest of the object, under their original keys
+		if unknownErr, ok := err.(*UnknownKeysError); ok {
+			s.unknown = append(s.unknown, routed.unknownMembers(unknownErr.Keys)...)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal flattened keys of %s: %w", routed.known.name, err)
+		}
+	}
+	return nil
+}
+
+// unknownMembers returns the original members of the routed keys the nested
+// struct reported as unknown. Keys are routed under their full rest, so each
+// reported key is the rest of the first original member not yet reported.
+func (f flattened) unknownMembers(keys []string) []member {
+	reported := make([]bool, len(f.members))
+	var unknown []member
+	for _, key := range keys {
+		for i, m := range f.members {
+			if !reported[i] && m.key == key {
+				reported[i] = true
+				unknown = append(unknown, f.originals[i])
+				break
+			}
+		}
+	}
+	return unknown
+}
+
+// isStructField reports whether flattened keys can be routed into a field of
+// type typ: a struct or a pointer to one, that doesn't decode itself, since it
+// couldn't be expected to accept an object.
+func isStructField(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr && !isCustomCodec(typ, false) {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && !isCustomCodec(typ, false)
+}
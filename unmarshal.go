@@ -1,134 +1,676 @@
 package jsonpat
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
 	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamieyoung5/jsonpat/internal/mapkey"
+	"github.com/jamieyoung5/jsonpat/internal/scan"
+	"github.com/jamieyoung5/jsonpat/internal/tags"
 )
 
 // Unmarshal parses json data into a struct, supporting `jsonpat` tags
 // while preserving existing `json` tagging functionality. Dynamic json tags allow
 // for filtered matching of json keys into a struct field.
 //
-// The 'v' argument must be a non-nil pointer to a struct.
+// The 'v' argument must be a non-nil pointer to a struct, or to a slice, array
+// or map of structs (or of pointers to structs), in which case every element is
+// decoded through its jsonpat tags.
+//
+// The input is read in a single pass, so unlike encoding/json, fields decoded
+// before a syntax error is found keep their values when an error is returned.
+//
+// As with encoding/json, nil embedded pointers to structs are allocated when one
+// of their fields is decoded.
 func Unmarshal(data []byte, v interface{}) error {
-	// validata struct pointer
-	ptrVal := reflect.ValueOf(v)
-	if ptrVal.Kind() != reflect.Ptr || ptrVal.IsNil() {
-		return fmt.Errorf("v must be a non-nil pointer to a struct")
-	}
-	structVal := ptrVal.Elem()
-	if structVal.Kind() != reflect.Struct {
-		return fmt.Errorf("v must be a non-nil pointer to a struct")
+	return UnmarshalWithOptions(data, v, Options{})
+}
+
+// UnmarshalWithOptions is like Unmarshal but decodes according to opts.
+func UnmarshalWithOptions(data []byte, v interface{}, opts Options) error {
+	target, err := targetPointer(v)
+	if err != nil {
+		return err
 	}
-	structType := structVal.Type()
+	targetType := target.Type()
+
+	// the state of the decoding escapes to the heap, so a copy on the stack
+	// decides whether it is needed at all
+	local := decodeState{opts: opts}
 
-	// retrieve struct analysis
-	info, err := getStructInfo(structType)
+	// retrieve struct analysis, including any nested structs
+	patterns, err := local.handles(targetType)
 	if err != nil {
-		return fmt.Errorf("failed to analyze struct %s: %w", structType.Name(), err)
+		return fmt.Errorf("failed to analyze struct %s: %w", structName(targetType), err)
 	}
 
 	// no jsonpat fields, delegate completely to std lib
-	if len(info.tagging.dynamicMapFields) == 0 &&
-		len(info.tagging.dynamicScalarFields) == 0 {
+	if !patterns {
+		return local.unmarshalStd(data, v)
+	}
+
+	d := &decodeState{opts: opts}
+
+	if target.Kind() == reflect.Struct {
+		err = d.unmarshalStruct(data, target)
+	} else {
+		err = d.unmarshalValue(data, target)
+	}
+	// values are decoded from slices of data, so syntax errors are reported
+	// against the whole document as encoding/json would
+	return scan.InDocument(data, err)
+}
+
+// structPointer returns the struct pointed to by v, which must be a non-nil
+// pointer to a struct.
+func structPointer(v interface{}) (reflect.Value, error) {
+	ptrVal := reflect.ValueOf(v)
+	if ptrVal.Kind() != reflect.Ptr || ptrVal.IsNil() || ptrVal.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("v must be a non-nil pointer to a struct")
+	}
+	return ptrVal.Elem(), nil
+}
+
+// targetPointer returns the value pointed to by v, which must be a non-nil pointer
+// to a struct, or to a slice, array or map whose elements are structs or pointers
+// to structs.
+func targetPointer(v interface{}) (reflect.Value, error) {
+	ptrVal := reflect.ValueOf(v)
+	if ptrVal.Kind() == reflect.Ptr && !ptrVal.IsNil() {
+		elem := ptrVal.Elem().Type()
+		switch elem.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			elem = elem.Elem()
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+		}
+		if elem.Kind() == reflect.Struct {
+			return ptrVal.Elem(), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("v must be a non-nil pointer to a struct, or to a slice, array or map of structs")
+}
+
+// structName returns the name of the struct type typ is, or holds the elements of.
+func structName(typ reflect.Type) string {
+	for typ.Kind() != reflect.Struct {
+		typ = typ.Elem()
+	}
+	return typ.Name()
+}
+
+// decodeState holds the configuration of a single Unmarshal call.
+type decodeState struct {
+	opts Options
+}
+
+// unmarshalStd decodes data into v with the std lib, applying the options that
+// encoding/json supports.
+func (d *decodeState) unmarshalStd(data []byte, v interface{}) error {
+	if !d.opts.DisallowUnknownFields {
 		return json.Unmarshal(data, v)
 	}
 
-	// parse all json data
-	var raw map[string]json.RawMessage
-	if err = json.Unmarshal(data, &raw); err != nil {
-		return fmt.Errorf("failed to unmarshal raw json: %w", err)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return unknownFieldError(err, v)
+	}
+	if len(bytes.TrimSpace(data[dec.InputOffset():])) > 0 {
+		return scan.SyntaxError(data)
 	}
+	return nil
+}
 
-	keys := make([]string, 0, len(raw))
-	for k := range raw {
-		keys = append(keys, k)
+// unknownFieldError turns the error encoding/json reports for an unknown field
+// into an *UnknownKeysError for the type of the value v points to, which it was
+// decoding. Other errors are returned as is.
+func unknownFieldError(err error, v interface{}) error {
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return err
+	}
+	key, unquoteErr := strconv.Unquote(quoted)
+	if unquoteErr != nil {
+		return err
 	}
-	slices.Sort(keys)
+	return &UnknownKeysError{Type: reflect.TypeOf(v).Elem(), Keys: []string{key}}
+}
 
-	dynamicMaps := buildDynamicMaps(info.tagging.dynamicMapFields, structVal)
-	dynamicScalarSet := make(map[string]bool)
+// unmarshalValue decodes json data into v, applying jsonpat tags to any struct
+// reachable from v through pointers, slices, arrays and maps. Values that don't
+// reach any jsonpat fields are decoded by the std lib.
+func (d *decodeState) unmarshalValue(data []byte, v reflect.Value) error {
+	patterns, err := d.handles(v.Type())
+	if err != nil {
+		return fmt.Errorf("failed to analyze type %s: %w", v.Type(), err)
+	}
+	if !patterns {
+		return d.unmarshalStd(data, v.Addr().Interface())
+	}
 
-	for _, key := range keys {
-		rawValue := raw[key]
+	null := isNull(data)
 
-		if fieldIndices, ok := info.tagging.knownFields[key]; ok {
-			field := structVal.FieldByIndex(fieldIndices)
+	switch v.Kind() {
+	case reflect.Ptr:
+		if null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.unmarshalValue(data, v.Elem())
+	case reflect.Struct:
+		if null {
+			return nil
+		}
+		return d.unmarshalStruct(data, v)
+	case reflect.Slice:
+		if null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if err = scan.ExpectKind(data, '[', v.Type()); err != nil {
+			return err
+		}
+
+		slice := reflect.MakeSlice(v.Type(), 0, 0)
+		zero := reflect.Zero(v.Type().Elem())
+		err = scan.ForEachElement(data, func(i int, elem []byte) error {
+			slice = reflect.Append(slice, zero)
+			if err := d.unmarshalValue(elem, slice.Index(i)); err != nil {
+				return fmt.Errorf("failed to unmarshal element %d: %w", i, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		v.Set(slice)
+	case reflect.Array:
+		if null {
+			return nil
+		}
+		if err = scan.ExpectKind(data, '[', v.Type()); err != nil {
+			return err
+		}
 
-			if err = json.Unmarshal(rawValue, field.Addr().Interface()); err != nil {
-				return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+		count := 0
+		err = scan.ForEachElement(data, func(i int, elem []byte) error {
+			count++
+			if i >= v.Len() {
+				return scan.Validate(elem)
+			}
+			if err := d.unmarshalValue(elem, v.Index(i)); err != nil {
+				return fmt.Errorf("failed to unmarshal element %d: %w", i, err)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := count; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	case reflect.Map:
+		if null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if err = scan.ExpectKind(data, '{', v.Type()); err != nil {
+			return err
+		}
+
+		target, err := newMapTarget(v, 0)
+		if err != nil {
+			return err
+		}
+		return scan.ForEachMember(data, func(key string, value []byte) error {
+			return target.set(d, key, value)
+		})
+	default:
+		return d.unmarshalStd(data, v.Addr().Interface())
+	}
+
+	return nil
+}
+
+// member is an object member whose dispatch is deferred until the whole object
+// has been read. index is its position in the object.
+type member struct {
+	index int
+	key   string
+	value []byte
+}
+
+// structDecoder holds the state of decoding a single json object into a struct.
+type structDecoder struct {
+	*decodeState
+	info      *structInfo
+	structVal reflect.Value
+	targets   dynamicTargets
+	count     int
+	pending   []member
+	// collected holds the members claimed by each dynamic slice field
+	collected [][]member
+	flattened []flattened
+	unknown   []member
+}
+
+// unmarshalStruct decodes a json object into a struct using its jsonpat tags.
+//
+// The object is walked once: known fields and keys that can only land in dynamic
+// map fields are decoded as they are encountered. Keys matching a dynamic scalar
+// field are held back until the end of the object, so that each scalar field can
+// pick the first matching key in sorted order, and so are the keys claimed by
+// dynamic slice fields, which are then decoded in document order. Flattened keys
+// routed into nested struct fields are decoded last.
+func (d *decodeState) unmarshalStruct(data []byte, structVal reflect.Value) error {
+	info, err := getStructInfo(structVal.Type())
+	if err != nil {
+		return fmt.Errorf("failed to analyze struct %s: %w", structVal.Type().Name(), err)
+	}
+
+	// capture structs hold the json value in their Value field, the rest being
+	// filled from the key by the dynamic field holding them
+	if info.tagging.capture != nil {
+		field, err := fieldByIndex(structVal, info.tagging.capture.value)
+		if err != nil {
+			return err
+		}
+		return d.unmarshalValue(data, field)
+	}
+
+	if isNull(data) {
+		return nil
+	}
+	if err = scan.ExpectKind(data, '{', structVal.Type()); err != nil {
+		return err
+	}
+
+	targets, err := buildDynamicTargets(info, structVal)
+	if err != nil {
+		return err
+	}
+
+	s := &structDecoder{decodeState: d, info: info, structVal: structVal, targets: targets}
+	s.collected = make([][]member, len(info.tagging.dynamicSliceFields))
+	if err = scan.ForEachMember(data, s.member); err != nil {
+		return err
+	}
+	if err = s.resolveScalars(); err != nil {
+		return err
+	}
+	if err = s.resolveSlices(); err != nil {
+		return err
+	}
+	if err = s.resolveFlattened(); err != nil {
+		return err
+	}
+
+	if len(s.unknown) > 0 {
+		// flattened keys are reported last, so the keys are put back in document order
+		slices.SortFunc(s.unknown, func(a, b member) int { return a.index - b.index })
+		keys := make([]string, len(s.unknown))
+		for i, m := range s.unknown {
+			keys[i] = m.key
+		}
+		return &UnknownKeysError{Type: structVal.Type(), Keys: keys}
+	}
+	return nil
+}
+
+// member dispatches a single object member as it is encountered.
+func (s *structDecoder) member(key string, value []byte) error {
+	m := member{index: s.count, key: key, value: value}
+	s.count++
+
+	if known, ok := s.info.tagging.knownField(key, s.opts.CaseSensitiveKnownFields); ok {
+		field, err := fieldByIndex(s.structVal, known.fieldIndices)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+		}
+
+		if err := s.unmarshalKnown(value, field, known); err != nil {
+			return fmt.Errorf("failed to unmarshal known key %s: %w", key, err)
+		}
+		return nil
+	}
+	if s.route(m) {
+		return nil
+	}
+
+	for _, dynInfo := range s.info.tagging.dynamicScalarFields {
+		if match(key, dynInfo) {
+			s.pending = append(s.pending, m)
+			return nil
+		}
+	}
+
+	return s.unmarshalDynamic(m, false)
+}
+
+// resolveScalars assigns the held back keys to the dynamic scalar fields.
+func (s *structDecoder) resolveScalars() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	// each scalar field, in field order, takes one of the matching keys that an
+	// earlier scalar field hasn't already taken, as chosen by its policy
+	taken := make([]bool, len(s.pending))
+	for _, dynInfo := range s.info.tagging.dynamicScalarFields {
+		chosen, err := s.pick(taken, dynInfo)
+		if err != nil {
+			return err
+		}
+		if chosen < 0 {
+			continue
+		}
+
+		taken[chosen] = true
+		field, err := fieldByIndex(s.structVal, dynInfo.fieldIndices)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", s.pending[chosen].key, err)
+		}
+		if err := s.unmarshalValue(s.pending[chosen].value, field); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", s.pending[chosen].key, err)
+		}
+		if err := dynInfo.captureGroups(s.pending[chosen].key, field); err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", s.pending[chosen].key, err)
+		}
+	}
+
+	// keys that no scalar field took fall through to the dynamic map and slice fields
+	for i, candidate := range s.pending {
+		if taken[i] {
 			continue
 		}
+		if err := s.unmarshalDynamic(candidate, true); err != nil {
+			return err
+		}
+	}
 
-		scalarHandled := false
-		for _, dynInfo := range info.tagging.dynamicScalarFields {
-			pathKey := fmt.Sprint(dynInfo.fieldIndices)
-			if dynamicScalarSet[pathKey] {
-				continue
+	return nil
+}
+
+// pick returns the index of the pending member a scalar field takes among those
+// matching it that aren't taken yet, or -1 if there is none. By default that is
+// the first key in sorted order.
+func (s *structDecoder) pick(taken []bool, dynInfo dynamicFieldInfo) (int, error) {
+	var candidates []int
+	for i, candidate := range s.pending {
+		if !taken[i] && match(candidate.key, dynInfo) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1, nil
+	}
+
+	switch dynInfo.policy {
+	case tags.DocumentOrder:
+		// pending members are held in document order
+		return candidates[0], nil
+	case tags.Unique:
+		if len(candidates) > 1 {
+			keys := make([]string, len(candidates))
+			for i, candidate := range candidates {
+				keys[i] = s.pending[candidate].key
 			}
+			return -1, &ConflictError{
+				Type:  s.structVal.Type(),
+				Field: s.structVal.Type().FieldByIndex(dynInfo.fieldIndices).Name,
+				Keys:  keys,
+			}
+		}
+		return candidates[0], nil
+	}
 
-			if match(key, dynInfo) {
-				field := structVal.FieldByIndex(dynInfo.fieldIndices)
-				if err = json.Unmarshal(rawValue, field.Addr().Interface()); err != nil {
-					return fmt.Errorf("failed to unmarshal dynamic scalar key %s: %w", key, err)
-				}
-				dynamicScalarSet[pathKey] = true
-				scalarHandled = true
-				break
+	chosen := candidates[0]
+	for _, candidate := range candidates[1:] {
+		key, chosenKey := s.pending[candidate].key, s.pending[chosen].key
+		// a repeated key resolves to its first occurrence, or its last one for last
+		if dynInfo.policy == tags.Last && key >= chosenKey || dynInfo.policy != tags.Last && key < chosenKey {
+			chosen = candidate
+		}
+	}
+	return chosen, nil
+}
+
+// unmarshalDynamic stores a value in every dynamic map field whose rule matches
+// its key, and collects it for every dynamic slice field whose rule does. Values
+// that no field claims go to the remaining field if there is one, and are
+// otherwise only validated. When unknown fields are disallowed, keys that didn't
+// match a scalar rule either (matchedScalar) are reported.
+func (s *structDecoder) unmarshalDynamic(m member, matchedScalar bool) error {
+	key, value := m.key, m.value
+	claimed := false
+	for i, dynInfo := range s.info.tagging.dynamicMapFields {
+		if match(key, dynInfo) {
+			claimed = true
+			if err := s.unmarshalDynamicEntry(s.targets.maps[i], dynInfo, key, value); err != nil {
+				return err
 			}
 		}
+	}
+	for i, dynInfo := range s.info.tagging.dynamicSliceFields {
+		if match(key, dynInfo) {
+			claimed = true
+			s.collected[i] = append(s.collected[i], m)
+		}
+	}
+
+	if claimed {
+		return nil
+	}
+	if s.targets.remaining != nil {
+		if err := s.targets.remaining.set(s.decodeState, key, value); err != nil {
+			return fmt.Errorf("failed to unmarshal remaining key %s: %w", key, err)
+		}
+		return nil
+	}
 
-		if scalarHandled {
+	if s.opts.DisallowUnknownFields && !matchedScalar {
+		s.unknown = append(s.unknown, m)
+	}
+	return scan.Validate(value)
+}
+
+// resolveSlices decodes the members collected by each dynamic slice field, in
+// the order they appear in the object. Fields that collected nothing are left
+// untouched.
+func (s *structDecoder) resolveSlices() error {
+	for i, dynInfo := range s.info.tagging.dynamicSliceFields {
+		collected := s.collected[i]
+		if len(collected) == 0 {
 			continue
 		}
+		// keys that fell through from the scalar fields were collected last
+		slices.SortFunc(collected, func(a, b member) int { return a.index - b.index })
 
-		for _, dynInfo := range info.tagging.dynamicMapFields {
-			if match(key, dynInfo) {
-				pathKey := fmt.Sprint(dynInfo.fieldIndices)
-				if err = unmarshalDynamic(
-					dynamicMaps[pathKey],
-					key,
-					rawValue,
-				); err != nil {
-					return err
-				}
+		field, err := fieldByIndex(s.structVal, dynInfo.fieldIndices)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal dynamic key %s: %w", collected[0].key, err)
+		}
+		values := reflect.MakeSlice(field.Type(), len(collected), len(collected))
+		for j, m := range collected {
+			elem := values.Index(j)
+			if dynInfo.entries {
+				elem.Field(0).SetString(m.key)
+				elem = elem.Field(1)
+			}
+			if err := s.unmarshalValue(m.value, elem); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", m.key, err)
 			}
+			if err := dynInfo.captureGroups(m.key, elem); err != nil {
+				return fmt.Errorf("failed to unmarshal dynamic key %s: %w", m.key, err)
+			}
+		}
+		field.Set(values)
+	}
+	return nil
+}
+
+// unmarshalKnown decodes a value into a known field, honouring the `string`
+// json tag option so that values written by Marshal can be read back.
+func (d *decodeState) unmarshalKnown(jsonRaw []byte, field reflect.Value, known *knownFieldInfo) error {
+	if !known.quoted || len(jsonRaw) == 0 || jsonRaw[0] != '"' {
+		if known.quoted && string(jsonRaw) != "null" {
+			return fmt.Errorf("invalid use of ,string struct tag, trying to unmarshal %s into %s", jsonRaw, field.Type())
 		}
+		return d.unmarshalValue(jsonRaw, field)
 	}
 
+	var inner string
+	if err := json.Unmarshal(jsonRaw, &inner); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(inner), field.Addr().Interface())
+}
+
+// unmarshalDynamicEntry decodes the value of the json key `key` into a dynamic
+// map field, storing it under the key the field maps it to.
+func (d *decodeState) unmarshalDynamicEntry(dynMap mapTarget, dynInfo dynamicFieldInfo, key string, jsonRaw []byte) error {
+	if err := dynMap.decode(d, jsonRaw); err != nil {
+		return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+	}
+	if err := dynInfo.captureGroups(key, dynMap.value); err != nil {
+		return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+	}
+
+	var err error
+	if dynInfo.nested > 0 {
+		err = mapkey.SetNested(dynMap.m, dynInfo.segments(key), dynMap.value)
+	} else {
+		err = dynMap.store(dynInfo.mapKey(key))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, err)
+	}
 	return nil
 }
 
-func unmarshalDynamic(dynMap reflect.Value, key string, jsonRaw json.RawMessage) error {
-	mapValType := dynMap.Type().Elem()
+// mapTarget is a map being decoded into. Keys and values are decoded into
+// reusable scratch values, which SetMapIndex then copies into the map.
+type mapTarget struct {
+	m     reflect.Value
+	key   reflect.Value
+	value reflect.Value
+}
+
+// newMapTarget prepares m for decoding, initialising it if it is nil. nested is
+// the number of levels of maps the values are stored in, for fields with
+// template patterns.
+func newMapTarget(m reflect.Value, nested int) (mapTarget, error) {
+	keyType := m.Type().Key()
+	if err := mapkey.Check(keyType); err != nil {
+		return mapTarget{}, err
+	}
 
-	newVal := reflect.New(mapValType)
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	return mapTarget{
+		m:     m,
+		key:   reflect.New(keyType).Elem(),
+		value: reflect.New(nestedValueType(m.Type(), nested)).Elem(),
+	}, nil
+}
 
-	if errUnmarshal := json.Unmarshal(jsonRaw, newVal.Interface()); errUnmarshal != nil {
-		return fmt.Errorf("failed to unmarshal dynamic key %s: %w", key, errUnmarshal)
+// set decodes a json value and stores it in the map under key, converted to the
+// key type of the map.
+func (t mapTarget) set(d *decodeState, key string, jsonRaw []byte) error {
+	if err := t.decode(d, jsonRaw); err != nil {
+		return err
 	}
+	return t.store(key)
+}
+
+// decode decodes a json value into the scratch value.
+func (t mapTarget) decode(d *decodeState, jsonRaw []byte) error {
+	t.value.Set(reflect.Zero(t.value.Type()))
+	return d.unmarshalValue(jsonRaw, t.value)
+}
 
-	dynMap.SetMapIndex(reflect.ValueOf(key), newVal.Elem())
+// store stores the scratch value in the map under key, converted to the key
+// type of the map.
+func (t mapTarget) store(key string) error {
+	if err := mapkey.Set(t.key, key); err != nil {
+		return err
+	}
+	t.m.SetMapIndex(t.key, t.value)
 	return nil
 }
 
-func buildDynamicMaps(dynFields []dynamicFieldInfo, structVal reflect.Value) map[string]reflect.Value {
-	if len(dynFields) == 0 {
-		return nil
+// fieldByIndex returns the field of v at index, allocating the nil embedded
+// pointers on its path as encoding/json does. It fails on a nil pointer to an
+// unexported struct type, which can't be set.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct type %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
 	}
+	return v, nil
+}
 
-	dynamicMaps := make(map[string]reflect.Value)
-	for _, dynInfo := range dynFields {
-		fieldVal := structVal.FieldByIndex(dynInfo.fieldIndices)
-		if fieldVal.IsNil() {
-			fieldVal.Set(reflect.MakeMap(fieldVal.Type()))
+// isNull reports whether data holds the json null literal.
+func isNull(data []byte) bool {
+	return string(bytes.TrimSpace(data)) == "null"
+}
+
+// dynamicTargets holds the maps that the dynamic keys of a struct are decoded into.
+type dynamicTargets struct {
+	maps      []mapTarget
+	remaining *mapTarget
+}
+
+// buildDynamicTargets returns the dynamic map fields of structVal, in the same
+// order as its dynamicMapFields, and its remaining field, initialising any nil maps.
+func buildDynamicTargets(info *structInfo, structVal reflect.Value) (dynamicTargets, error) {
+	var targets dynamicTargets
+
+	if len(info.tagging.dynamicMapFields) > 0 {
+		targets.maps = make([]mapTarget, len(info.tagging.dynamicMapFields))
+		for i, dynInfo := range info.tagging.dynamicMapFields {
+			field, err := fieldByIndex(structVal, dynInfo.fieldIndices)
+			if err != nil {
+				return targets, fmt.Errorf("dynamic field %s: %w", structVal.Type().FieldByIndex(dynInfo.fieldIndices).Name, err)
+			}
+			target, err := newMapTarget(field, dynInfo.nested)
+			if err != nil {
+				return targets, fmt.Errorf("dynamic field %s: %w", structVal.Type().FieldByIndex(dynInfo.fieldIndices).Name, err)
+			}
+			targets.maps[i] = target
+		}
+	}
+
+	if info.tagging.remainingField != nil {
+		field, err := fieldByIndex(structVal, info.tagging.remainingField)
+		if err != nil {
+			return targets, err
+		}
+		target, err := newMapTarget(field, 0)
+		if err != nil {
+			return targets, err
 		}
-		pathKey := fmt.Sprint(dynInfo.fieldIndices)
-		dynamicMaps[pathKey] = fieldVal
+		targets.remaining = &target
 	}
 
-	return dynamicMaps
+	return targets, nil
 }
@@ -1,7 +1,11 @@
 package jsonpat
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 
@@ -170,6 +174,22 @@ func TestUnmarshal_UnexportedFields(t *testing.T) {
 	assert.Equal(t, "seen", result.Public)
 }
 
+func TestUnmarshal_EmbeddedPointerToUnexported(t *testing.T) {
+	type Outer struct {
+		*embedInner
+		M map[string]int `jsonpat:"m_,prefix"`
+	}
+
+	result := Outer{embedInner: &embedInner{}}
+	require.NoError(t, Unmarshal([]byte(`{"a":"x","m_1":1}`), &result))
+	assert.Equal(t, "x", result.A)
+
+	// like encoding/json, a nil pointer to an unexported struct can't be set
+	var empty Outer
+	err := Unmarshal([]byte(`{"a":"x"}`), &empty)
+	assert.ErrorContains(t, err, "cannot set embedded pointer to unexported struct type jsonpat.embedInner")
+}
+
 func TestUnmarshal_TagErrors_ExtraArgs(t *testing.T) {
 	typeCache = sync.Map{} // Clear cache to force re-analysis
 
@@ -255,3 +275,734 @@ func FuzzUnmarshal(f *testing.F) {
 		_ = Unmarshal(data, &result)
 	})
 }
+
+type NestedItem struct {
+	Name  string         `json:"name"`
+	Attrs map[string]int `jsonpat:"attr_,prefix"`
+}
+
+type NestedNode struct {
+	Label    string         `json:"label"`
+	Tags     map[string]int `jsonpat:"tag_,prefix"`
+	Children []NestedNode   `json:"children"`
+}
+
+type NestedStruct struct {
+	ID       string                `json:"id"`
+	Meta     NestedItem            `json:"meta"`
+	MetaPtr  *NestedItem           `json:"meta_ptr"`
+	Items    []NestedItem          `json:"items"`
+	Pair     [2]NestedItem         `json:"pair"`
+	ByName   map[string]NestedItem `json:"by_name"`
+	Tree     *NestedNode           `json:"tree"`
+	Untagged []int                 `json:"untagged"`
+}
+
+func TestUnmarshal_Nested(t *testing.T) {
+	typeCache = sync.Map{}
+
+	jsonData := []byte(`{
+		"id": "root",
+		"meta": {"name": "meta", "attr_a": 1},
+		"meta_ptr": {"name": "ptr", "attr_b": 2},
+		"items": [{"name": "first", "attr_c": 3}, {"name": "second", "attr_d": 4}],
+		"pair": [{"name": "left", "attr_e": 5}],
+		"by_name": {"x": {"name": "mapped", "attr_f": 6}},
+		"tree": {"label": "parent", "tag_p": 7, "children": [{"label": "child", "tag_c": 8}]},
+		"untagged": [1, 2, 3]
+	}`)
+
+	var result NestedStruct
+	require.NoError(t, Unmarshal(jsonData, &result), "Unmarshal should not fail")
+
+	assert.Equal(t, "root", result.ID)
+	assert.Equal(t, NestedItem{Name: "meta", Attrs: map[string]int{"attr_a": 1}}, result.Meta)
+
+	require.NotNil(t, result.MetaPtr, "MetaPtr should be allocated")
+	assert.Equal(t, NestedItem{Name: "ptr", Attrs: map[string]int{"attr_b": 2}}, *result.MetaPtr)
+
+	assert.Equal(t, []NestedItem{
+		{Name: "first", Attrs: map[string]int{"attr_c": 3}},
+		{Name: "second", Attrs: map[string]int{"attr_d": 4}},
+	}, result.Items)
+
+	assert.Equal(t, NestedItem{Name: "left", Attrs: map[string]int{"attr_e": 5}}, result.Pair[0])
+	assert.Equal(t, NestedItem{}, result.Pair[1], "Missing array elements should be zeroed")
+
+	assert.Equal(t, map[string]NestedItem{"x": {Name: "mapped", Attrs: map[string]int{"attr_f": 6}}}, result.ByName)
+
+	require.NotNil(t, result.Tree, "Tree should be allocated")
+	assert.Equal(t, map[string]int{"tag_p": 7}, result.Tree.Tags)
+	require.Len(t, result.Tree.Children, 1)
+	assert.Equal(t, "child", result.Tree.Children[0].Label)
+	assert.Equal(t, map[string]int{"tag_c": 8}, result.Tree.Children[0].Tags)
+
+	assert.Equal(t, []int{1, 2, 3}, result.Untagged)
+}
+
+func TestUnmarshal_NestedNulls(t *testing.T) {
+	result := NestedStruct{
+		MetaPtr: &NestedItem{Name: "set"},
+		Items:   []NestedItem{{Name: "set"}},
+		ByName:  map[string]NestedItem{"x": {}},
+	}
+
+	jsonData := []byte(`{"meta": null, "meta_ptr": null, "items": null, "by_name": null, "pair": null}`)
+	require.NoError(t, Unmarshal(jsonData, &result))
+
+	assert.Nil(t, result.MetaPtr)
+	assert.Nil(t, result.Items)
+	assert.Nil(t, result.ByName)
+}
+
+type customDecoded struct {
+	Attrs map[string]int `jsonpat:"attr_,prefix"`
+}
+
+func (c *customDecoded) UnmarshalJSON([]byte) error {
+	c.Attrs = map[string]int{"custom": 1}
+	return nil
+}
+
+func TestUnmarshal_NestedCustomUnmarshaler(t *testing.T) {
+	type Outer struct {
+		Inner customDecoded `json:"inner"`
+	}
+
+	var result Outer
+	require.NoError(t, Unmarshal([]byte(`{"inner": {"attr_a": 2}}`), &result))
+	assert.Equal(t, map[string]int{"custom": 1}, result.Inner.Attrs, "Custom UnmarshalJSON should be used")
+}
+
+func TestUnmarshal_NestedErrors(t *testing.T) {
+	typeCache = sync.Map{}
+
+	var result NestedStruct
+	assert.Error(t, Unmarshal([]byte(`{"items": [{"attr_a": "nan"}]}`), &result), "Expected error for nested slice element")
+	assert.Error(t, Unmarshal([]byte(`{"items": {}}`), &result), "Expected error for object into slice")
+	assert.Error(t, Unmarshal([]byte(`{"by_name": []}`), &result), "Expected error for array into map")
+	assert.Error(t, Unmarshal([]byte(`{"pair": [{"attr_a": "nan"}]}`), &result), "Expected error for nested array element")
+
+	type BadInner struct {
+		M map[string]int `jsonpat:"val,invalid_type"`
+	}
+	type Outer struct {
+		Inner []BadInner `json:"inner"`
+	}
+
+	var outer Outer
+	err := Unmarshal([]byte(`{}`), &outer)
+	assert.Error(t, err, "Expected error for invalid tag in nested struct")
+	assert.Contains(t, err.Error(), "invalid matcher")
+
+	type FloatKeys struct {
+		M map[float64]NestedItem `json:"m"`
+	}
+	var floatKeys FloatKeys
+	assert.Error(t, Unmarshal([]byte(`{"m": {"1": {}}}`), &floatKeys), "Expected error for unsupported map key type")
+}
+
+func TestUnmarshal_SinglePassSemantics(t *testing.T) {
+	type Scalars struct {
+		First   string         `jsonpat:"pfx_,prefix"`
+		Second  string         `jsonpat:"pfx_,prefix"`
+		Dynamic map[string]int `jsonpat:"dyn_,prefix"`
+		Rest    map[string]string
+	}
+
+	// scalar fields take matching keys in sorted order, regardless of document order
+	jsonData := []byte(`{"pfx_c": "c", "dyn_a": 1, "pfx_b": "b", "pfx_a": "a", "dyn_\u0062": 2, "unknown": [1, {"x": null}]}`)
+
+	var result Scalars
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, "a", result.First)
+	assert.Equal(t, "b", result.Second)
+	assert.Equal(t, map[string]int{"dyn_a": 1, "dyn_b": 2}, result.Dynamic, "Escaped keys should be unquoted")
+
+	assert.NoError(t, Unmarshal([]byte(`null`), &result), "null should be a no-op like encoding/json")
+}
+
+func TestUnmarshal_SyntaxErrors(t *testing.T) {
+	var result TestStruct
+	inputs := []string{
+		`{"not_matching": tru}`,
+		`{"dyn_abc": 1,}`,
+		`{"known_field": "a"} trailing`,
+		`{"not_matching": {"a": [1, 2}}`,
+	}
+
+	for _, input := range inputs {
+		err := Unmarshal([]byte(input), &result)
+		var syntaxErr *json.SyntaxError
+		assert.True(t, errors.As(err, &syntaxErr), "Expected *json.SyntaxError for %q, got %v", input, err)
+	}
+
+	err := Unmarshal([]byte(`[1, 2]`), &result)
+	var typeErr *json.UnmarshalTypeError
+	assert.True(t, errors.As(err, &typeErr), "Expected *json.UnmarshalTypeError for array input, got %v", err)
+}
+
+func TestUnmarshal_SyntaxErrorOffsets(t *testing.T) {
+	inputs := []string{
+		`{"zz": tru}`,
+		`{"dyn_x": [1,,2]}`,
+		`{"known_field": "a\x"}`,
+		`{"nested": {"name": tru}}`,
+		`{"items": [{"name": "a"}, {"name": }]}`,
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			var expected *json.SyntaxError
+			var discard map[string]interface{}
+			require.ErrorAs(t, json.Unmarshal([]byte(input), &discard), &expected)
+
+			var syntaxErr *json.SyntaxError
+			var result TestStruct
+			require.ErrorAs(t, Unmarshal([]byte(input), &result), &syntaxErr)
+			assert.Equal(t, expected.Error(), syntaxErr.Error())
+			assert.Equal(t, expected.Offset, syntaxErr.Offset, "Offsets should be within the whole document")
+
+			require.ErrorAs(t, UnmarshalJSONInto([]byte(input), &result), &syntaxErr)
+			assert.Equal(t, expected.Offset, syntaxErr.Offset)
+		})
+	}
+}
+
+func TestUnmarshal_TagErrors_InvalidRegex(t *testing.T) {
+	typeCache = sync.Map{}
+
+	type BadRegex struct {
+		Known string         `json:"known"`
+		M     map[string]int `jsonpat:"^(unclosed$,regex"`
+	}
+
+	var result BadRegex
+	var err error
+	require.NotPanics(t, func() {
+		err = Unmarshal([]byte(`{"known": "a"}`), &result)
+	}, "Invalid regex should not panic")
+	require.Error(t, err)
+
+	var tagErr *TagError
+	require.True(t, errors.As(err, &tagErr), "Expected a *TagError, got %T", err)
+	assert.Equal(t, reflect.TypeOf(BadRegex{}), tagErr.Type)
+	assert.Equal(t, "M", tagErr.Field)
+	assert.Equal(t, "^(unclosed$,regex", tagErr.Tag)
+	assert.Contains(t, tagErr.Error(), "invalid regex")
+	assert.Contains(t, tagErr.Error(), "missing closing )")
+
+	_, cached := typeCache.Load(reflect.TypeOf(BadRegex{}))
+	assert.False(t, cached, "Broken analysis results should not be cached")
+}
+
+func TestUnmarshal_TagErrors_Embedded(t *testing.T) {
+	typeCache = sync.Map{}
+
+	type BadInner struct {
+		M map[string]int `jsonpat:"val,invalid_type"`
+	}
+	type Outer struct {
+		BadInner
+	}
+
+	var result Outer
+	err := Unmarshal([]byte(`{}`), &result)
+
+	var tagErr *TagError
+	require.True(t, errors.As(err, &tagErr), "Expected a *TagError, got %T", err)
+	assert.Equal(t, reflect.TypeOf(BadInner{}), tagErr.Type, "TagError should name the struct declaring the field")
+	assert.Equal(t, "M", tagErr.Field)
+
+	_, cached := typeCache.Load(reflect.TypeOf(Outer{}))
+	assert.False(t, cached, "Broken analysis results should not be cached")
+	_, err = getStructInfo(reflect.TypeOf(Outer{}))
+	assert.Error(t, err, "Analysis should fail again rather than return a cached result")
+}
+
+func TestUnmarshal_Remaining(t *testing.T) {
+	type WithRemaining struct {
+		Known   string                     `json:"known"`
+		Scalar  string                     `jsonpat:"pfx_,prefix"`
+		Dynamic map[string]int             `jsonpat:"dyn_,prefix"`
+		Rest    map[string]json.RawMessage `jsonpat:",remaining"`
+	}
+
+	jsonData := []byte(`{"known": "k", "pfx_a": "a", "pfx_b": "b", "dyn_x": 1, "other": {"nested": [1, 2]}, "flag": true}`)
+
+	var result WithRemaining
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, "k", result.Known)
+	assert.Equal(t, "a", result.Scalar)
+	assert.Equal(t, map[string]int{"dyn_x": 1}, result.Dynamic)
+	assert.Equal(t, map[string]json.RawMessage{
+		"pfx_b": json.RawMessage(`"b"`),
+		"other": json.RawMessage(`{"nested": [1, 2]}`),
+		"flag":  json.RawMessage(`true`),
+	}, result.Rest, "Remaining should hold every key no other field claimed")
+
+	// values must not alias the input buffer
+	jsonData[len(jsonData)-2] = 'X'
+	assert.Equal(t, json.RawMessage(`true`), result.Rest["flag"])
+
+	type AnyRemaining struct {
+		Known string                 `json:"known"`
+		Rest  map[string]interface{} `jsonpat:",remaining"`
+	}
+
+	var anyResult AnyRemaining
+	require.NoError(t, Unmarshal([]byte(`{"known": "k", "n": 1.5, "s": "x"}`), &anyResult))
+	assert.Equal(t, map[string]interface{}{"n": 1.5, "s": "x"}, anyResult.Rest)
+}
+
+func TestUnmarshal_RemainingTagErrors(t *testing.T) {
+	typeCache = sync.Map{}
+
+	type WrongType struct {
+		Rest map[string]int `jsonpat:",remaining"`
+	}
+	type WithPattern struct {
+		Rest map[string]interface{} `jsonpat:"x_,prefix,remaining"`
+	}
+	type Duplicate struct {
+		Rest  map[string]interface{}     `jsonpat:",remaining"`
+		Other map[string]json.RawMessage `jsonpat:",remaining"`
+	}
+
+	var tagErr *TagError
+
+	err := Unmarshal([]byte(`{}`), &WrongType{})
+	require.True(t, errors.As(err, &tagErr), "Expected a *TagError, got %v", err)
+	assert.Contains(t, err.Error(), "must be a map[string]json.RawMessage or map[string]any")
+
+	err = Unmarshal([]byte(`{}`), &WithPattern{})
+	require.True(t, errors.As(err, &tagErr), "Expected a *TagError, got %v", err)
+	assert.Contains(t, err.Error(), "must be used on its own")
+
+	err = Unmarshal([]byte(`{}`), &Duplicate{})
+	require.True(t, errors.As(err, &tagErr), "Expected a *TagError, got %v", err)
+	assert.Equal(t, "Other", tagErr.Field)
+}
+
+func TestUnmarshal_TopLevelCollections(t *testing.T) {
+	typeCache = sync.Map{}
+
+	var list []NestedItem
+	require.NoError(t, Unmarshal([]byte(`[{"name": "a", "attr_x": 1}, {"name": "b"}]`), &list))
+	assert.Equal(t, []NestedItem{
+		{Name: "a", Attrs: map[string]int{"attr_x": 1}},
+		{Name: "b", Attrs: map[string]int{}},
+	}, list)
+
+	var ptrs []*NestedItem
+	require.NoError(t, Unmarshal([]byte(`[{"name": "a", "attr_x": 1}, null]`), &ptrs))
+	require.Len(t, ptrs, 2)
+	assert.Equal(t, map[string]int{"attr_x": 1}, ptrs[0].Attrs)
+	assert.Nil(t, ptrs[1])
+
+	var pair [2]NestedItem
+	require.NoError(t, Unmarshal([]byte(`[{"attr_y": 2}]`), &pair))
+	assert.Equal(t, map[string]int{"attr_y": 2}, pair[0].Attrs)
+	assert.Empty(t, pair[1].Name)
+
+	var byID map[string]NestedItem
+	require.NoError(t, Unmarshal([]byte(`{"id1": {"name": "one", "attr_z": 3}}`), &byID))
+	assert.Equal(t, map[string]NestedItem{"id1": {Name: "one", Attrs: map[string]int{"attr_z": 3}}}, byID)
+
+	require.NoError(t, Unmarshal([]byte(`null`), &list))
+	assert.Nil(t, list)
+
+	// element types without jsonpat fields are handed to the std lib
+	type Plain struct {
+		Name string `json:"name"`
+	}
+	var plain []Plain
+	require.NoError(t, Unmarshal([]byte(`[{"name": "p"}]`), &plain))
+	assert.Equal(t, []Plain{{Name: "p"}}, plain)
+}
+
+func TestUnmarshal_TopLevelCollectionErrors(t *testing.T) {
+	var list []NestedItem
+	assert.Error(t, Unmarshal([]byte(`{"name": "a"}`), &list), "Expected error for object into slice")
+	assert.Error(t, Unmarshal([]byte(`[{"name": 1}]`), &list), "Expected error for element type mismatch")
+	assert.Error(t, Unmarshal([]byte(`[{"name": "a"}] x`), &list), "Expected error for trailing data")
+
+	var ints []int
+	assert.Error(t, Unmarshal([]byte(`[1]`), &ints), "Expected error for slice of non-structs")
+
+	var strict []StrictStruct
+	err := UnmarshalWithOptions([]byte(`[{"known": "a", "unknown": 1}]`), &strict, Options{DisallowUnknownFields: true})
+	var unknown *UnknownKeysError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"unknown"}, unknown.Keys)
+}
+
+func TestUnmarshal_Glob(t *testing.T) {
+	type Globbed struct {
+		P99     map[string]float64 `jsonpat:"metric.*.p99,glob"`
+		URLs    map[string]string  `jsonpat:"env_?_url,glob"`
+		Usage   map[string]int     `jsonpat:"{cpu,mem}_[0-9]*,glob"`
+		Version string             `jsonpat:"v[!0]*,glob"`
+	}
+
+	jsonData := []byte(`{
+		"metric.cpu.p99": 1.5, "metric.cpu.p50": 0.5,
+		"env_a_url": "a", "env_ab_url": "ab",
+		"cpu_1": 1, "mem_20": 2, "disk_3": 3, "cpu_x": 4,
+		"v0": "zero", "v2": "two", "v1": "one"
+	}`)
+
+	var result Globbed
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]float64{"metric.cpu.p99": 1.5}, result.P99)
+	assert.Equal(t, map[string]string{"env_a_url": "a"}, result.URLs)
+	assert.Equal(t, map[string]int{"cpu_1": 1, "mem_20": 2}, result.Usage)
+	assert.Equal(t, "one", result.Version)
+
+	type BadGlob struct {
+		Dynamic map[string]int `jsonpat:"k[abc,glob"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal(jsonData, &BadGlob{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "invalid glob")
+}
+
+func TestUnmarshal_CaseInsensitive(t *testing.T) {
+	type Headers struct {
+		Dynamic map[string]string `jsonpat:"x-dyn-,prefix,ci"`
+		IDs     map[string]int    `jsonpat:"_ID,suffix,ci"`
+		Tokens  map[string]bool   `jsonpat:"token,contains,ci"`
+		Regex   map[string]int    `jsonpat:"^v\\d$,regex,ci"`
+		Glob    map[string]int    `jsonpat:"g_*,glob,ci"`
+		Exact   string            `jsonpat:"exact_,prefix"`
+		Folded  string            `jsonpat:"straße_,prefix,ci"`
+	}
+
+	jsonData := []byte(`{
+		"X-Dyn-Foo": "a", "x-dyn-bar": "b", "X-Other": "c",
+		"user_id": 1, "GROUP_ID": 2,
+		"MyToken1": true, "TOKEN": false,
+		"V1": 1, "v2": 2, "vv": 3,
+		"G_A": 1, "g_b": 2,
+		"EXACT_1": "upper", "exact_2": "lower",
+		"STRASSE_1": "no", "STRAßE_1": "yes"
+	}`)
+
+	var result Headers
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]string{"X-Dyn-Foo": "a", "x-dyn-bar": "b"}, result.Dynamic)
+	assert.Equal(t, map[string]int{"user_id": 1, "GROUP_ID": 2}, result.IDs)
+	assert.Equal(t, map[string]bool{"MyToken1": true, "TOKEN": false}, result.Tokens)
+	assert.Equal(t, map[string]int{"V1": 1, "v2": 2}, result.Regex)
+	assert.Equal(t, map[string]int{"G_A": 1, "g_b": 2}, result.Glob)
+	assert.Equal(t, "lower", result.Exact, "Matchers without ci stay case-sensitive")
+	assert.Equal(t, "yes", result.Folded, "Expected simple Unicode folding, not full case folding")
+
+	type BadOption struct {
+		Dynamic map[string]int `jsonpat:"x-,prefix,ci=true"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal(jsonData, &BadOption{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "doesn't take an argument")
+}
+
+func TestUnmarshal_MultiplePatterns(t *testing.T) {
+	type Usage struct {
+		Resources map[string]int    `jsonpat:"cpu_,prefix|mem_,prefix|^disk\\d+$,regex"`
+		Alerts    map[string]string `jsonpat:"_alert,suffix|warn_*,glob,ci"`
+		Owner     string            `jsonpat:"^owner$,regex|maintainer,prefix"`
+		Either    string            `jsonpat:"^(a|b)_id$,regex"`
+	}
+
+	jsonData := []byte(`{
+		"cpu_0": 1, "mem_total": 2, "disk1": 3, "disk_x": 4, "gpu_0": 5,
+		"net_alert": "hot", "WARN_disk": "full",
+		"maintainer_name": "m", "owner": "o",
+		"b_id": "b"
+	}`)
+
+	var result Usage
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]int{"cpu_0": 1, "mem_total": 2, "disk1": 3}, result.Resources)
+	assert.Equal(t, map[string]string{"net_alert": "hot", "WARN_disk": "full"}, result.Alerts)
+	assert.Equal(t, "m", result.Owner, "Keys matching any pattern compete in sorted order")
+	assert.Equal(t, "b", result.Either, "A | inside a regex is an alternation, not a pattern separator")
+
+	type BadAlternative struct {
+		Dynamic map[string]int `jsonpat:"a_,prefix|[b,regex"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal(jsonData, &BadAlternative{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "invalid regex")
+
+	type RemainingAlternative struct {
+		Rest map[string]any `jsonpat:"a_,prefix|,remaining"`
+	}
+	require.ErrorAs(t, Unmarshal(jsonData, &RemainingAlternative{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "must be used on its own")
+}
+
+func TestUnmarshal_Exclude(t *testing.T) {
+	type Carved struct {
+		Public   map[string]int `jsonpat:"x_,prefix,exclude=x_internal_*,exclude=*_tmp"`
+		Internal map[string]int `jsonpat:"x_internal_,prefix"`
+		Folded   map[string]int `jsonpat:"h_,prefix,ci,exclude=h_secret"`
+		Scalar   string         `jsonpat:"s_,prefix,exclude=s_a"`
+	}
+
+	jsonData := []byte(`{
+		"x_a": 1, "x_internal_b": 2, "x_c_tmp": 3, "x_tmp_d": 4,
+		"H_one": 1, "H_SECRET": 2, "h_secret_2": 3,
+		"s_a": "excluded", "s_b": "chosen"
+	}`)
+
+	var result Carved
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]int{"x_a": 1, "x_tmp_d": 4}, result.Public)
+	assert.Equal(t, map[string]int{"x_internal_b": 2}, result.Internal)
+	assert.Equal(t, map[string]int{"H_one": 1, "h_secret_2": 3}, result.Folded, "Excludes are whole-key globs, ignoring case with ci")
+	assert.Equal(t, "chosen", result.Scalar)
+
+	var strict Carved
+	err := UnmarshalWithOptions(jsonData, &strict, Options{DisallowUnknownFields: true})
+	var unknown *UnknownKeysError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"x_c_tmp", "H_SECRET", "s_a"}, unknown.Keys, "Excluded keys are unclaimed")
+
+	type BadExclude struct {
+		Dynamic map[string]int `jsonpat:"x_,prefix,exclude=[a"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal(jsonData, &BadExclude{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "invalid exclude glob")
+}
+
+func TestUnmarshal_Trim(t *testing.T) {
+	type Trimmed struct {
+		Dynamic map[string]int    `jsonpat:"dyn_,prefix,trim"`
+		Totals  map[string]int    `jsonpat:"_total,suffix,trim"`
+		Users   map[string]string `jsonpat:"^user_(\\d+)$,regex,trim"`
+		Named   map[string]string `jsonpat:"^(a|b)_(?P<key>\\w+)$,regex,trim"`
+		Headers map[string]string `jsonpat:"x-meta-,prefix,ci,trim"`
+		Either  map[string]int    `jsonpat:"cpu_,prefix|_mem,suffix,trim"`
+	}
+
+	jsonData := []byte(`{
+		"dyn_abc": 1, "dyn_": 2,
+		"req_total": 3,
+		"user_42": "u", "user_x": "not a user",
+		"a_one": "a", "b_two": "b",
+		"X-Meta-Owner": "o",
+		"cpu_0": 4, "node1_mem": 5
+	}`)
+
+	var result Trimmed
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[string]int{"abc": 1, "": 2}, result.Dynamic)
+	assert.Equal(t, map[string]int{"req": 3}, result.Totals)
+	assert.Equal(t, map[string]string{"42": "u"}, result.Users)
+	assert.Equal(t, map[string]string{"one": "a", "two": "b"}, result.Named, "The group named key should be preferred")
+	assert.Equal(t, map[string]string{"Owner": "o"}, result.Headers)
+	assert.Equal(t, map[string]int{"0": 4, "node1": 5}, result.Either, "Keys should be trimmed by the pattern they matched")
+
+	type BadTrim struct {
+		Dynamic map[string]int `jsonpat:"^user_\\d+$,regex,trim"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal(jsonData, &BadTrim{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "needs a capture group")
+
+	type ContainsTrim struct {
+		Dynamic map[string]int `jsonpat:"dyn,contains,trim"`
+	}
+	require.ErrorAs(t, Unmarshal(jsonData, &ContainsTrim{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "can't be used with contains patterns")
+
+	type ScalarTrim struct {
+		Scalar int `jsonpat:"dyn_,prefix,trim"`
+	}
+	require.ErrorAs(t, Unmarshal(jsonData, &ScalarTrim{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "only applies to map fields")
+}
+
+type shardID struct {
+	region string
+	n      int
+}
+
+func (s *shardID) UnmarshalText(text []byte) error {
+	region, n, ok := strings.Cut(string(text), "-")
+	if !ok {
+		return errors.New("shard ids look like <region>-<n>")
+	}
+	parsed, err := strconv.Atoi(n)
+	if err != nil {
+		return err
+	}
+	*s = shardID{region: region, n: parsed}
+	return nil
+}
+
+func (s shardID) MarshalText() ([]byte, error) {
+	return []byte(s.region + "-" + strconv.Itoa(s.n)), nil
+}
+
+func TestUnmarshal_TypedMapKeys(t *testing.T) {
+	type UserID string
+	type Typed struct {
+		Ports  map[int]string        `jsonpat:"port_,prefix,trim"`
+		Codes  map[uint8]bool        `jsonpat:"^code_(\\d+)$,regex,trim"`
+		Users  map[UserID]int        `jsonpat:"user_,prefix"`
+		Shards map[shardID]string    `jsonpat:"_shard,suffix,trim"`
+		Nested map[int16]NestedItem  `jsonpat:"n_,prefix,trim"`
+		Groups map[int64]map[int]int `jsonpat:"g_,prefix,trim"`
+	}
+
+	jsonData := []byte(`{
+		"port_80": "http", "port_-1": "negative",
+		"code_200": true,
+		"user_a": 1,
+		"eu-3_shard": "s",
+		"n_7": {"attr_x": 1},
+		"g_1": {"2": 3}
+	}`)
+
+	var result Typed
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, map[int]string{80: "http", -1: "negative"}, result.Ports)
+	assert.Equal(t, map[uint8]bool{200: true}, result.Codes)
+	assert.Equal(t, map[UserID]int{"user_a": 1}, result.Users)
+	assert.Equal(t, map[shardID]string{{region: "eu", n: 3}: "s"}, result.Shards)
+	assert.Equal(t, map[int16]NestedItem{7: {Attrs: map[string]int{"attr_x": 1}}}, result.Nested)
+	assert.Equal(t, map[int64]map[int]int{1: {2: 3}}, result.Groups)
+
+	var records map[int]NestedItem
+	require.NoError(t, Unmarshal([]byte(`{"1": {"attr_a": 1}}`), &records))
+	assert.Equal(t, map[int]NestedItem{1: {Attrs: map[string]int{"attr_a": 1}}}, records)
+
+	err := Unmarshal([]byte(`{"port_http": "x"}`), &result)
+	assert.ErrorContains(t, err, `invalid map key "http" for type int`)
+	err = Unmarshal([]byte(`{"code_300": true}`), &result)
+	assert.ErrorContains(t, err, `invalid map key "300" for type uint8`)
+	err = Unmarshal([]byte(`{"x_shard": "s"}`), &result)
+	assert.ErrorContains(t, err, "shard ids look like")
+
+	type FloatKeys struct {
+		Dynamic map[float64]int `jsonpat:"f_,prefix"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &FloatKeys{}), &tagErr, "Key types should be validated when the struct is analysed")
+	assert.ErrorContains(t, tagErr, "unsupported map key type float64")
+}
+
+func TestUnmarshal_SliceFields(t *testing.T) {
+	type Collected struct {
+		First   int                        `jsonpat:"val_,prefix"`
+		Values  []int                      `jsonpat:"val_,prefix"`
+		Entries []Entry[int]               `jsonpat:"val_,prefix|num_,prefix,exclude=num_x"`
+		Items   []Entry[NestedItem]        `jsonpat:"item_,prefix"`
+		Labels  map[string]string          `jsonpat:"lbl_,prefix"`
+		Ordered []Entry[string]            `jsonpat:"lbl_,prefix"`
+		Raw     json.RawMessage            `jsonpat:"raw_,prefix"`
+		Rest    map[string]json.RawMessage `jsonpat:",remaining"`
+	}
+
+	jsonData := []byte(`{
+		"val_c": 3, "num_b": 20, "val_a": 1, "num_x": 0, "val_b": 2,
+		"item_z": {"name": "z", "attr_q": 1}, "item_a": {"name": "a"},
+		"lbl_z": "last", "lbl_a": "first",
+		"raw_b": [2], "raw_a": [1]
+	}`)
+
+	var result Collected
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, 1, result.First, "The scalar field should still take the first sorted key")
+	assert.Equal(t, []int{3, 2}, result.Values, "Keys taken by a scalar field shouldn't be collected")
+	assert.Equal(t, []Entry[int]{{"val_c", 3}, {"num_b", 20}, {"val_b", 2}}, result.Entries)
+	assert.Equal(t, []Entry[NestedItem]{
+		{Key: "item_z", Value: NestedItem{Name: "z", Attrs: map[string]int{"attr_q": 1}}},
+		{Key: "item_a", Value: NestedItem{Name: "a", Attrs: map[string]int{}}},
+	}, result.Items)
+	assert.Equal(t, map[string]string{"lbl_z": "last", "lbl_a": "first"}, result.Labels)
+	assert.Equal(t, []Entry[string]{{"lbl_z", "last"}, {"lbl_a", "first"}}, result.Ordered, "Map and slice fields should both claim a key")
+	assert.JSONEq(t, `[1]`, string(result.Raw), "Byte slices should stay scalar fields")
+	assert.Equal(t, map[string]json.RawMessage{"num_x": json.RawMessage(`0`), "raw_b": json.RawMessage(`[2]`)}, result.Rest)
+
+	var empty Collected
+	require.NoError(t, Unmarshal([]byte(`{"other": 1}`), &empty))
+	assert.Nil(t, empty.Values, "Slice fields without matches should be left untouched")
+	assert.Nil(t, empty.Entries)
+
+	err := Unmarshal([]byte(`{"val_a": 1, "val_b": "x"}`), &result)
+	assert.ErrorContains(t, err, "failed to unmarshal dynamic key val_b")
+
+	type TrimmedSlice struct {
+		Values []int `jsonpat:"val_,prefix,trim"`
+	}
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &TrimmedSlice{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "option trim only applies to map fields")
+}
+
+func TestUnmarshal_ScalarPolicies(t *testing.T) {
+	type Prices struct {
+		First    string `jsonpat:"price_,prefix"`
+		Last     string `jsonpat:"cost_,prefix,last"`
+		Document string `jsonpat:"fee_,prefix,document-order"`
+		Unique   string `jsonpat:"tax_,prefix,unique"`
+		Explicit string `jsonpat:"rate_,prefix,first"`
+	}
+
+	jsonData := []byte(`{
+		"price_usd": "1", "price_eur": "2",
+		"cost_a": "a", "cost_c": "c", "cost_b": "b",
+		"fee_z": "z", "fee_a": "a",
+		"tax_only": "t",
+		"rate_b": "b", "rate_a": "a"
+	}`)
+
+	var result Prices
+	require.NoError(t, Unmarshal(jsonData, &result))
+	assert.Equal(t, Prices{First: "2", Last: "c", Document: "z", Unique: "t", Explicit: "a"}, result)
+
+	err := Unmarshal([]byte(`{"tax_usd": "1", "tax_eur": "2", "tax_gbp": "3"}`), &result)
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "Unique", conflict.Field)
+	assert.Equal(t, []string{"tax_usd", "tax_eur", "tax_gbp"}, conflict.Keys, "Every conflicting key should be listed in document order")
+	assert.EqualError(t, err, `jsonpat: conflicting keys "tax_usd", "tax_eur", "tax_gbp" for unique field jsonpat.Prices.Unique`)
+
+	type Shared struct {
+		Primary   string `jsonpat:"id_,prefix"`
+		Secondary string `jsonpat:"id_,prefix,unique"`
+	}
+	var shared Shared
+	require.NoError(t, Unmarshal([]byte(`{"id_b": "b", "id_a": "a"}`), &shared), "Keys taken by earlier fields shouldn't conflict")
+	assert.Equal(t, Shared{Primary: "a", Secondary: "b"}, shared)
+
+	var tagErr *TagError
+	type Combined struct {
+		Dynamic string `jsonpat:"x_,prefix,first,last"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &Combined{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "options first and last can't be combined")
+
+	type MapPolicy struct {
+		Dynamic map[string]int `jsonpat:"x_,prefix,unique"`
+	}
+	require.ErrorAs(t, Unmarshal([]byte(`{}`), &MapPolicy{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "option unique only applies to scalar fields")
+}
+
+func TestUnmarshal_EntryPointerSlice(t *testing.T) {
+	type Pointers struct {
+		Values []*Entry[int] `jsonpat:"v_,prefix"`
+	}
+
+	var tagErr *TagError
+	require.ErrorAs(t, Unmarshal([]byte(`{"v_a": 1}`), &Pointers{}), &tagErr)
+	assert.ErrorContains(t, tagErr, "unsupported slice field type []*jsonpat.Entry[int], collect entries as []jsonpat.Entry[int]")
+
+	_, err := Marshal(Pointers{Values: []*Entry[int]{{Key: "v_a", Value: 1}}})
+	require.ErrorAs(t, err, &tagErr)
+}